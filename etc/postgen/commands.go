@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"postgen/diff"
+	"postgen/schema"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// inlineFlags registers the flags shared by the commands that inline schemas
+// and returns the options they fill in, starting from those set by any
+// schemagen.yaml or schemagen.json in the working directory. A flag replaces
+// what the config file sets, so a repeatable flag used at all replaces the
+// whole list. Logs asked for by the flags go to e.stderr.
+func inlineFlags(e env, flags *flag.FlagSet) (*schema.Options, error) {
+	opts := new(schema.Options)
+	sourceFlags(flags, opts)
+	flags.BoolVar(&opts.KeepAnchoredDefs, "keep-anchored-defs", false, "keep $defs entries that declare an $anchor")
+	flags.BoolVar(&opts.StrictEmpty, "strict-empty", false, "fail on empty files instead of skipping them")
+	flags.BoolVar(&opts.AnnotateProvenance, "annotate-provenance", false, "add a $comment naming the $ref each inlined object came from")
+	flags.BoolVar(&opts.InjectTitleFromDefName, "inject-title-from-def-name", false, "title objects inlined from a $defs entry without a title with the entry name")
+	flags.BoolVar(&opts.UnionTypes, "union-types", false, "union the type of a $ref target with a type set next to the $ref")
+	flags.BoolVar(&opts.MergeArrays, "merge-arrays", false, "union required, allOf and enum of a $ref target with those set next to the $ref")
+	flags.BoolVar(&opts.WrapBooleanTargets, "wrap-boolean-targets", false, "inline a $ref to true or false that has siblings as an allOf next to them")
+	flags.BoolVar(&opts.DedupCombinatorMembers, "dedup-combinator-members", false, "drop allOf and anyOf members identical to an earlier one")
+	flags.BoolVar(&opts.StripAnnotations, "strip-annotations", false, "remove annotation keywords such as title, description and examples from every schema")
+	flags.Func("annotation-keywords", "comma-separated keywords -strip-annotations removes (default "+strings.Join(schema.DefaultAnnotationKeywords, ",")+")", func(s string) error {
+		opts.AnnotationKeywords = strings.Split(s, ",")
+		return nil
+	})
+	flags.Func("strip-path", `JSON Pointer, whose tokens may be globs, of a location to remove from every schema, such as "#/properties/internal"; repeatable`,
+		repeatable(&opts.StripPaths, func(s string) string { return s }))
+	flags.BoolVar(&opts.RequireFullyInlined, "require-fully-inlined", false, "fail if any $ref is left in the output")
+	flags.BoolVar(&opts.StrictSelfContained, "strict-self-contained", false, "fail up front, listing them all, if any $ref points at a URL outside of -dir that no $id matches")
+	flags.BoolVar(&opts.FormatOnly, "format-only", false, "only reformat schemas, without inlining or stripping anything")
+	flags.BoolVar(&opts.PreserveFormatting, "preserve-formatting", false, "keep the source text of every part of a schema left unchanged, only reformatting what inlining changes")
+	flags.BoolVar(&opts.PruneEmptyObjects, "prune-empty-objects", false, "drop objects left empty only by stripping $defs, $id and $schema")
+	flags.BoolVar(&opts.InlineExternalOnly, "inline-external-only", false, "only inline refs into other files, keeping local refs and $defs")
+	flags.BoolVar(&opts.KeepDefs, "keep-defs", false, "keep $defs and refs to them, inlining every other ref")
+	flags.BoolVar(&opts.SafeStrip, "safe-strip", false, "keep a nested $id that a relative $ref left in the output resolves against")
+	flags.BoolVar(&opts.ExtractExamples, "extract-examples", false, "move examples into a <name>.examples.json file next to each schema")
+	flags.Func("min-suffix", "also write a minified copy of each schema, named with this suffix before the extension, such as .min; repeatable",
+		repeatable(&opts.OutputFormats, func(s string) schema.Format { return schema.Format{Suffix: s, Minify: true} }))
+	flags.StringVar(&opts.SamplesDir, "samples", "", "directory, relative to -dir, of sample instances <name>/*.json that must validate the same before and after inlining")
+	flags.BoolVar(&opts.OutputPathFromID, "output-path-from-id", false, "write each schema to a path derived from its $id instead of in place")
+	flags.StringVar(&opts.IDBaseURL, "id-base-url", "", "prefix stripped from each $id by -output-path-from-id (default: scheme and host)")
+	flags.BoolVar(&opts.PreserveRecursiveRefs, "preserve-recursive-refs", false, "keep refs that would close a cycle instead of failing")
+	flags.BoolVar(&opts.RespectInlineMarker, "respect-inline-marker", false, "keep refs to schemas marked with -inline-marker set to false, and those schemas")
+	flags.StringVar(&opts.InlineMarker, "inline-marker", "x-inline", "key marking a schema that refs to shouldn't inline")
+	flags.IntVar(&opts.InlineMaxRefHops, "max-ref-hops", 0, "follow at most this many refs along any path, or 0 for no limit")
+	flags.IntVar(&opts.Concurrency, "jobs", 1, "number of files to inline at once")
+	flags.IntVar(&opts.MaxInputBytes, "max-input-bytes", 0, "fail on source files larger than this many bytes, or 0 for no limit")
+	flags.BoolFunc("v", "log each file and $ref processed to stderr", func(string) error {
+		if opts.Logger == nil {
+			opts.Logger = newLogger(e.stderr, slog.LevelDebug)
+		}
+		return nil
+	})
+	flags.BoolFunc("trace", "log how each $ref is resolved to stderr, as well as what -v logs", func(string) error {
+		opts.Logger = newLogger(e.stderr, schema.LevelTrace)
+		return nil
+	})
+	flags.Func("inline-only", "only inline refs with this prefix or matching this glob; repeatable",
+		repeatable(&opts.InlineOnly, func(s string) string { return s }))
+	flags.Func("target-draft", `upgrade documents to this draft: "2020-12"`, func(s string) error {
+		switch s {
+		case "2020-12", string(schema.Draft202012):
+			opts.TargetDraft = schema.Draft202012
+			return nil
+		}
+		return errors.New(`only "2020-12" is supported`)
+	})
+	flags.Func("line-ending", "line terminator of the output: LF, CRLF or Auto (default LF)",
+		oneOf(&opts.LineEnding, schema.LineEndingLF, schema.LineEndingCRLF, schema.LineEndingAuto))
+	flags.Func("on-missing-ref", "what to do with a $ref whose target doesn't exist: Error, Warn or Remove (default Error)",
+		oneOf(&opts.OnMissingRef, schema.MissingRefError, schema.MissingRefWarn, schema.MissingRefRemove))
+	flags.Func("on-dynamic-ref", "what to do with a $dynamicRef, which can't be inlined: Error or Warn (default Error)",
+		oneOf(&opts.OnDynamicRef, schema.DynamicRefError, schema.DynamicRefWarn))
+	flags.BoolVar(&opts.SubstituteVars, "substitute-env", false, "replace ${NAME} in string values with environment variables")
+	flags.Func("on-unresolved-var", "what to do with a ${NAME} whose variable isn't set: Error or Keep (default Error)",
+		oneOf(&opts.OnUnresolvedVar, schema.UnresolvedVarError, schema.UnresolvedVarKeep))
+	flags.Func("keyword-order", `order schema keywords in the output: "default" for a conventional order, or a comma-separated list`, func(s string) error {
+		if s == "default" {
+			opts.KeywordOrder = schema.DefaultKeywordOrder
+			return nil
+		}
+		opts.KeywordOrder = strings.Split(s, ",")
+		return nil
+	})
+	flags.Func("detect-conflicts", "what to do when a $ref sibling overrides a keyword of the target: Ignore, Warn or Error (default Ignore)",
+		oneOf(&opts.DetectConflicts, schema.ConflictIgnore, schema.ConflictWarn, schema.ConflictError))
+
+	// The config file sets defaults that the flags, parsed later, override.
+	if _, err := schema.LoadConfig(os.DirFS("."), opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// readFlags registers the flags of the commands that read schemas without
+// inlining them, and returns the options they fill in, starting from those
+// set by the config file as with inlineFlags.
+func readFlags(flags *flag.FlagSet) (*schema.Options, error) {
+	opts := new(schema.Options)
+	sourceFlags(flags, opts)
+	if _, err := schema.LoadConfig(os.DirFS("."), opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// sourceFlags registers the flags saying which files are schemas and how to
+// read them and their refs, filling in opts.
+func sourceFlags(flags *flag.FlagSet, opts *schema.Options) {
+	flags.Func("include", `only process files matching this glob, such as "api/*.json", or "*.json" to match names alone; repeatable`,
+		repeatable(&opts.Include, func(s string) string { return s }))
+	flags.Func("exclude", `skip files, and directories, matching this glob, such as "fixtures"; repeatable`,
+		repeatable(&opts.Exclude, func(s string) string { return s }))
+	flags.StringVar(&opts.RefKeyword, "ref-keyword", "", `keyword refs are written with, such as "$include" (default "$ref")`)
+	flags.BoolVar(&opts.LenientRefs, "lenient-refs", false, `treat a $ref starting with "/" as a fragment, as if it started with "#/"`)
+	flags.IntVar(&opts.MaxDepth, "max-depth", schema.DefaultMaxDepth, "maximum nesting depth of a schema")
+	flags.Func("fallback-dir", "directory searched for files named by cross-file refs that aren't found otherwise; repeatable",
+		repeatable(&opts.FallbackFS, func(s string) fs.FS { return os.DirFS(s) }))
+	flags.Func("dialect", "syntax of the input: JSON or JSON5, which also reads *.json5 files (default JSON)",
+		oneOf(&opts.Dialect, schema.DialectJSON, schema.DialectJSON5))
+}
+
+// repeatable returns a flag.Func appending each use of the flag, converted
+// with conv, to *dst. The first use drops what *dst held before, such as
+// values from the config file.
+func repeatable[T any](dst *[]T, conv func(string) T) func(string) error {
+	set := false
+	return func(s string) error {
+		if !set {
+			*dst, set = nil, true
+		}
+		*dst = append(*dst, conv(s))
+		return nil
+	}
+}
+
+// newLogger returns a logger writing records of at least level to w.
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == schema.LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}))
+}
+
+// statsFlags registers the -stats, -stats-json and -resolved-refs flags and
+// returns a function printing the stats they ask for. The stats turn on
+// opts.MeasureInlined.
+func statsFlags(flags *flag.FlagSet, opts *schema.Options) func(w io.Writer, report *schema.Report) error {
+	var table, asJSON bool
+	flags.BoolFunc("stats", "print a summary table at the end", func(string) error {
+		table, opts.MeasureInlined = true, true
+		return nil
+	})
+	flags.BoolFunc("stats-json", "print the summary as JSON at the end", func(string) error {
+		asJSON, opts.MeasureInlined = true, true
+		return nil
+	})
+	resolved := flags.Bool("resolved-refs", false, "print every $ref resolved, where it is and what it resolved to, as JSON at the end")
+	return func(w io.Writer, report *schema.Report) error {
+		st := report.Stats(5)
+		if table {
+			printStats(w, st)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if asJSON {
+			if err := enc.Encode(st); err != nil {
+				return err
+			}
+		}
+		if *resolved {
+			return enc.Encode(report.Resolved())
+		}
+		return nil
+	}
+}
+
+// printStats writes st to w as a table.
+func printStats(w io.Writer, st schema.Stats) {
+	change := ""
+	if st.InputBytes > 0 {
+		change = fmt.Sprintf("(%+.1f%%)", 100*float64(st.OutputBytes-st.InputBytes)/float64(st.InputBytes))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Files processed\t%d\n", st.Files)
+	fmt.Fprintf(tw, "Refs inlined\t%d\n", st.RefsInlined)
+	fmt.Fprintf(tw, "Input bytes\t%d\n", st.InputBytes)
+	fmt.Fprintf(tw, "Output bytes\t%d %s\n", st.OutputBytes, change)
+	if len(st.TopDefs) > 0 {
+		fmt.Fprintf(tw, "\nMost expanded defs\tCount\tBytes\n")
+		for _, u := range st.TopDefs {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", u.Ref, u.Count, u.Bytes)
+		}
+	}
+	_ = tw.Flush()
+}
+
+// oneOf returns a flag.Func that sets dst to whichever of values matches the
+// flag, ignoring case.
+func oneOf[T ~string](dst *T, values ...T) func(string) error {
+	return func(s string) error {
+		for _, v := range values {
+			if strings.EqualFold(s, string(v)) {
+				*dst = v
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %q", values)
+	}
+}
+
+// inlineDir inlines the schemas under dir, logging any diagnostics. Progress
+// is shown on stderr if it's a terminal.
+func inlineDir(e env, dir string, opts *schema.Options) (map[string][]byte, *schema.Report, error) {
+	report := new(schema.Report)
+	opts.Report = report
+	if f, ok := e.stderr.(*os.File); ok && isTerminal(f) {
+		opts.Progress = func(done, total int) {
+			fmt.Fprintf(f, "\r%d/%d files", done, total)
+			if done == total {
+				fmt.Fprintln(f)
+			}
+		}
+	}
+	updates, err := schema.InlineBundledSchemasInFS(os.DirFS(dir), *opts)
+	if opts.Logger == nil { // Otherwise already logged.
+		for _, d := range report.Diagnostics {
+			e.log.Warn(d.Message, "path", d.Path)
+		}
+	}
+	for _, c := range report.Cycles() {
+		e.log.Info("Preserved recursive refs", "cycle", strings.Join(c, " -> "))
+	}
+	return updates, report, err
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runInline(e env, flags *flag.FlagSet, args []string) error {
+	dir := flags.String("dir", "jsonschema", "directory of the schemas to inline")
+	patch := flags.String("patch", "", "write the changes to this file as a unified diff for git apply instead of modifying any files")
+	check := flags.Bool("check", false, "list the files inlining would change and fail if there are any, without modifying anything")
+	list := flags.Bool("list", false, "print the files that would be inlined, sorted, after -include and -exclude, without processing anything")
+	opts, err := inlineFlags(e, flags)
+	if err != nil {
+		return err
+	}
+	printStats := statsFlags(flags, opts)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *list {
+		return listDir(e, *dir, opts)
+	}
+	if *check {
+		return checkDir(e, *dir, opts)
+	}
+	if flags.Arg(0) == "-" {
+		report, err := inlineStdin(e, opts)
+		if err != nil {
+			return err
+		}
+		// Stdout holds the schema.
+		return printStats(e.stderr, report)
+	}
+
+	updates, report, err := inlineDir(e, *dir, opts)
+	if err != nil {
+		return err
+	}
+	if *patch != "" {
+		if err := writePatch(e, *patch, *dir, updates); err != nil {
+			return err
+		}
+		return printStats(e.stdout, report)
+	}
+
+	for src, out := range updates {
+		pa := outputName(src)
+		dst := filepath.Join(*dir, filepath.FromSlash(pa))
+		err = os.MkdirAll(filepath.Dir(dst), 0o755)
+		if err == nil {
+			err = writeFile(dst, out, 0o644)
+		}
+		if err != nil {
+			e.log.Error("Failed to write file", "err", err.Error(), "path", pa)
+			continue
+		}
+		if pa != src {
+			_ = os.Remove(filepath.Join(*dir, filepath.FromSlash(src)))
+		}
+	}
+	return printStats(e.stdout, report)
+}
+
+// listDir prints the files under dir that inlining would process, which
+// shows what opts.Include and opts.Exclude let through.
+func listDir(e env, dir string, opts *schema.Options) error {
+	paths, err := schema.ListSchemaFiles(os.DirFS(dir), *opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Fprintln(e.stdout, p)
+	}
+	return nil
+}
+
+// checkDir lists the files under dir that inlining would change, failing if
+// there are any.
+func checkDir(e env, dir string, opts *schema.Options) error {
+	err := schema.Verify(os.DirFS(dir), *opts)
+	var stale *schema.StaleError
+	if errors.As(err, &stale) {
+		for _, p := range stale.Paths {
+			fmt.Fprintln(e.stdout, p)
+		}
+	}
+	return err
+}
+
+// outputName returns the path the inlined schema read from src is written to.
+func outputName(src string) string {
+	return strings.ReplaceAll(src, ".jsonschema.strict.bundle", "")
+}
+
+// writePatch writes updates to the file name as one unified diff against the
+// files under dir, with paths relative to the working directory. Compressed
+// files are left out, since a text diff can't describe them.
+func writePatch(e env, name, dir string, updates map[string][]byte) error {
+	var buf bytes.Buffer
+	for _, src := range slices.Sorted(maps.Keys(updates)) {
+		pa := outputName(src)
+		if strings.HasSuffix(strings.ToLower(pa), ".gz") {
+			e.log.Warn("Left compressed file out of the patch", "path", pa)
+			continue
+		}
+		d, err := fileDiff(dir, pa, updates[src])
+		if err != nil {
+			return err
+		}
+		buf.Write(d)
+		if pa != src {
+			if d, err = fileDiff(dir, src, nil); err != nil {
+				return err
+			}
+			buf.Write(d)
+		}
+	}
+	return writeFile(name, buf.Bytes(), 0o644)
+}
+
+// fileDiff returns the unified diff turning the file at p under dir into data,
+// which is nil if the file is to be deleted.
+func fileDiff(dir, p string, data []byte) ([]byte, error) {
+	name := filepath.ToSlash(filepath.Join(dir, filepath.FromSlash(p)))
+	oldName, newName := "a/"+name, "b/"+name
+	old, err := os.ReadFile(filepath.FromSlash(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		oldName = "/dev/null"
+	} else if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		newName = "/dev/null"
+	}
+	return diff.Unified(oldName, newName, old, data), nil
+}
+
+// inlineStdin inlines the schema read from stdin and writes it to stdout.
+// Cross-file refs resolve against the working directory.
+func inlineStdin(e env, opts *schema.Options) (*schema.Report, error) {
+	b, err := io.ReadAll(e.stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	report := new(schema.Report)
+	opts.Report = report
+	opts.FS = os.DirFS(".")
+	out, err := schema.InlineSchemaBytes(b, *opts)
+	if opts.Logger == nil {
+		for _, d := range report.Diagnostics {
+			e.log.Warn(d.Message)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = e.stdout.Write(out)
+	return report, err
+}
+
+func runBundle(e env, flags *flag.FlagSet, args []string) error {
+	dir := flags.String("dir", "jsonschema", "directory of the schemas to bundle")
+	out := flags.String("out", "", "file to write the bundle to (default stdout)")
+	opts, err := inlineFlags(e, flags)
+	if err != nil {
+		return err
+	}
+	flags.Func("defs-order", "order of the bundled $defs: Name or FirstReference (default Name)",
+		oneOf(&opts.DefsOrder, schema.DefsOrderName, schema.DefsOrderFirstReference))
+	flags.StringVar(&opts.BundleID, "id", "", "top-level $id of the bundle")
+	flags.StringVar(&opts.BundleSchema, "schema", "", "top-level $schema of the bundle (default that of the file)")
+	flags.StringVar(&opts.IndexPath, "index", "", "also write a JSON index of the bundled $defs to this file, relative to -dir")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	report := new(schema.Report)
+	opts.Report = report
+	var fsys fs.FS = os.DirFS(*dir)
+	if opts.IndexPath != "" {
+		fsys = newDirFS(*dir)
+	}
+	b, err := schema.BundleSchema(fsys, flags.Arg(0), *opts)
+	if opts.Logger == nil {
+		for _, d := range report.Diagnostics {
+			e.log.Warn(d.Message, "path", d.Path)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = e.stdout.Write(b)
+		return err
+	}
+	return writeFile(*out, b, 0o644)
+}
+
+func runSplit(_ env, flags *flag.FlagSet, args []string) error {
+	var opts schema.SplitOptions
+	out := flags.String("out", ".", "directory to write the rewritten document and the extracted files to")
+	flags.StringVar(&opts.MainPath, "main", "schema.json", "path of the rewritten document, relative to -out")
+	flags.StringVar(&opts.DefsDir, "defs-dir", "defs", "directory of the extracted files, relative to -out")
+	flags.IntVar(&opts.MinOccurrences, "min-occurrences", 2, "extract subschemas with at least this many identical copies")
+	flags.IntVar(&opts.MinBytes, "min-bytes", 32, "extract subschemas of at least this many bytes as compact JSON")
+	flags.Func("line-ending", "line terminator of the output: LF, CRLF or Auto (default LF)",
+		oneOf(&opts.LineEnding, schema.LineEndingLF, schema.LineEndingCRLF, schema.LineEndingAuto))
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	b, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	files, err := schema.SplitSchema(b, opts)
+	if err != nil {
+		return fmt.Errorf("split %s: %w", flags.Arg(0), err)
+	}
+	for p, data := range files {
+		dst := filepath.Join(*out, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := writeFile(dst, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCheck(e env, flags *flag.FlagSet, args []string) error {
+	dir := flags.String("dir", "jsonschema", "directory of the schemas to check")
+	strict := flags.Bool("strict", false, "fail on warnings too")
+	opts, err := inlineFlags(e, flags)
+	if err != nil {
+		return err
+	}
+	printStats := statsFlags(flags, opts)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	updates, report, err := inlineDir(e, *dir, opts)
+	if err != nil {
+		return err
+	}
+	if *strict && len(report.Diagnostics) > 0 {
+		return fmt.Errorf("%d warnings", len(report.Diagnostics))
+	}
+	e.log.Info("Checked schemas", "files", len(updates))
+	return printStats(e.stdout, report)
+}
+
+func runLint(e env, flags *flag.FlagSet, args []string) error {
+	dir := flags.String("dir", "jsonschema", "directory of the schemas to lint")
+	opts, err := readFlags(flags)
+	if err != nil {
+		return err
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	findings, err := schema.Lint(os.DirFS(*dir), *opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		fmt.Fprintln(e.stdout, f)
+	}
+	if schema.HasErrors(findings) {
+		return fmt.Errorf("%d findings, with errors", len(findings))
+	}
+	return nil
+}
+
+func runGraph(e env, flags *flag.FlagSet, args []string) error {
+	dir := flags.String("dir", "jsonschema", "directory of the schemas to graph")
+	opts, err := readFlags(flags)
+	if err != nil {
+		return err
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	edges, err := schema.RefGraph(os.DirFS(*dir), *opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, "digraph refs {")
+	for _, edge := range edges {
+		fmt.Fprintf(e.stdout, "\t%q -> %q;\n", edge.From, edge.To)
+	}
+	fmt.Fprintln(e.stdout, "}")
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package diff renders line-based unified diffs that patch and git apply
+// accept.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// opKind is what an edit does to a line.
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+// op is one line of an edit script.
+type op struct {
+	kind opKind
+	// line includes its terminator, if it has one.
+	line string
+}
+
+// Unified returns the unified diff turning a, the file oldName, into b, the
+// file newName, or nil if they're equal. Either name may be "/dev/null" to
+// describe a file being created or deleted.
+func Unified(oldName, newName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	ops := edits(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	// oldLine and newLine count the lines of a and b before ops[i].
+	oldLine, newLine := 0, 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		end := hunkEnd(ops, i)
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != opInsert {
+				oldCount++
+			}
+			if o.kind != opDelete {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, o := range ops[start:end] {
+			buf.WriteByte(byte(o.kind))
+			buf.WriteString(o.line)
+			if len(o.line) == 0 || o.line[len(o.line)-1] != '\n' {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		for _, o := range ops[i:end] {
+			if o.kind != opInsert {
+				oldLine++
+			}
+			if o.kind != opDelete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// hunkEnd returns the index just past the hunk holding the change at ops[i]:
+// past the trailing context of the last change that is no more than twice the
+// context away from the one before it.
+func hunkEnd(ops []op, i int) int {
+	end := i
+	for j := i; j < len(ops); j++ {
+		if ops[j].kind != opEqual {
+			end = j + 1
+		} else if j-end >= 2*context {
+			break
+		}
+	}
+	return min(len(ops), end+context)
+}
+
+// hunkRange formats the start line and line count of one side of a hunk. An
+// empty side is numbered after the line it follows, as diff does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits b into lines, each keeping its terminator, so a missing
+// newline at the end is a difference like any other.
+func splitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		lines = append(lines, string(b[:i]))
+		b = b[i:]
+	}
+	return lines
+}
+
+// edits returns the shortest edit script turning a into b, found with the
+// Myers algorithm. The common prefix and suffix are matched up front, which
+// keeps the search small for the usual diff of a few changed lines.
+func edits(a, b []string) []op {
+	var prefix, suffix []op
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, op{opEqual, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, op{opEqual, a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	slices.Reverse(suffix)
+
+	n, m := len(a), len(b)
+	offset := n + m
+	// v[offset+k] is the furthest x reached on diagonal k = x-y; trace holds
+	// v as it was before each round d.
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var script []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, op{opEqual, a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			script = append(script, op{opInsert, b[y]})
+		} else {
+			x--
+			script = append(script, op{opDelete, a[x]})
+		}
+	}
+	slices.Reverse(script)
+	return slices.Concat(prefix, script, suffix)
+}
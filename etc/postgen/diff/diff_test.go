@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DiffTestSuite struct {
+	suite.Suite
+}
+
+func (d *DiffTestSuite) TestUnified() {
+	type test struct {
+		Old      string
+		New      string
+		Expected string
+	}
+
+	lines := func(from, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			sb.WriteString(string(rune('a'+i-1)) + "\n")
+		}
+		return sb.String()
+	}
+
+	tests := map[string]test{
+		"equal": {Old: "a\nb\n", New: "a\nb\n"},
+		"changed line": {
+			Old: lines(1, 10),
+			New: strings.Replace(lines(1, 10), "e\n", "E\n", 1),
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -2,7 +2,7 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+`,
+		},
+		"separate hunks": {
+			Old: lines(1, 20),
+			New: "A\n" + lines(2, 19) + "t\nu\n",
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -1,4 +1,4 @@
+-a
++A
+ b
+ c
+ d
+@@ -18,3 +18,4 @@
+ r
+ s
+ t
++u
+`,
+		},
+		"joined hunks": {
+			Old: lines(1, 10),
+			New: "A\n" + lines(2, 7) + "H\n" + lines(9, 10),
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -1,10 +1,10 @@
+-a
++A
+ b
+ c
+ d
+ e
+ f
+ g
+-h
++H
+ i
+ j
+`,
+		},
+		"no newline at end": {
+			Old: "a\nb\n",
+			New: "a\nb",
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -1,2 +1,2 @@
+ a
+-b
++b
+\ No newline at end of file
+`,
+		},
+		"created": {
+			New: "a\nb\n",
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		"emptied": {
+			Old: "a\n",
+			Expected: `--- a/x.json
++++ b/x.json
+@@ -1,1 +0,0 @@
+-a
+`,
+		},
+	}
+
+	for desc, v := range tests {
+		d.Run(desc, func() {
+			d.Equal(v.Expected, string(Unified("a/x.json", "b/x.json", []byte(v.Old), []byte(v.New))))
+		})
+	}
+}
+
+func (d *DiffTestSuite) TestEditsShortest() {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+
+	changes := 0
+	var gotA, gotB []string
+	for _, o := range edits(a, b) {
+		if o.kind != opInsert {
+			gotA = append(gotA, o.line)
+		}
+		if o.kind != opDelete {
+			gotB = append(gotB, o.line)
+		}
+		if o.kind != opEqual {
+			changes++
+		}
+	}
+	d.Equal(a, gotA)
+	d.Equal(b, gotB)
+	d.Equal(5, changes)
+}
+
+func TestDiffTestSuite(t *testing.T) {
+	suite.Run(t, new(DiffTestSuite))
+}
@@ -1,27 +1,122 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"postgen/schema"
 	"strings"
 )
 
+// command is a postgen subcommand.
+type command struct {
+	name string
+	// args describes the positional arguments in the usage line.
+	args    string
+	summary string
+	// run registers the command's flags on flags, parses args with them and
+	// runs the command in e.
+	run func(e env, flags *flag.FlagSet, args []string) error
+}
+
+// env is what a command reads from and writes to.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// log writes to stderr.
+	log *slog.Logger
+}
+
+// errUsage is returned by a command given arguments it can't run with, once
+// it has printed its usage.
+var errUsage = errors.New("usage")
+
+// commands lists the subcommands. The first one runs when none is named.
+var commands = []command{
+	{name: "inline", args: "[-]", summary: "Inline $refs in every schema under a directory, in place, or in one schema read from\nstdin if the argument is \"-\", writing it to stdout.", run: runInline},
+	{name: "bundle", args: "<file>", summary: "Bundle a schema under a directory, and every definition it refers to, into one document\nwith a $defs registry.", run: runBundle},
+	{name: "split", args: "<file>", summary: "Move duplicated subschemas of a document into separate files.", run: runSplit},
+	{name: "check", summary: "Inline every schema under a directory without writing, reporting problems.", run: runCheck},
+	{name: "lint", summary: "Report schema convention violations under a directory without modifying anything.", run: runLint},
+	{name: "graph", summary: "Print the $ref graph of the schemas under a directory in DOT format.", run: runGraph},
+}
+
 func main() {
-	js := os.DirFS("jsonschema")
-	updates, err := schema.InlineBundledSchemasInFS(js)
-	if err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, log: slog.Default()}))
+}
+
+// run runs the command args name, or the default one, in e and returns the
+// exit status: 0 on success, 1 if the command failed and 2 if args are wrong.
+func run(args []string, e env) int {
+	cmd := commands[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] == "help" {
+			usage(e.stderr)
+			return 0
+		}
+		c, ok := lookupCommand(args[0])
+		if !ok {
+			fmt.Fprintf(e.stderr, "unknown command %q\n\n", args[0])
+			usage(e.stderr)
+			return 2
+		}
+		cmd, args = c, args[1:]
+	}
+
+	err := cmd.run(e, cmd.flagSet(e.stderr), args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	e.log.Error(err.Error())
+	return 1
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
 	}
+	return command{}, false
+}
 
-	for pa, out := range updates {
-		_ = os.Remove(filepath.Join("jsonschema", pa))
-		pa = strings.ReplaceAll(pa, ".jsonschema.strict.bundle", "")
-		err = os.WriteFile(filepath.Join("jsonschema", pa), out, 0o644)
-		if err != nil {
-			slog.Error("Failed to write file", "err", err.Error(), "path", pa)
+// usage prints the list of commands to w.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: postgen [command] [flags]\n\ncommands:\n")
+	for i, c := range commands {
+		def := ""
+		if i == 0 {
+			def = " (default)"
 		}
+		fmt.Fprintf(w, "  %-8s %s%s\n", c.name, c.summary, def)
+	}
+	fmt.Fprintf(w, "\nRun \"postgen <command> -h\" for the flags of a command.\n")
+}
+
+// flagSet returns an empty flag set for c, writing errors to w, whose usage
+// message describes it.
+func (c command) flagSet(w io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	flags.SetOutput(w)
+	flags.Usage = func() {
+		fmt.Fprintf(w, "usage: %s\n\n%s\n\nflags:\n", strings.TrimSpace("postgen "+c.name+" [flags] "+c.args), c.summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses args with flags, returning errUsage if they're wrong and
+// flag.ErrHelp if they ask for the usage, which flags has printed either way.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
 	}
+	return err
 }
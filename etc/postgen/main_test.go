@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MainTestSuite struct {
+	suite.Suite
+}
+
+// fixture is a directory of schemas under the default -dir, with user.json
+// yet to be inlined and name.json already inlined.
+var fixture = fstest.MapFS{
+	"jsonschema/user.json": {Data: []byte(`{"properties": {"name": {"$ref": "name.json"}}}`)},
+	"jsonschema/name.json": {Data: []byte("{\n  \"type\": \"string\"\n}\n")},
+}
+
+// includeFixture is fixture with its refs written with "$include".
+var includeFixture = fstest.MapFS{
+	"jsonschema/user.json": {Data: []byte(`{"properties": {"name": {"$include": "name.json"}}}`)},
+	"jsonschema/name.json": fixture["jsonschema/name.json"],
+}
+
+// withConfig returns files with a schemagen.yaml holding config added.
+func withConfig(files fstest.MapFS, config string) fstest.MapFS {
+	files = maps.Clone(files)
+	files["schemagen.yaml"] = &fstest.MapFile{Data: []byte(config)}
+	return files
+}
+
+// inlinedUser is what jsonschema/user.json of fixture inlines to.
+const inlinedUser = "{\n  \"properties\": {\n    \"name\": {\n      \"type\": \"string\"\n    }\n  }\n}\n"
+
+// runIn runs postgen with args and stdin in a temporary working directory
+// holding files, returning the exit status, what it wrote to stdout and
+// stderr, and the directory.
+func (m *MainTestSuite) runIn(files fstest.MapFS, stdin string, args ...string) (code int, stdout, stderr string, dir string) {
+	dir = m.T().TempDir()
+	m.Require().NoError(os.CopyFS(dir, files))
+	m.T().Chdir(dir)
+
+	var out, errOut bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&errOut, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	code = run(args, env{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut, log: log})
+	return code, out.String(), errOut.String(), dir
+}
+
+func (m *MainTestSuite) TestRun() {
+	type test struct {
+		Files fstest.MapFS
+		Stdin string
+		Args  []string
+
+		ExpectedCode   int
+		ExpectedStdout string
+		// ExpectedStderr is a substring of stderr, or, if empty, all of it.
+		ExpectedStderr string
+		// ExpectedFiles are files of the working directory afterwards.
+		ExpectedFiles map[string]string
+	}
+
+	tests := map[string]test{
+		"inline by default": {
+			Files:         fixture,
+			ExpectedFiles: map[string]string{"jsonschema/user.json": inlinedUser},
+		},
+		"inline": {
+			Files:         fstest.MapFS{"schemas/user.json": fixture["jsonschema/user.json"], "schemas/name.json": fixture["jsonschema/name.json"]},
+			Args:          []string{"inline", "-dir", "schemas"},
+			ExpectedFiles: map[string]string{"schemas/user.json": inlinedUser},
+		},
+		"inline failure": {
+			Files:          fstest.MapFS{"jsonschema/user.json": {Data: []byte(`{"$ref": "gone.json"}`)}},
+			ExpectedCode:   1,
+			ExpectedStderr: `level=ERROR msg="inline refs in user.json: read gone.json: `,
+			ExpectedFiles:  map[string]string{"jsonschema/user.json": `{"$ref": "gone.json"}`},
+		},
+		"stdin": {
+			Files:          fixture,
+			Stdin:          `{"items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"type": "integer"}}}`,
+			Args:           []string{"inline", "-"},
+			ExpectedStdout: "{\n  \"items\": {\n    \"type\": \"integer\"\n  }\n}\n",
+			ExpectedFiles:  map[string]string{"jsonschema/user.json": `{"properties": {"name": {"$ref": "name.json"}}}`},
+		},
+		"stdin refs resolve against the working directory": {
+			Files:          fixture,
+			Stdin:          `{"$ref": "jsonschema/name.json"}`,
+			Args:           []string{"-"},
+			ExpectedStdout: "{\n  \"type\": \"string\"\n}\n",
+		},
+		"stdin failure": {
+			Stdin:          `{"a": `,
+			Args:           []string{"inline", "-"},
+			ExpectedCode:   1,
+			ExpectedStderr: "level=ERROR msg=\"parse: unexpected end of JSON input\"\n",
+		},
+		"check stale": {
+			Files:          fixture,
+			Args:           []string{"inline", "-check"},
+			ExpectedCode:   1,
+			ExpectedStdout: "user.json\n",
+			ExpectedStderr: "level=ERROR msg=\"inlined schemas are out of date: user.json\"\n",
+			ExpectedFiles:  map[string]string{"jsonschema/user.json": `{"properties": {"name": {"$ref": "name.json"}}}`},
+		},
+		"check up to date": {
+			Files: fstest.MapFS{"jsonschema/name.json": fixture["jsonschema/name.json"]},
+			Args:  []string{"inline", "-check"},
+		},
+		"list": {
+			Files: fstest.MapFS{
+				"jsonschema/user.json":     fixture["jsonschema/user.json"],
+				"jsonschema/a/b/name.json": fixture["jsonschema/name.json"],
+				"jsonschema/notes.txt":     {Data: []byte("not a schema")},
+			},
+			Args:           []string{"inline", "-list"},
+			ExpectedStdout: "a/b/name.json\nuser.json\n",
+		},
+		"list with excluded fixtures": {
+			Files: withConfig(fstest.MapFS{
+				"jsonschema/user.json":              fixture["jsonschema/user.json"],
+				"jsonschema/name.json":              fixture["jsonschema/name.json"],
+				"jsonschema/fixtures/bad.json":      {Data: []byte(`{`)},
+				"jsonschema/api/fixtures/copy.json": {Data: []byte(`{}`)},
+				"jsonschema/api/order.draft.json":   {Data: []byte(`{}`)},
+				"jsonschema/api/order.json":         {Data: []byte(`{}`)},
+			}, `exclude: [fixtures]`),
+			Args:           []string{"inline", "-list", "-exclude", "fixtures", "-exclude", "*.draft.json"},
+			ExpectedStdout: "api/order.json\nname.json\nuser.json\n",
+		},
+		"list included": {
+			Files: fstest.MapFS{
+				"jsonschema/user.json":      fixture["jsonschema/user.json"],
+				"jsonschema/api/order.json": {Data: []byte(`{}`)},
+				"jsonschema/api/item.json":  {Data: []byte(`{}`)},
+			},
+			Args:           []string{"inline", "-list", "-include", "api/*", "-exclude", "item.json"},
+			ExpectedStdout: "api/order.json\n",
+		},
+		"list with a bad glob": {
+			Args:           []string{"inline", "-list", "-exclude", "["},
+			ExpectedCode:   1,
+			ExpectedStderr: "level=ERROR msg=\"invalid path pattern \\\"[\\\": syntax error in pattern\"\n",
+		},
+		"patch": {
+			Files: fixture,
+			Args:  []string{"inline", "-patch", "out.diff"},
+			ExpectedFiles: map[string]string{
+				"jsonschema/user.json": `{"properties": {"name": {"$ref": "name.json"}}}`,
+				"out.diff": "--- a/jsonschema/user.json\n+++ b/jsonschema/user.json\n@@ -1,1 +1,7 @@\n" +
+					"-{\"properties\": {\"name\": {\"$ref\": \"name.json\"}}}\n\\ No newline at end of file\n" +
+					"+{\n+  \"properties\": {\n+    \"name\": {\n+      \"type\": \"string\"\n+    }\n+  }\n+}\n",
+			},
+		},
+		"stats": {
+			Files: fixture,
+			Args:  []string{"inline", "-stats"},
+			ExpectedStdout: "Files processed  2\nRefs inlined     1\nInput bytes      70\nOutput bytes     92 (+31.4%)\n\n" +
+				"Most expanded defs  Count  Bytes\nname.json#          1      17\n",
+		},
+		"stats json": {
+			Files: fixture,
+			Args:  []string{"inline", "-stats-json"},
+			ExpectedStdout: `{
+  "files": 2,
+  "refsInlined": 1,
+  "inputBytes": 70,
+  "outputBytes": 92,
+  "topDefs": [
+    {
+      "ref": "name.json#",
+      "count": 1,
+      "bytes": 17
+    }
+  ]
+}
+`,
+		},
+		"stats go to stderr with stdin": {
+			Files:          fixture,
+			Stdin:          `{"$ref": "jsonschema/name.json"}`,
+			Args:           []string{"inline", "-stats", "-"},
+			ExpectedStdout: "{\n  \"type\": \"string\"\n}\n",
+			ExpectedStderr: "Refs inlined     1\n",
+		},
+		"check command": {
+			Files:          fixture,
+			Args:           []string{"check"},
+			ExpectedStderr: "level=INFO msg=\"Checked schemas\" files=2\n",
+			ExpectedFiles:  map[string]string{"jsonschema/user.json": `{"properties": {"name": {"$ref": "name.json"}}}`},
+		},
+		"bundle": {
+			Files:          fixture,
+			Args:           []string{"bundle", "user.json"},
+			ExpectedStdout: "{\n  \"$defs\": {\n    \"name\": {\n      \"type\": \"string\"\n    }\n  },\n  \"properties\": {\n    \"name\": {\n      \"$ref\": \"#/$defs/name\"\n    }\n  }\n}\n",
+		},
+		"bundle without a file": {
+			Args:           []string{"bundle"},
+			ExpectedCode:   2,
+			ExpectedStderr: "usage: postgen bundle [flags] <file>",
+		},
+		"graph": {
+			Files:          fixture,
+			Args:           []string{"graph"},
+			ExpectedStdout: "digraph refs {\n\t\"user.json\" -> \"name.json\";\n}\n",
+		},
+		"graph with a custom ref keyword": {
+			Files:          includeFixture,
+			Args:           []string{"graph", "-ref-keyword", "$include"},
+			ExpectedStdout: "digraph refs {\n\t\"user.json\" -> \"name.json\";\n}\n",
+		},
+		"graph with a custom ref keyword from the config": {
+			Files:          withConfig(includeFixture, `refKeyword: $include`),
+			Args:           []string{"graph"},
+			ExpectedStdout: "digraph refs {\n\t\"user.json\" -> \"name.json\";\n}\n",
+		},
+		"lint with a custom ref keyword": {
+			Files:          fstest.MapFS{"jsonschema/user.json": {Data: []byte(`{"properties": {"name": {"$include": "#/$defs/Gone"}}}`)}},
+			Args:           []string{"lint", "-ref-keyword", "$include"},
+			ExpectedCode:   1,
+			ExpectedStdout: "user.json#/properties/name/$include: error: unresolved $ref \"#/$defs/Gone\": missing key \"$defs\" (unresolved-ref)\n",
+			ExpectedStderr: "level=ERROR msg=\"1 findings, with errors\"\n",
+		},
+		"lint without the custom ref keyword": {
+			Files: fstest.MapFS{"jsonschema/user.json": {Data: []byte(`{"properties": {"name": {"$include": "#/$defs/Gone"}}}`)}},
+			Args:  []string{"lint"},
+		},
+		"unknown command": {
+			Args:           []string{"publish"},
+			ExpectedCode:   2,
+			ExpectedStderr: "unknown command \"publish\"\n\nusage: postgen [command] [flags]",
+		},
+		"unknown flag": {
+			Args:           []string{"inline", "-nope"},
+			ExpectedCode:   2,
+			ExpectedStderr: "flag provided but not defined: -nope\nusage: postgen inline [flags] [-]",
+		},
+		"help": {
+			Args:           []string{"help"},
+			ExpectedStderr: "  inline   Inline $refs in every schema under a directory",
+		},
+		"command help": {
+			Args:           []string{"graph", "-h"},
+			ExpectedStderr: "usage: postgen graph [flags]\n\nPrint the $ref graph",
+		},
+	}
+
+	for desc, v := range tests {
+		m.Run(desc, func() {
+			code, stdout, stderr, dir := m.runIn(v.Files, v.Stdin, v.Args...)
+			m.Equal(v.ExpectedCode, code, "exit status, with stderr %q", stderr)
+			m.Equal(v.ExpectedStdout, stdout, "stdout")
+			if v.ExpectedStderr == "" {
+				m.Empty(stderr, "stderr")
+			} else {
+				m.Contains(stderr, v.ExpectedStderr, "stderr")
+			}
+			for name, want := range v.ExpectedFiles {
+				got, err := fs.ReadFile(os.DirFS(dir), name)
+				m.Require().NoError(err)
+				m.Equal(want, string(got), name)
+			}
+		})
+	}
+}
+
+func (m *MainTestSuite) TestRunConfig() {
+	type test struct {
+		Args           []string
+		ExpectedCode   int
+		ExpectedStdout string
+		ExpectedStderr string
+	}
+
+	files := fstest.MapFS{
+		"schemagen.yaml": {Data: []byte(`
+exclude: [fixtures]
+maxInputBytes: 10
+stripPaths: ["#/properties/secret"]
+`)},
+		"jsonschema/user.json":          {Data: []byte(`{"properties": {"secret": {}, "name": {}}}`)},
+		"jsonschema/fixtures/copy.json": {Data: []byte(`{}`)},
+		"jsonschema/draft.json":         {Data: []byte(`{}`)},
+	}
+
+	tests := map[string]test{
+		"config": {
+			Args:           []string{"inline", "-list"},
+			ExpectedStdout: "draft.json\nuser.json\n",
+		},
+		"repeatable flag replaces the config": {
+			Args:           []string{"inline", "-list", "-exclude", "draft.json"},
+			ExpectedStdout: "fixtures/copy.json\nuser.json\n",
+		},
+		"repeatable flag used twice": {
+			Args:           []string{"inline", "-list", "-exclude", "draft.json", "-exclude", "user.json"},
+			ExpectedStdout: "fixtures/copy.json\n",
+		},
+		"config limit": {
+			Args:           []string{"inline", "-check"},
+			ExpectedCode:   1,
+			ExpectedStderr: "level=ERROR msg=\"user.json is 42 bytes, more than the maximum of 10 for a source schema\"\n",
+		},
+		"flag replaces the config": {
+			Args:           []string{"inline", "-check", "-max-input-bytes", "0"},
+			ExpectedCode:   1,
+			ExpectedStdout: "draft.json\nuser.json\n",
+		},
+		"strip path from the config": {
+			Args:           []string{"inline", "-max-input-bytes", "0", "-"},
+			ExpectedStdout: "{\n  \"properties\": {\n    \"name\": {}\n  }\n}\n",
+		},
+		"strip path flag replaces the config": {
+			Args:           []string{"inline", "-max-input-bytes", "0", "-strip-path", "#/properties/name", "-"},
+			ExpectedStdout: "{\n  \"properties\": {\n    \"secret\": {}\n  }\n}\n",
+		},
+	}
+
+	for desc, v := range tests {
+		m.Run(desc, func() {
+			code, stdout, stderr, _ := m.runIn(files, `{"properties": {"secret": {}, "name": {}}}`, v.Args...)
+			m.Equal(v.ExpectedCode, code, "exit status, with stderr %q", stderr)
+			m.Equal(v.ExpectedStdout, stdout, "stdout")
+			if v.ExpectedStderr != "" {
+				m.Equal(v.ExpectedStderr, stderr, "stderr")
+			}
+		})
+	}
+
+	code, _, stderr, _ := m.runIn(fstest.MapFS{"schemagen.yaml": {Data: []byte(`indentation: 2`)}}, "", "inline", "-list")
+	m.Equal(1, code)
+	m.Equal("level=ERROR msg=\"read config schemagen.yaml: json: unknown field \\\"indentation\\\"\"\n", stderr)
+}
+
+func (m *MainTestSuite) TestRunSplit() {
+	code, stdout, stderr, dir := m.runIn(fstest.MapFS{
+		"big.json": {Data: []byte(`{"properties": {
+			"a": {"type": "string", "minLength": 1, "maxLength": 100},
+			"b": {"type": "string", "minLength": 1, "maxLength": 100}
+		}}`)},
+	}, "", "split", "-out", "out", "big.json")
+	m.Equal(0, code, stderr)
+	m.Empty(stdout)
+
+	var names []string
+	err := fs.WalkDir(os.DirFS(filepath.Join(dir, "out")), ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, p)
+		}
+		return err
+	})
+	m.Require().NoError(err)
+	m.Len(names, 2)
+	m.Contains(names, "schema.json")
+}
+
+func TestMainTestSuite(t *testing.T) {
+	suite.Run(t, new(MainTestSuite))
+}
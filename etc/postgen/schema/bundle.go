@@ -0,0 +1,367 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefsOrder is the order of the $defs entries BundleSchema collects.
+type DefsOrder string
+
+const (
+	// DefsOrderName orders entries alphabetically by name. It's the default.
+	DefsOrderName DefsOrder = "Name"
+	// DefsOrderFirstReference orders entries by where they're first
+	// referenced, reading the output from the top: entries referenced from
+	// outside $defs come first, then entries referenced only from those,
+	// and so on.
+	DefsOrderFirstReference DefsOrder = "FirstReference"
+)
+
+// BundleSchema bundles the schema file entry in fsys into one self-contained
+// document. Rather than copying the target of each $ref in its place as
+// InlineBundledSchemasInFS does, every $ref to a $defs entry or to a whole
+// document, in entry or in any document it refers to, is rewritten to
+// "#/$defs/<name>", and the targets are collected into the top-level $defs
+// under those names. So each definition appears once however often it's used,
+// and recursive definitions need no special treatment. Options.DefNameFunc
+// names the collected entries. Other refs, such as "#/properties/id", are
+// inlined as usual. Refs within a schema that declares its own $id, such as
+// an entry carrying "$id": "address", resolve against that schema rather than
+// the file, so "#" within it is the entry itself. Keys are stripped as by
+// InlineBundledSchemasInFS, from the collected entries too, and $id always
+// is, flattening any such scopes. Options.BundleID and Options.BundleSchema
+// then set the top-level $id and $schema. A ref left pointing outside the
+// bundle, such as one InlineOnly doesn't match, is an error. With
+// Options.IndexPath, an index of the collected entries is written back to
+// fsys too.
+func BundleSchema(fsys fs.FS, entry string, options ...Option) ([]byte, error) {
+	opts := buildOptions(options)
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	in := newInliner(opts)
+	in.bundle = true
+	// Refs into $defs are rewritten against the root of the bundle, so no
+	// schema in it can keep an $id scoping them differently.
+	in.strip["$id"] = true
+
+	doc, err := in.loadPath(entry, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.checkExternalRefs([]*document{doc}); err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", entry, err)
+	}
+	resolved, err := in.resolveDocument(doc)
+	if err == nil {
+		err = checkSelfContained(resolved, opts.refKeyword(), opts.maxDepth())
+	}
+	if err == nil {
+		err = setBundleKeywords(resolved, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", entry, err)
+	}
+	index := in.bundleIndex(resolved)
+	switch opts.DefsOrder {
+	case "", DefsOrderName:
+	case DefsOrderFirstReference:
+		resolved = orderDefsByReference(resolved, opts)
+	default:
+		return nil, fmt.Errorf("unknown $defs order %q", opts.DefsOrder)
+	}
+	out, err := marshalSchema(resolved, opts)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s: %w", entry, err)
+	}
+	if opts.IndexPath != "" {
+		if err := writeIndex(fsys, index, opts); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// IndexEntry describes a $defs entry collected by BundleSchema, as listed in
+// the index written to Options.IndexPath. The index is a JSON array of
+// entries sorted by name.
+type IndexEntry struct {
+	// Name is the name of the entry in the bundle's $defs.
+	Name string `json:"name"`
+	// Source is the path of the document the entry was collected from.
+	Source string `json:"source"`
+	// Pointer is the JSON Pointer of the entry in Source, or "" if it's the
+	// whole document.
+	Pointer string `json:"pointer,omitempty"`
+	// Title and Description are those of the bundled entry, if any.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// bundleIndex returns an IndexEntry for each $defs entry collected into root,
+// sorted by name. Entries that were removed while inlining aren't listed.
+func (in *inliner) bundleIndex(root any) []IndexEntry {
+	m, _ := root.(map[string]any)
+	defs, _ := m["$defs"].(map[string]any)
+	var index []IndexEntry
+	for _, d := range in.bundled {
+		def, ok := defs[d.name]
+		if !ok {
+			continue
+		}
+		e := IndexEntry{Name: d.name, Source: d.target.doc.path, Pointer: d.target.frag}
+		if obj, ok := def.(map[string]any); ok {
+			e.Title, _ = obj["title"].(string)
+			e.Description, _ = obj["description"].(string)
+		}
+		index = append(index, e)
+	}
+	slices.SortFunc(index, func(a, b IndexEntry) int { return strings.Compare(a.Name, b.Name) })
+	return index
+}
+
+// writeIndex writes index to Options.IndexPath in fsys. It's a no-op if fsys
+// isn't writable.
+func writeIndex(fsys fs.FS, index []IndexEntry, opts Options) error {
+	writer, ok := fsys.(interface {
+		WriteFile(name string, data []byte, perm fs.FileMode) error
+	})
+	if !ok {
+		return nil
+	}
+	if index == nil {
+		index = []IndexEntry{}
+	}
+	b, err := marshalIndentJSON(index, opts.indent())
+	if err == nil {
+		b, err = withLineEnding(append(b, '\n'), opts.LineEnding)
+	}
+	if err != nil {
+		return fmt.Errorf("marshal index %s: %w", opts.IndexPath, err)
+	}
+	if err := writer.WriteFile(opts.IndexPath, b, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", opts.IndexPath, err)
+	}
+	opts.logger().Debug("Wrote file", "path", opts.IndexPath)
+	return nil
+}
+
+// checkSelfContained returns an error listing the refs by refKeyword left in
+// root that point outside of it, such as ones left in place by InlineOnly.
+func checkSelfContained(root any, refKeyword string, max int) error {
+	var left []string
+	err := walkSchemas(root, "", max, func(m map[string]any, ptr string) {
+		if ref, ok := m[refKeyword].(string); ok && !strings.HasPrefix(ref, "#") {
+			left = append(left, fmt.Sprintf("%q at %q", ref, "#"+ptr))
+		}
+	})
+	if err != nil || len(left) == 0 {
+		return err
+	}
+	slices.Sort(left)
+	return fmt.Errorf("not self-contained, external $refs remain: %s", strings.Join(left, ", "))
+}
+
+// setBundleKeywords sets the top-level $id and $schema of root to BundleID
+// and BundleSchema, if they're set.
+func setBundleKeywords(root any, opts Options) error {
+	if opts.BundleID == "" && opts.BundleSchema == "" {
+		return nil
+	}
+	m, ok := root.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot set the $id or $schema of a document of type %T", root)
+	}
+	if opts.BundleID != "" {
+		m["$id"] = opts.BundleID
+	}
+	if opts.BundleSchema != "" {
+		m["$schema"] = opts.BundleSchema
+	}
+	return nil
+}
+
+// bundledDef is a $defs entry collected by bundling.
+type bundledDef struct {
+	name   string
+	target refTarget
+}
+
+// bundles reports whether a ref to target is rewritten to a collected $defs
+// entry in bundle mode: it points at a $defs entry, or at the root of another
+// document.
+func (in *inliner) bundles(target refTarget) bool {
+	if !in.bundle {
+		return false
+	}
+	if name, ok := defName(target.frag); ok {
+		return target.frag == "/$defs/"+escapeToken(name)
+	}
+	return target.frag == "" && target.doc != in.host
+}
+
+// bundleRef returns the ref that replaces a ref to target in bundle mode,
+// collecting target under its name the first time it's seen.
+func (in *inliner) bundleRef(target refTarget) (string, error) {
+	key := target.key()
+	name, ok := in.bundledNames[key]
+	if !ok {
+		origName, _ := defName(target.frag)
+		name = in.opts.defName(target.doc.path, origName)
+		if name == "" {
+			return "", fmt.Errorf("no $defs name for %s", key)
+		}
+		if other, ok := in.bundledKeys[name]; ok {
+			// Sorted, since which is seen first depends on map order.
+			return "", fmt.Errorf("%s and %s are both bundled as $defs entry %q", min(other, key), max(other, key), name)
+		}
+		in.bundledNames[key] = name
+		in.bundledKeys[name] = key
+		in.bundled = append(in.bundled, bundledDef{name: name, target: target})
+	}
+	return "#/$defs/" + escapeToken(name), nil
+}
+
+// restoreBundledDefs inlines the collected $defs entries and adds them to the
+// $defs of the cleaned-up root. Inlining an entry may collect more.
+func (in *inliner) restoreBundledDefs(root any) error {
+	if len(in.bundled) == 0 {
+		return nil
+	}
+	m, ok := root.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot bundle $defs into a document of type %T", root)
+	}
+	defs, _ := m["$defs"].(map[string]any)
+	if defs == nil {
+		defs = map[string]any{}
+	}
+	for i := 0; i < len(in.bundled); i++ {
+		d := in.bundled[i]
+		clone, err := deepClone(d.target.value)
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", d.target.key(), err)
+		}
+		// Start from the entry itself, so a cycle back to it through refs
+		// that are inlined is reported rather than followed.
+		resolved, err := in.inlineRefs(clone, d.target.doc, d.target.frag, []string{d.target.key()})
+		if err != nil {
+			return err
+		}
+		if isRemoved(resolved) {
+			continue
+		}
+		if defs[d.name], err = stripKeysRecursive(resolved, in.strip, in.opts, 2); err != nil {
+			return err
+		}
+	}
+	m["$defs"] = defs
+	return nil
+}
+
+// defaultDefName names the $defs entry bundled from the entry origName of the
+// document at sourcePath, or from the whole document if origName is empty. The
+// name is the path without its extension, with every character other than
+// ASCII letters, digits and "_" replaced by "_", followed by "_" and origName,
+// so "common/address.json" and "Street" make "common_address_Street".
+func defaultDefName(sourcePath, origName string) string {
+	p := strings.TrimSuffix(sourcePath, gzipExt)
+	p = strings.TrimSuffix(p, path.Ext(p))
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, p)
+	if origName != "" {
+		name += "_" + origName
+	}
+	return name
+}
+
+// orderDefsByReference returns root with its $defs ordered by
+// DefsOrderFirstReference. Refs are read in the order they're marshaled in,
+// which depends on KeywordOrder. Entries nothing refers to come last,
+// alphabetically. The $defs of each element of an array root are ordered on
+// their own.
+func orderDefsByReference(root any, opts Options) any {
+	if elems, ok := root.([]any); ok {
+		out := make([]any, len(elems))
+		for i, elem := range elems {
+			out[i] = orderDefsByReference(elem, opts)
+		}
+		return out
+	}
+	m, _ := root.(map[string]any)
+	defs, ok := m["$defs"].(map[string]any)
+	if !ok {
+		return root
+	}
+	var rank map[string]int
+	if len(opts.KeywordOrder) > 0 {
+		rank = keywordRank(opts.KeywordOrder)
+	}
+
+	var order []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if _, ok := defs[name]; ok && !seen[name] {
+			seen[name] = true
+			order = append(order, name)
+		}
+	}
+	top := maps.Clone(m)
+	delete(top, "$defs")
+	visitDefRefs(top, opts.refKeyword(), rank, add)
+	for i := 0; i < len(order); i++ {
+		visitDefRefs(defs[order[i]], opts.refKeyword(), rank, add)
+	}
+	for _, name := range slices.Sorted(maps.Keys(defs)) {
+		add(name)
+	}
+
+	out := maps.Clone(m)
+	out["$defs"] = orderedObject{keys: order, m: defs}
+	return out
+}
+
+// visitDefRefs calls fn with the name of the $defs entry each "#/$defs/..."
+// ref by refKeyword in node points into, in the order marshalSchema writes
+// them, given the keyword rank of KeywordOrder if any.
+func visitDefRefs(node any, refKeyword string, rank map[string]int, fn func(name string)) {
+	switch v := node.(type) {
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(v))
+		if rank != nil {
+			keys = rankedKeys(v, rank)
+		}
+		for _, k := range keys {
+			switch child := v[k]; {
+			case k == refKeyword:
+				ref, _ := child.(string)
+				if frag, ok := strings.CutPrefix(ref, "#"); ok {
+					if name, ok := defName(frag); ok {
+						fn(name)
+					}
+				}
+			case dataKeywords[k]:
+			case schemaMapKeywords[k]:
+				subs, _ := child.(map[string]any)
+				for _, name := range slices.Sorted(maps.Keys(subs)) {
+					visitDefRefs(subs[name], refKeyword, rank, fn)
+				}
+			default:
+				visitDefRefs(child, refKeyword, rank, fn)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			visitDefRefs(child, refKeyword, rank, fn)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package schema
+
+import (
+	"bytes"
+	"cmp"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BundleTestSuite struct {
+	suite.Suite
+}
+
+func (b *BundleTestSuite) TestBundleSchema() {
+	type test struct {
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	fsys := fstest.MapFS{
+		"user.json": {Data: []byte(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$id": "https://example.com/user.json",
+			"properties": {
+				"id": {"$ref": "#/properties/name"},
+				"name": {"type": "string"},
+				"home": {"$ref": "#/$defs/Address"},
+				"work": {"$ref": "#/$defs/Address", "description": "work"},
+				"friends": {"items": {"$ref": "#/$defs/User"}},
+				"country": {"$ref": "common/geo.json#/$defs/Country"},
+				"location": {"$ref": "common/geo.json"}
+			},
+			"$defs": {
+				"Address": {"$id": "address", "properties": {"country": {"$ref": "common/geo.json#/$defs/Country"}}},
+				"User": {"properties": {"friend": {"$ref": "#/$defs/User"}}},
+				"Unused": {}
+			}
+		}`)},
+		"common/geo.json": {Data: []byte(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"properties": {"lat": {"type": "number"}},
+			"$defs": {"Country": {"type": "string", "minLength": {"$ref": "#/$defs/Two/const"}}, "Two": {"const": 2}}
+		}`)},
+	}
+
+	tests := map[string]test{
+		"default names": {
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {
+					"id": {"type": "string"},
+					"name": {"type": "string"},
+					"home": {"$ref": "#/$defs/user_Address"},
+					"work": {"$ref": "#/$defs/user_Address", "description": "work"},
+					"friends": {"items": {"$ref": "#/$defs/user_User"}},
+					"country": {"$ref": "#/$defs/common_geo_Country"},
+					"location": {"$ref": "#/$defs/common_geo"}
+				},
+				"$defs": {
+					"user_Address": {"properties": {"country": {"$ref": "#/$defs/common_geo_Country"}}},
+					"user_User": {"properties": {"friend": {"$ref": "#/$defs/user_User"}}},
+					"common_geo_Country": {"type": "string", "minLength": 2},
+					"common_geo": {"properties": {"lat": {"type": "number"}}}
+				}
+			}`,
+		},
+		"custom names": {
+			Opts: Options{DefNameFunc: func(sourcePath, origName string) string {
+				if origName == "" {
+					origName = "Root"
+				}
+				return strings.ToUpper(sourcePath[:1]) + sourcePath[1:strings.Index(sourcePath, ".")] + "_" + origName
+			}},
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {
+					"id": {"type": "string"},
+					"name": {"type": "string"},
+					"home": {"$ref": "#/$defs/User_Address"},
+					"work": {"$ref": "#/$defs/User_Address", "description": "work"},
+					"friends": {"items": {"$ref": "#/$defs/User_User"}},
+					"country": {"$ref": "#/$defs/Common~1geo_Country"},
+					"location": {"$ref": "#/$defs/Common~1geo_Root"}
+				},
+				"$defs": {
+					"User_Address": {"properties": {"country": {"$ref": "#/$defs/Common~1geo_Country"}}},
+					"User_User": {"properties": {"friend": {"$ref": "#/$defs/User_User"}}},
+					"Common/geo_Country": {"type": "string", "minLength": 2},
+					"Common/geo_Root": {"properties": {"lat": {"type": "number"}}}
+				}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		b.Run(desc, func() {
+			out, err := BundleSchema(fsys, "user.json", v.Opts)
+			if v.ExpectedErr != "" {
+				b.EqualError(err, v.ExpectedErr)
+				return
+			}
+			b.Require().NoError(err)
+			b.JSONEq(v.Expected, string(out))
+		})
+	}
+}
+
+func (b *BundleTestSuite) TestBundleSchemaIDAndSchema() {
+	type test struct {
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"$id": "https://example.com/src/order.json",
+			"properties": {"customer": {"$ref": "customer.json"}, "id": {"$ref": "ids.json#/properties/id"}}
+		}`)},
+		"customer.json": {Data: []byte(`{"properties": {"id": {"$ref": "ids.json#/properties/id"}}}`)},
+		"ids.json":      {Data: []byte(`{"properties": {"id": {"type": "string"}}}`)},
+	}
+
+	tests := map[string]test{
+		"id and schema": {
+			Opts: Options{BundleID: "https://example.com/bundles/order.json", BundleSchema: "https://json-schema.org/draft/2020-12/schema"},
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"$id": "https://example.com/bundles/order.json",
+				"properties": {"customer": {"$ref": "#/$defs/customer"}, "id": {"type": "string"}},
+				"$defs": {"customer": {"properties": {"id": {"type": "string"}}}}
+			}`,
+		},
+		"defaults": {
+			Expected: `{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"properties": {"customer": {"$ref": "#/$defs/customer"}, "id": {"type": "string"}},
+				"$defs": {"customer": {"properties": {"id": {"type": "string"}}}}
+			}`,
+		},
+		"external ref left": {
+			Opts:        Options{InlineOnly: []string{"#"}},
+			ExpectedErr: `bundle order.json: not self-contained, external $refs remain: "ids.json#/properties/id" at "#/$defs/customer/properties/id", "ids.json#/properties/id" at "#/properties/id"`,
+		},
+	}
+
+	for desc, v := range tests {
+		b.Run(desc, func() {
+			out, err := BundleSchema(fsys, "order.json", v.Opts)
+			if v.ExpectedErr != "" {
+				b.EqualError(err, v.ExpectedErr)
+				return
+			}
+			b.Require().NoError(err)
+			b.JSONEq(v.Expected, string(out))
+		})
+	}
+
+	_, err := BundleSchema(fstest.MapFS{"a.json": {Data: []byte(`[{}]`)}}, "a.json", Options{BundleID: "https://example.com/a"})
+	b.EqualError(err, "bundle a.json: cannot set the $id or $schema of a document of type []interface {}")
+}
+
+func (b *BundleTestSuite) TestBundleSchemaDefsOrder() {
+	type test struct {
+		Opts     Options
+		Expected []string
+	}
+
+	fsys := fstest.MapFS{"order.json": {Data: []byte(`{
+		"properties": {
+			"b": {"$ref": "#/$defs/Zip"},
+			"a": {"items": {"$ref": "#/$defs/Line"}}
+		},
+		"$defs": {
+			"Line": {"properties": {"sku": {"$ref": "#/$defs/Sku"}}, "not": {"$ref": "#/$defs/Amount"}},
+			"Zip": {"type": "string"},
+			"Sku": {"type": "string"},
+			"Amount": {"type": "number"}
+		}
+	}`)}}
+
+	tests := map[string]test{
+		"name": {
+			Expected: []string{"Amount", "Line", "Sku", "Zip"},
+		},
+		"first reference": {
+			Opts:     Options{DefsOrder: DefsOrderFirstReference},
+			Expected: []string{"Line", "Zip", "Amount", "Sku"},
+		},
+		"first reference in keyword order": {
+			Opts:     Options{DefsOrder: DefsOrderFirstReference, KeywordOrder: []string{"properties", "not"}},
+			Expected: []string{"Line", "Zip", "Sku", "Amount"},
+		},
+	}
+
+	for desc, v := range tests {
+		b.Run(desc, func() {
+			opts := v.Opts
+			opts.DefNameFunc = func(_, origName string) string { return origName }
+			out, err := BundleSchema(fsys, "order.json", opts)
+			b.Require().NoError(err)
+
+			// Each entry is declared as `"Name": {`, which no ref looks like.
+			names := []string{"Amount", "Line", "Sku", "Zip"}
+			slices.SortFunc(names, func(x, y string) int {
+				return cmp.Compare(bytes.Index(out, []byte(`"`+x+`": {`)), bytes.Index(out, []byte(`"`+y+`": {`)))
+			})
+			b.Equal(v.Expected, names)
+		})
+	}
+
+	_, err := BundleSchema(fsys, "order.json", Options{DefsOrder: "Random"})
+	b.EqualError(err, `unknown $defs order "Random"`)
+}
+
+func (b *BundleTestSuite) TestBundleSchemaIndex() {
+	fsys := writableFS{fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"customer": {"$ref": "customer.json"},
+				"lines": {"items": {"$ref": "#/$defs/Line"}},
+				"note": {"$ref": "#/$defs/Note"}
+			},
+			"$defs": {
+				"Line": {"title": "Line", "description": "An order line.", "properties": {"sku": {"type": "string"}}},
+				"Note": {"$ref": "#/$defs/Text"},
+				"Text": {"type": "string"}
+			}
+		}`)},
+		"customer.json": {Data: []byte(`{"title": "Customer", "properties": {"name": {"type": "string"}}}`)},
+	}}
+
+	_, err := BundleSchema(fsys, "order.json", Options{IndexPath: "index.json"})
+	b.Require().NoError(err)
+	b.JSONEq(`[
+		{"name": "customer", "source": "customer.json", "title": "Customer"},
+		{"name": "order_Line", "source": "order.json", "pointer": "/$defs/Line", "title": "Line", "description": "An order line."},
+		{"name": "order_Note", "source": "order.json", "pointer": "/$defs/Note"},
+		{"name": "order_Text", "source": "order.json", "pointer": "/$defs/Text"}
+	]`, string(fsys.MapFS["index.json"].Data))
+
+	// A read-only fsys is only read.
+	_, err = BundleSchema(fsys.MapFS, "order.json", Options{IndexPath: "other.json"})
+	b.Require().NoError(err)
+	b.NotContains(fsys.MapFS, "other.json")
+}
+
+func (b *BundleTestSuite) TestBundleSchemaNestedIDScope() {
+	fsys := fstest.MapFS{
+		"entry.json": {Data: []byte(`{
+			"$id": "https://example.com/entry.json",
+			"properties": {"tree": {"$ref": "tree.json"}, "leaf": {"$ref": "tree.json#/$defs/Leaf"}}
+		}`)},
+		"tree.json": {Data: []byte(`{
+			"$id": "https://example.com/tree.json",
+			"properties": {"children": {"items": {"$ref": "#"}}, "leaf": {"$ref": "#/$defs/Leaf"}},
+			"$defs": {
+				"Leaf": {
+					"$id": "leaf",
+					"properties": {"self": {"$ref": "#"}, "name": {"$ref": "#/$defs/Name"}, "tag": {"$ref": "tag.json"}},
+					"$defs": {"Name": {"type": "string"}}
+				}
+			}
+		}`)},
+		"tag.json": {Data: []byte(`{"$id": "https://example.com/tag.json", "type": "null"}`)},
+	}
+
+	for _, opts := range []Options{{}, {PreserveRecursiveRefs: true}, {StripKeys: []string{"$schema"}}} {
+		out, err := BundleSchema(fsys, "entry.json", opts)
+		b.Require().NoError(err)
+		b.JSONEq(`{
+			"properties": {"tree": {"$ref": "#/$defs/tree"}, "leaf": {"$ref": "#/$defs/tree_Leaf"}},
+			"$defs": {
+				"tree": {
+					"properties": {"children": {"items": {"$ref": "#/$defs/tree"}}, "leaf": {"$ref": "#/$defs/tree_Leaf"}}
+				},
+				"tree_Leaf": {
+					"properties": {"self": {"$ref": "#/$defs/tree_Leaf"}, "name": {"type": "string"}, "tag": {"$ref": "#/$defs/tag"}}
+				},
+				"tag": {"type": "null"}
+			}
+		}`, string(out))
+	}
+}
+
+func (b *BundleTestSuite) TestBundleSchemaNameCollision() {
+	fsys := fstest.MapFS{
+		"user.json":   {Data: []byte(`{"items": {"$ref": "common.json#/$defs/A"}, "not": {"$ref": "#/$defs/A"}, "$defs": {"A": {}}}`)},
+		"common.json": {Data: []byte(`{"$defs": {"A": {}}}`)},
+	}
+
+	_, err := BundleSchema(fsys, "user.json", WithDefNameFunc(func(_, origName string) string { return origName }))
+	b.EqualError(err, `bundle user.json: common.json#/$defs/A and user.json#/$defs/A are both bundled as $defs entry "A"`)
+}
+
+func (b *BundleTestSuite) TestBundleSchemaNoName() {
+	fsys := fstest.MapFS{"user.json": {Data: []byte(`{"items": {"$ref": "#/$defs/A"}, "$defs": {"A": {}}}`)}}
+
+	_, err := BundleSchema(fsys, "user.json", WithDefNameFunc(func(string, string) string { return "" }))
+	b.EqualError(err, "bundle user.json: no $defs name for user.json#/$defs/A")
+}
+
+func (b *BundleTestSuite) TestBundleSchemaMissingEntry() {
+	_, err := BundleSchema(fstest.MapFS{}, "user.json", Options{})
+	b.EqualError(err, "read user.json: open user.json: file does not exist")
+}
+
+func (b *BundleTestSuite) TestDefaultDefName() {
+	type test struct {
+		Path     string
+		Name     string
+		Expected string
+	}
+
+	tests := map[string]test{
+		"def":             {Path: "common/address.json", Name: "Street", Expected: "common_address_Street"},
+		"document":        {Path: "common/address.json", Expected: "common_address"},
+		"gzipped":         {Path: "address.json.gz", Name: "Street", Expected: "address_Street"},
+		"punctuation":     {Path: "v1.2/my-types.json", Name: "A", Expected: "v1_2_my_types_A"},
+		"name kept as is": {Path: "a.json", Name: "my-def", Expected: "a_my-def"},
+	}
+
+	for desc, v := range tests {
+		b.Run(desc, func() {
+			b.Equal(v.Expected, defaultDefName(v.Path, v.Name))
+		})
+	}
+}
+
+// writableFS is a fstest.MapFS that files can be written back to.
+type writableFS struct {
+	fstest.MapFS
+}
+
+func (w writableFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	w.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func TestBundleTestSuite(t *testing.T) {
+	suite.Run(t, new(BundleTestSuite))
+}
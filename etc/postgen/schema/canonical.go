@@ -0,0 +1,23 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// canonicalJSON encodes v with sorted object keys and no insignificant
+// whitespace, so equal trees always encode to the same bytes.
+func canonicalJSON(v any) []byte {
+	// encoding/json sorts map keys, which with numbers compared by value is
+	// all the canonicalization the decoded trees need.
+	b, _ := json.Marshal(numbersAsFloats(v))
+	return b
+}
+
+// canonicalHash returns a hex digest identifying the value of v, regardless of
+// key order or formatting in its source.
+func canonicalHash(v any) string {
+	sum := sha256.Sum256(canonicalJSON(v))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind string
+
+const (
+	// ChangeAdded is a value only the new tree has.
+	ChangeAdded ChangeKind = "Added"
+	// ChangeRemoved is a value only the old tree has.
+	ChangeRemoved ChangeKind = "Removed"
+	// ChangeModified is a value both trees have, but that differs.
+	ChangeModified ChangeKind = "Modified"
+)
+
+// Change is a difference between two schema trees found by SchemaDiff.
+type Change struct {
+	Kind ChangeKind
+	// Pointer is the JSON Pointer of the value, "" for the root.
+	Pointer string
+	// Old is the value in the old tree, nil if it was added.
+	Old any
+	// New is the value in the new tree, nil if it was removed.
+	New any
+}
+
+// SchemaDiff compares two schema documents and returns how new differs from
+// old, ignoring key order, formatting and how numbers are written. Objects are
+// compared key by key, so a keyword or $defs entry that's added, removed or
+// changed is reported at its own pointer. Arrays of the same length are
+// compared item by item; otherwise the whole array is modified. Changes are
+// ordered by pointer, with keys in alphabetical order.
+func SchemaDiff(old, new []byte) ([]Change, error) {
+	a, err := parseJSON(old)
+	if err != nil {
+		return nil, fmt.Errorf("parse old: %w", err)
+	}
+	b, err := parseJSON(new)
+	if err != nil {
+		return nil, fmt.Errorf("parse new: %w", err)
+	}
+	var changes []Change
+	diffNodes(a, b, "", &changes)
+	return changes, nil
+}
+
+// diffNodes appends the changes from a to b, at ptr, to changes.
+func diffNodes(a, b any, ptr string, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := slices.Collect(maps.Keys(av))
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			childPtr := ptr + "/" + escapeToken(k)
+			ac, inA := av[k]
+			bc, inB := bv[k]
+			switch {
+			case !inA:
+				*changes = append(*changes, Change{Kind: ChangeAdded, Pointer: childPtr, New: bc})
+			case !inB:
+				*changes = append(*changes, Change{Kind: ChangeRemoved, Pointer: childPtr, Old: ac})
+			default:
+				diffNodes(ac, bc, childPtr, changes)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			break
+		}
+		for i := range av {
+			diffNodes(av[i], bv[i], fmt.Sprintf("%s/%d", ptr, i), changes)
+		}
+		return
+	}
+	if !bytes.Equal(canonicalJSON(a), canonicalJSON(b)) {
+		*changes = append(*changes, Change{Kind: ChangeModified, Pointer: ptr, Old: a, New: b})
+	}
+}
@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompareTestSuite struct {
+	suite.Suite
+}
+
+func (c *CompareTestSuite) TestSchemaDiff() {
+	type test struct {
+		Old         string
+		New         string
+		Expected    []Change
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"same but formatted differently": {
+			Old: `{"type": "object", "properties": {"a": {"maximum": 1.0}}, "required": ["a"]}`,
+			New: `{
+				"required": ["a"],
+				"properties": {"a": {"maximum": 1}},
+				"type": "object"
+			}`,
+		},
+		"keywords and defs": {
+			Old: `{
+				"properties": {"a": {"type": "string", "maxLength": 3}},
+				"$defs": {"Old": {"type": "null"}, "Kept": {"enum": [1, 2]}}
+			}`,
+			New: `{
+				"properties": {"a": {"type": "integer", "minimum": 0}, "b/c": {}},
+				"$defs": {"New": {"type": "null"}, "Kept": {"enum": [1, 3]}}
+			}`,
+			Expected: []Change{
+				{Kind: ChangeModified, Pointer: "/$defs/Kept/enum/1", Old: json.Number("2"), New: json.Number("3")},
+				{Kind: ChangeAdded, Pointer: "/$defs/New", New: map[string]any{"type": "null"}},
+				{Kind: ChangeRemoved, Pointer: "/$defs/Old", Old: map[string]any{"type": "null"}},
+				{Kind: ChangeRemoved, Pointer: "/properties/a/maxLength", Old: json.Number("3")},
+				{Kind: ChangeAdded, Pointer: "/properties/a/minimum", New: json.Number("0")},
+				{Kind: ChangeModified, Pointer: "/properties/a/type", Old: "string", New: "integer"},
+				{Kind: ChangeAdded, Pointer: "/properties/b~1c", New: map[string]any{}},
+			},
+		},
+		"array length": {
+			Old: `{"required": ["a"]}`,
+			New: `{"required": ["a", "b"]}`,
+			Expected: []Change{
+				{Kind: ChangeModified, Pointer: "/required", Old: []any{"a"}, New: []any{"a", "b"}},
+			},
+		},
+		"type of value": {
+			Old: `{"items": {"type": "string"}}`,
+			New: `{"items": false}`,
+			Expected: []Change{
+				{Kind: ChangeModified, Pointer: "/items", Old: map[string]any{"type": "string"}, New: false},
+			},
+		},
+		"root": {
+			Old: `true`,
+			New: `{}`,
+			Expected: []Change{
+				{Kind: ChangeModified, Pointer: "", Old: true, New: map[string]any{}},
+			},
+		},
+		"invalid old": {
+			Old:         `{`,
+			New:         `{}`,
+			ExpectedErr: "parse old: unexpected end of JSON input",
+		},
+		"invalid new": {
+			Old:         `{}`,
+			New:         `[}`,
+			ExpectedErr: "parse new: invalid character '}' looking for beginning of value",
+		},
+	}
+
+	for desc, v := range tests {
+		c.Run(desc, func() {
+			changes, err := SchemaDiff([]byte(v.Old), []byte(v.New))
+			if v.ExpectedErr != "" {
+				c.EqualError(err, v.ExpectedErr)
+				return
+			}
+			c.Require().NoError(err)
+			c.Equal(v.Expected, changes)
+		})
+	}
+}
+
+func TestCompareTestSuite(t *testing.T) {
+	suite.Run(t, new(CompareTestSuite))
+}
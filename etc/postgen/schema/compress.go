@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// gzipExt is the extension of gzip-compressed schema files. They're
+// decompressed when read and compressed again when written back, so the rest
+// of the pipeline only ever sees JSON.
+const gzipExt = ".gz"
+
+// isGzip reports whether the file at p is gzip-compressed, judging by its name.
+func isGzip(p string) bool {
+	return strings.HasSuffix(strings.ToLower(p), gzipExt)
+}
+
+// readSchemaFile reads the schema file at p in fsys, decompressing it if it's
+// gzipped.
+func readSchemaFile(fsys fs.FS, p string) ([]byte, error) {
+	b, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSchemaFile(p, b)
+}
+
+// readSchemaFileLimit is readSchemaFile, but stops reading, and decompressing,
+// after max+1 bytes, so callers can reject oversized files by length without
+// holding all of them in memory. A max of zero or less means no limit.
+func readSchemaFileLimit(fsys fs.FS, p string, max int) ([]byte, error) {
+	if max <= 0 {
+		return readSchemaFile(fsys, p)
+	}
+	f, err := fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if isGzip(p) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return io.ReadAll(io.LimitReader(r, int64(max)+1))
+}
+
+// decodeSchemaFile returns the JSON in b, the contents of the file at p,
+// decompressing it if it's gzipped.
+func decodeSchemaFile(p string, b []byte) ([]byte, error) {
+	if !isGzip(p) {
+		return b, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// encodeSchemaFile returns b, the JSON for the file at p, compressed in the
+// format the file's name calls for.
+func encodeSchemaFile(p string, b []byte) ([]byte, error) {
+	if !isGzip(p) {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressTestSuite struct {
+	suite.Suite
+}
+
+func (c *CompressTestSuite) TestInlineBundledSchemasInFSGzip() {
+	fsys := fstest.MapFS{
+		"order.json.gz": {Data: c.gzip(`{"properties": {"id": {"$ref": "common/id.json.gz"}, "note": {"$ref": "note.json"}}}`)},
+		"note.json":     {Data: []byte(`{"properties": {"id": {"$ref": "common/id.json.gz#/$defs/ID"}}}`)},
+		"common/id.json.gz": {Data: c.gzip(`{
+			"type": "string",
+			"$defs": {"ID": {"type": "string", "format": "uuid"}}
+		}`)},
+		"readme.gz": {Data: []byte("not a schema")},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{})
+	c.Require().NoError(err)
+	c.Len(updates, 3)
+
+	c.JSONEq(`{"properties": {"id": {"type": "string"}, "note": {"properties": {"id": {"type": "string", "format": "uuid"}}}}}`, c.gunzip(updates["order.json.gz"]))
+	c.JSONEq(`{"properties": {"id": {"type": "string", "format": "uuid"}}}`, string(updates["note.json"]))
+	c.JSONEq(`{"type": "string"}`, c.gunzip(updates["common/id.json.gz"]))
+}
+
+func (c *CompressTestSuite) TestInlineBundledSchemasInFSBadGzip() {
+	fsys := fstest.MapFS{"schema.json.gz": {Data: []byte(`{"type": "string"}`)}}
+
+	_, err := InlineBundledSchemasInFS(fsys, Options{})
+	c.EqualError(err, "read schema.json.gz: gzip: invalid header")
+}
+
+func (c *CompressTestSuite) gzip(s string) []byte {
+	return gzipped(c.T(), s)
+}
+
+func (c *CompressTestSuite) gunzip(b []byte) string {
+	return gunzipped(c.T(), b)
+}
+
+// gzipped returns s compressed with gzip.
+func gzipped(t *testing.T, s string) []byte {
+	b, err := encodeSchemaFile("x.gz", []byte(s))
+	require.NoError(t, err)
+	return b
+}
+
+// gunzipped returns b decompressed with gzip.
+func gunzipped(t *testing.T, b []byte) string {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	out, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestCompressTestSuite(t *testing.T) {
+	suite.Run(t, new(CompressTestSuite))
+}
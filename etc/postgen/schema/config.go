@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileNames are the names LoadConfig looks for, in order of preference.
+var ConfigFileNames = []string{"schemagen.yaml", "schemagen.yml", "schemagen.json"}
+
+// LoadConfig reads the first of ConfigFileNames found in the root of fsys into
+// opts with DecodeConfig, and returns its name, or "" if there's none.
+func LoadConfig(fsys fs.FS, opts *Options) (string, error) {
+	for _, name := range ConfigFileNames {
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = DecodeConfig(b, opts)
+		}
+		if err != nil {
+			return name, fmt.Errorf("read config %s: %w", name, err)
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// DecodeConfig sets the options that the config file b sets in opts, leaving
+// the others as they are, so whatever opts held before acts as a default the
+// file overrides, and later changes to opts, such as from command-line flags,
+// override the file in turn. b is a YAML or JSON object whose keys are the
+// names of Options fields, matched without regard to case, such as "indent",
+// "stripKeys" or "Concurrency". Unknown keys are an error, as are fields that
+// can't be written as data, such as FS or Logger.
+func DecodeConfig(b []byte, opts *Options) error {
+	// YAML is converted to JSON, so keys match fields the same way in both.
+	if !json.Valid(b) {
+		var m map[string]any
+		if err := yaml.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		if m == nil {
+			return nil
+		}
+		var err error
+		if b, err = json.Marshal(m); err != nil {
+			return err
+		}
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	for k := range keys {
+		if f, ok := reflect.TypeFor[Options]().FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, k) }); ok && !isDataType(f.Type) {
+			return fmt.Errorf("%s can't be set in a config file", f.Name)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(opts)
+}
+
+// isDataType reports whether values of t can be written in a config file.
+func isDataType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Interface, reflect.Pointer, reflect.Chan:
+		return false
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return isDataType(t.Elem())
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigTestSuite struct {
+	suite.Suite
+}
+
+func (c *ConfigTestSuite) TestDecodeConfig() {
+	type test struct {
+		Given       string
+		Expected    Options
+		ExpectedErr string
+	}
+
+	// Defaults, as set by flags before the config is read.
+	defaults := Options{Concurrency: 1, InlineMarker: "x-inline", MaxDepth: DefaultMaxDepth}
+
+	tests := map[string]test{
+		"yaml": {
+			Given: `
+indent: "\t"
+stripKeys: [$id, $schema, $comment]
+concurrency: 4
+keywordOrder:
+  - $schema
+  - type
+lineEnding: CRLF
+onMissingRef: Warn
+KeepDefs: true
+include: ["*.json"]
+exclude: [fixtures, "*.draft.json"]
+`,
+			Expected: Options{
+				Indent:       "\t",
+				StripKeys:    []string{"$id", "$schema", "$comment"},
+				Concurrency:  4,
+				KeywordOrder: []string{"$schema", "type"},
+				LineEnding:   LineEndingCRLF,
+				OnMissingRef: MissingRefWarn,
+				KeepDefs:     true,
+				Include:      []string{"*.json"},
+				Exclude:      []string{"fixtures", "*.draft.json"},
+				InlineMarker: "x-inline",
+				MaxDepth:     DefaultMaxDepth,
+			},
+		},
+		"json": {
+			Given: `{
+	"indent": "    ",
+	"inlineMarker": "x-keep",
+	"maxDepth": 50
+}`,
+			Expected: Options{Indent: "    ", Concurrency: 1, InlineMarker: "x-keep", MaxDepth: 50},
+		},
+		"empty": {
+			Given:    ``,
+			Expected: defaults,
+		},
+		"unknown key": {
+			Given:       `indentation: "  "`,
+			ExpectedErr: `json: unknown field "indentation"`,
+		},
+		"wrong type": {
+			Given:       `concurrency: lots`,
+			ExpectedErr: "json: cannot unmarshal string into Go struct field Options.concurrency of type int",
+		},
+		"not data": {
+			Given:       `{"logger": {}}`,
+			ExpectedErr: "Logger can't be set in a config file",
+		},
+		"not an object": {
+			Given:       `- indent`,
+			ExpectedErr: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into map[string]interface {}",
+		},
+	}
+
+	for desc, v := range tests {
+		c.Run(desc, func() {
+			opts := defaults
+			err := DecodeConfig([]byte(v.Given), &opts)
+			if v.ExpectedErr != "" {
+				c.ErrorContains(err, v.ExpectedErr)
+				return
+			}
+			c.Require().NoError(err)
+			c.Equal(v.Expected, opts)
+		})
+	}
+}
+
+func (c *ConfigTestSuite) TestLoadConfig() {
+	var opts Options
+	name, err := LoadConfig(fstest.MapFS{}, &opts)
+	c.Require().NoError(err)
+	c.Empty(name)
+
+	fsys := fstest.MapFS{
+		"schemagen.json": {Data: []byte(`{"indent": "\t"}`)},
+		"schemagen.yaml": {Data: []byte(`indent: "   "`)},
+	}
+	name, err = LoadConfig(fsys, &opts)
+	c.Require().NoError(err)
+	c.Equal("schemagen.yaml", name)
+	c.Equal("   ", opts.Indent)
+
+	delete(fsys, "schemagen.yaml")
+	name, err = LoadConfig(fsys, &opts)
+	c.Require().NoError(err)
+	c.Equal("schemagen.json", name)
+	c.Equal("\t", opts.Indent)
+
+	fsys["schemagen.json"] = &fstest.MapFile{Data: []byte(`{"jobs": 2}`)}
+	_, err = LoadConfig(fsys, &opts)
+	c.EqualError(err, `read config schemagen.json: json: unknown field "jobs"`)
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
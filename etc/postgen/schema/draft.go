@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Draft is a JSON Schema dialect, identified by its meta-schema URI.
+type Draft string
+
+const (
+	Draft07     Draft = "http://json-schema.org/draft-07/schema#"
+	Draft202012 Draft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// upgradeDocument rewrites a draft-07 style document to target, which must be
+// Draft202012:
+// - "definitions" becomes "$defs", and refs into it are rewritten
+// - "id" becomes "$id"
+// - "dependencies" splits into "dependentRequired" and "dependentSchemas"
+// - array "items" becomes "prefixItems", and "additionalItems" becomes "items"
+// - the top-level "$schema" is set to target
+//
+// Documents that already declare target are returned untouched. Only
+// documents declaring draft-07, or no $schema, are upgraded; other drafts,
+// such as draft-04 with its boolean "exclusiveMinimum", are an error. A
+// trailing empty fragment in $schema is ignored.
+func upgradeDocument(root any, target Draft) (any, error) {
+	if target != Draft202012 {
+		return nil, fmt.Errorf("unsupported target draft %q", target)
+	}
+	m, ok := root.(map[string]any)
+	if !ok {
+		return root, nil
+	}
+	if s, ok := m["$schema"]; ok {
+		draft, _ := s.(string)
+		switch strings.TrimSuffix(draft, "#") {
+		case strings.TrimSuffix(string(target), "#"):
+			return root, nil
+		case strings.TrimSuffix(string(Draft07), "#"):
+		default:
+			return nil, fmt.Errorf("can't upgrade a document declaring $schema %#v to %q, only draft-07 documents", s, target)
+		}
+	}
+
+	out := upgradeSchema(m).(map[string]any)
+	out["$schema"] = string(target)
+	return out, nil
+}
+
+func upgradeSchema(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			switch {
+			case k == "definitions":
+				// Merged into $defs below.
+				continue
+			case k == "dependencies":
+				deps, ok := child.(map[string]any)
+				if !ok {
+					out[k] = child
+					continue
+				}
+				for name, dep := range deps {
+					kw := "dependentSchemas"
+					if _, ok := dep.([]any); ok {
+						kw = "dependentRequired"
+					} else {
+						dep = upgradeSchema(dep)
+					}
+					group, _ := out[kw].(map[string]any)
+					if group == nil {
+						group = map[string]any{}
+						out[kw] = group
+					}
+					group[name] = dep
+				}
+			case k == "id":
+				if _, ok := v["$id"]; !ok {
+					if id, ok := child.(string); ok {
+						out["$id"] = id
+						continue
+					}
+				}
+				out[k] = child
+			case k == "items":
+				if items, ok := child.([]any); ok {
+					out["prefixItems"] = upgradeSchema(items)
+					continue
+				}
+				out[k] = upgradeSchema(child)
+			case k == "additionalItems":
+				// Only meaningful alongside an array "items", which is now
+				// "prefixItems".
+				if _, ok := v["items"].([]any); ok {
+					out["items"] = upgradeSchema(child)
+				}
+			case k == "$ref":
+				if ref, ok := child.(string); ok {
+					out[k] = upgradeRef(ref)
+					continue
+				}
+				out[k] = child
+			case schemaMapKeywords[k]:
+				out[k] = upgradeSchemaMap(child)
+			case dataKeywords[k]:
+				out[k] = child
+			default:
+				out[k] = upgradeSchema(child)
+			}
+		}
+		if defs, ok := v["definitions"]; ok {
+			merged := upgradeSchemaMap(defs)
+			// Entries already under $defs win.
+			if existing, ok := out["$defs"].(map[string]any); ok {
+				for name, def := range existing {
+					merged[name] = def
+				}
+			}
+			out["$defs"] = merged
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i := range v {
+			out[i] = upgradeSchema(v[i])
+		}
+		return out
+	default:
+		return node
+	}
+}
+
+// upgradeSchemaMap upgrades each schema in a name -> schema object.
+func upgradeSchemaMap(node any) map[string]any {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for name, child := range m {
+		out[name] = upgradeSchema(child)
+	}
+	return out
+}
+
+// upgradeRef rewrites "definitions" keyword tokens in the pointer of ref to
+// "$defs", leaving property names that happen to be "definitions" alone, and
+// "items/<index>" to "prefixItems/<index>".
+func upgradeRef(ref string) string {
+	addr, frag, ok := strings.Cut(ref, "#")
+	if !ok || !strings.HasPrefix(frag, "/") {
+		return ref
+	}
+	tokens := strings.Split(frag[1:], "/")
+	isName := false
+	for i, tok := range tokens {
+		if isName {
+			isName = false
+			continue
+		}
+		switch {
+		case tok == "definitions":
+			tokens[i] = "$defs"
+		case tok == "items" && i+1 < len(tokens) && isIndex(tokens[i+1]):
+			tokens[i] = "prefixItems"
+		}
+		isName = schemaMapKeywords[tok]
+	}
+	return addr + "#/" + strings.Join(tokens, "/")
+}
+
+func isIndex(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	for _, r := range tok {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DraftTestSuite struct {
+	suite.Suite
+}
+
+func (d *DraftTestSuite) TestInlineSchemaBytesTargetDraft() {
+	type test struct {
+		Given    string
+		Expected string
+	}
+
+	tests := map[string]test{
+		"draft-07": {
+			Given: `{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"id": "https://example.com/user",
+				"properties": {
+					"id": {"type": "string"},
+					"address": {"$ref": "#/definitions/Address"},
+					"definitions": {"type": "number"},
+					"d": {"$ref": "#/properties/definitions"},
+					"tuple": {"items": [{"type": "string"}], "additionalItems": false}
+				},
+				"dependencies": {
+					"a": ["b"],
+					"c": {"required": ["d"]}
+				},
+				"definitions": {
+					"Address": {"properties": {"zip": {"$ref": "#/definitions/Zip"}}},
+					"Zip": {"type": "string", "enum": [{"id": 1}]}
+				}
+			}`,
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {
+					"id": {"type": "string"},
+					"address": {"properties": {"zip": {"type": "string", "enum": [{"id": 1}]}}},
+					"definitions": {"type": "number"},
+					"d": {"type": "number"},
+					"tuple": {"prefixItems": [{"type": "string"}], "items": false}
+				},
+				"dependentRequired": {"a": ["b"]},
+				"dependentSchemas": {"c": {"required": ["d"]}}
+			}`,
+		},
+		"already 2020-12": {
+			Given: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {"a": {"$ref": "#/$defs/A"}, "items": {"id": "x"}},
+				"$defs": {"A": {"type": "string"}}
+			}`,
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {"a": {"type": "string"}, "items": {"id": "x"}}
+			}`,
+		},
+		"pattern properties": {
+			Given: `{
+				"patternProperties": {
+					"^definitions/[a-z]+$": {"$ref": "#/definitions/A"},
+					"^items$": {"items": [{"type": "string"}]}
+				},
+				"properties": {"p": {"$ref": "#/patternProperties/^definitions~1[a-z]+$"}},
+				"definitions": {"A": {"type": "integer"}}
+			}`,
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"patternProperties": {
+					"^definitions/[a-z]+$": {"type": "integer"},
+					"^items$": {"prefixItems": [{"type": "string"}]}
+				},
+				"properties": {"p": {"type": "integer"}}
+			}`,
+		},
+		"2020-12 with an empty fragment": {
+			Given:    `{"$schema": "https://json-schema.org/draft/2020-12/schema#", "items": [{"type": "string"}]}`,
+			Expected: `{"$schema": "https://json-schema.org/draft/2020-12/schema#", "items": [{"type": "string"}]}`,
+		},
+		"draft-07 without an empty fragment": {
+			Given:    `{"$schema": "http://json-schema.org/draft-07/schema", "items": [{"type": "string"}]}`,
+			Expected: `{"$schema": "https://json-schema.org/draft/2020-12/schema", "prefixItems": [{"type": "string"}]}`,
+		},
+		"no $schema": {
+			Given: `{"properties": {"a": {"$ref": "#/definitions/A"}}, "definitions": {"A": {"type": "string"}}}`,
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {"a": {"type": "string"}}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		d.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), Options{TargetDraft: Draft202012})
+			if !d.NoError(err) {
+				return
+			}
+			d.JSONEq(v.Expected, string(out))
+		})
+	}
+}
+
+func (d *DraftTestSuite) TestInlineSchemaBytesTargetDraftUnsupportedSource() {
+	tests := map[string]string{
+		"draft-04": `{"$schema": "http://json-schema.org/draft-04/schema#", "exclusiveMinimum": true, "minimum": 0}`,
+		"2019-09":  `{"$schema": "https://json-schema.org/draft/2019-09/schema"}`,
+		"unknown":  `{"$schema": 1}`,
+	}
+
+	for desc, given := range tests {
+		d.Run(desc, func() {
+			_, err := InlineSchemaBytes([]byte(given), Options{TargetDraft: Draft202012})
+			d.ErrorContains(err, "only draft-07 documents")
+		})
+	}
+
+	_, err := InlineSchemaBytes([]byte(tests["draft-04"]), Options{TargetDraft: Draft202012})
+	d.EqualError(err, `can't upgrade a document declaring $schema "http://json-schema.org/draft-04/schema#" to "https://json-schema.org/draft/2020-12/schema", only draft-07 documents`)
+}
+
+func (d *DraftTestSuite) TestUnsupportedTargetDraft() {
+	_, err := InlineSchemaBytes([]byte(`{}`), Options{TargetDraft: Draft07})
+	d.EqualError(err, `unsupported target draft "http://json-schema.org/draft-07/schema#"`)
+}
+
+func (d *DraftTestSuite) TestUpgradeRef() {
+	tests := map[string]string{
+		"#/definitions/A":                         "#/$defs/A",
+		"other.json#/definitions/A":               "other.json#/$defs/A",
+		"#/properties/definitions":                "#/properties/definitions",
+		"#/definitions/definitions/type":          "#/$defs/definitions/type",
+		"#/items/1":                               "#/prefixItems/1",
+		"#/items/properties":                      "#/items/properties",
+		"#/patternProperties/definitions/items/0": "#/patternProperties/definitions/prefixItems/0",
+		"#/patternProperties/~1definitions~1":     "#/patternProperties/~1definitions~1",
+		"#anchor":                                 "#anchor",
+		"other.json":                              "other.json",
+	}
+
+	for given, expected := range tests {
+		d.Run(given, func() {
+			d.Equal(expected, upgradeRef(given))
+		})
+	}
+}
+
+func TestDraftTestSuite(t *testing.T) {
+	suite.Run(t, new(DraftTestSuite))
+}
@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+)
+
+//go:embed testdata/embedded
+var embedded embed.FS
+
+// Schemas embedded in the binary are inlined at startup. An embed.FS is
+// read-only, so nothing is written back and the returned map is the only
+// output.
+func ExampleInlineBundledSchemasInFS_embed() {
+	fsys, err := fs.Sub(embedded, "testdata/embedded")
+	if err != nil {
+		log.Fatal(err)
+	}
+	updates, err := InlineBundledSchemasInFS(fsys, WithKeywordOrder(DefaultKeywordOrder))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(updates["order.json"]))
+	// Output:
+	// {
+	//   "$schema": "https://json-schema.org/draft/2020-12/schema",
+	//   "type": "object",
+	//   "properties": {
+	//     "id": {
+	//       "type": "string",
+	//       "pattern": "^[A-Z0-9]+$"
+	//     },
+	//     "lines": {
+	//       "type": "array",
+	//       "items": {
+	//         "type": "object",
+	//         "properties": {
+	//           "quantity": {
+	//             "type": "integer"
+	//           },
+	//           "sku": {
+	//             "type": "string",
+	//             "pattern": "^[A-Z0-9]+$"
+	//           }
+	//         }
+	//       }
+	//     }
+	//   }
+	// }
+}
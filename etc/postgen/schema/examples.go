@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"path"
+	"strings"
+)
+
+// examplesSuffix ends the name of the sidecar file ExtractExamples writes
+// next to "<name>.json".
+const examplesSuffix = ".examples.json"
+
+// extractExamples removes the "examples" and "example" keywords from every
+// schema in root, and returns their values keyed by the JSON Pointer they were
+// at, or nil if there were none. root is modified in place.
+func extractExamples(root any, max int) (map[string]any, error) {
+	var out map[string]any
+	err := walkSchemas(root, "", max, func(m map[string]any, ptr string) {
+		for _, k := range []string{"examples", "example"} {
+			v, ok := m[k]
+			if !ok {
+				continue
+			}
+			if out == nil {
+				out = map[string]any{}
+			}
+			out[ptr+"/"+k] = v
+			delete(m, k)
+		}
+	})
+	return out, err
+}
+
+// examplesPath returns the path of the sidecar file holding the examples
+// extracted from the schema file at p: "user.json" and "user.json5" have
+// "user.examples.json", and "user.json.gz" has "user.examples.json.gz".
+func examplesPath(p string) string {
+	gz := ""
+	if isGzip(p) {
+		gz = p[len(p)-len(gzipExt):]
+		p = p[:len(p)-len(gzipExt)]
+	}
+	return p[:len(p)-len(path.Ext(p))] + examplesSuffix + gz
+}
+
+// isExamplesFile reports whether name looks like a sidecar file written by
+// ExtractExamples.
+func isExamplesFile(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), gzipExt)
+	return strings.HasSuffix(name, examplesSuffix)
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExamplesTestSuite struct {
+	suite.Suite
+}
+
+func (e *ExamplesTestSuite) TestInlineBundledSchemasInFSExtractExamples() {
+	fsys := fstest.MapFS{
+		"user.json": {Data: []byte(`{
+			"examples": [{"name": "Ann"}],
+			"properties": {
+				"name": {"type": "string", "examples": ["Ann", "Bob"]},
+				"examples": {"type": "array", "example": [1]},
+				"address": {"$ref": "#/$defs/Address"}
+			},
+			"$defs": {"Address": {"type": "string", "examples": ["1 Main St"]}}
+		}`)},
+		"plain.json":         {Data: []byte(`{"type": "string"}`)},
+		"old.examples.json":  {Data: []byte(`{"/examples": []}`)},
+		"archive/v1.json.gz": {Data: gzipped(e.T(), `{"type": "null", "examples": [null]}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{ExtractExamples: true})
+	e.Require().NoError(err)
+	e.Len(updates, 5)
+
+	e.JSONEq(`{
+		"properties": {
+			"name": {"type": "string"},
+			"examples": {"type": "array"},
+			"address": {"type": "string"}
+		}
+	}`, string(updates["user.json"]))
+	e.JSONEq(`{
+		"/examples": [{"name": "Ann"}],
+		"/properties/name/examples": ["Ann", "Bob"],
+		"/properties/examples/example": [1],
+		"/properties/address/examples": ["1 Main St"]
+	}`, string(updates["user.examples.json"]))
+	e.JSONEq(`{"type": "string"}`, string(updates["plain.json"]))
+	e.JSONEq(`{"type": "null"}`, gunzipped(e.T(), updates["archive/v1.json.gz"]))
+	e.JSONEq(`{"/examples": [null]}`, gunzipped(e.T(), updates["archive/v1.examples.json.gz"]))
+}
+
+func (e *ExamplesTestSuite) TestInlineBundledSchemasInFSExtractExamplesOtherExtensions() {
+	fsys := fstest.MapFS{
+		"user.json5": {Data: []byte(`{type: "string", examples: ["Ann"]}`)},
+		"list.jsonl": {Data: []byte(`{"type": "string", "examples": ["a"]}` + "\n" + `{"type": "null"}` + "\n")},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{ExtractExamples: true, Dialect: DialectJSON5})
+	e.Require().NoError(err)
+	e.Len(updates, 4)
+	e.JSONEq(`{"/examples": ["Ann"]}`, string(updates["user.examples.json"]))
+	e.JSONEq(`{"/0/examples": ["a"]}`, string(updates["list.examples.json"]))
+}
+
+func (e *ExamplesTestSuite) TestInlineBundledSchemasInFSExtractExamplesCollision() {
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(`{"$id": "https://example.com/user.examples", "type": "string"}`)},
+		"b.json": {Data: []byte(`{"$id": "https://example.com/user", "examples": ["x"]}`)},
+	}
+
+	_, err := InlineBundledSchemasInFS(fsys, Options{ExtractExamples: true, OutputPathFromID: true})
+	e.EqualError(err, "a.json and b.json both have the output path user.examples.json")
+}
+
+func TestExamplesTestSuite(t *testing.T) {
+	suite.Run(t, new(ExamplesTestSuite))
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// checkExternalRefs returns an error listing the refs in docs, and in the
+// documents they reach, that point at a URI outside of the FS: an absolute
+// URI that's neither a file:// URI, nor the $id of a document, nor fetched
+// by one of Options.Schemes. It's a no-op unless StrictSelfContained is set.
+func (in *inliner) checkExternalRefs(docs []*document) error {
+	if !in.opts.StrictSelfContained {
+		return nil
+	}
+	if err := in.indexIDs(); err != nil {
+		return err
+	}
+	var external []string
+	seen := map[*document]bool{}
+	for len(docs) > 0 {
+		doc := docs[0]
+		docs = docs[1:]
+		if seen[doc] {
+			continue
+		}
+		seen[doc] = true
+		scopes := embeddedScopes{}
+		err := walkSchemas(doc.root, "", in.opts.maxDepth(), func(m map[string]any, ptr string) {
+			scope := scopes.at(doc, m, ptr)
+			ref, ok := m[in.opts.refKeyword()].(string)
+			if !ok {
+				return
+			}
+			ref, err := in.opts.rewriteRef(ref)
+			if err != nil {
+				return // Reported when inlining.
+			}
+			addr, _, _ := strings.Cut(ref, "#")
+			if addr == "" {
+				return
+			}
+			if in.isExternal(addr) {
+				external = append(external, fmt.Sprintf("%q at %q", ref, doc.path+"#"+doc.scope+ptr))
+				return
+			}
+			// Follow refs between files, leaving errors to inlining.
+			if next, err := in.loadDocument(addr, scope); err == nil {
+				docs = append(docs, next)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", doc.path, err)
+		}
+	}
+	if len(external) == 0 {
+		return nil
+	}
+	slices.Sort(external)
+	return fmt.Errorf("refs outside of the FS can't be resolved with StrictSelfContained: %s", strings.Join(external, ", "))
+}
+
+// isExternal reports whether the ref address addr is an absolute URI nothing
+// resolves: not a file:// URI, not the $id of a document and not fetched by
+// one of Options.Schemes. indexIDs must have been called.
+func (in *inliner) isExternal(addr string) bool {
+	u, err := url.Parse(addr)
+	if err != nil || !u.IsAbs() || u.Scheme == "file" {
+		return false
+	}
+	if _, ok := in.opts.Schemes[u.Scheme]; ok {
+		return false
+	}
+	_, ok := in.cache.byID(u.String())
+	return !ok
+}
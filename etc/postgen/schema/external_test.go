@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExternalTestSuite struct {
+	suite.Suite
+}
+
+func (e *ExternalTestSuite) TestInlineBundledSchemasInFSStrictSelfContained() {
+	type test struct {
+		Given       fstest.MapFS
+		Opts        Options
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"external": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{
+					"properties": {
+						"x": {"$ref": "https://example.com/x.json"},
+						"y": {"$ref": "urn:example:y#/$defs/Y"},
+						"z": {"$ref": "b.json"}
+					}
+				}`)},
+				"b.json": {Data: []byte(`{"items": {"$ref": "https://example.com/b.json"}}`)},
+			},
+			ExpectedErr: `refs outside of the FS can't be resolved with StrictSelfContained: ` +
+				`"https://example.com/b.json" at "b.json#/items", ` +
+				`"https://example.com/x.json" at "a.json#/properties/x", ` +
+				`"urn:example:y#/$defs/Y" at "a.json#/properties/y"`,
+		},
+		"resolvable": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{
+					"properties": {
+						"x": {"$ref": "https://example.com/x.json"},
+						"y": {"$ref": "file:///b.json"},
+						"z": {"$ref": "mem://c.json"},
+						"w": {"$ref": "#/$defs/W"}
+					},
+					"$defs": {"W": {}}
+				}`)},
+				"b.json": {Data: []byte(`{"$id": "https://example.com/x.json", "type": "string"}`)},
+			},
+			Opts: Options{Schemes: map[string]func(string) ([]byte, error){
+				"mem": func(string) ([]byte, error) { return []byte(`{}`), nil },
+			}},
+		},
+	}
+
+	for desc, v := range tests {
+		e.Run(desc, func() {
+			opts := v.Opts
+			opts.StrictSelfContained = true
+			_, err := InlineBundledSchemasInFS(v.Given, opts)
+			if v.ExpectedErr != "" {
+				e.EqualError(err, v.ExpectedErr)
+				return
+			}
+			e.NoError(err)
+		})
+	}
+}
+
+func (e *ExternalTestSuite) TestBundleSchemaStrictSelfContained() {
+	fsys := fstest.MapFS{
+		"entry.json": {Data: []byte(`{"properties": {"a": {"$ref": "a.json"}}}`)},
+		"a.json":     {Data: []byte(`{"$ref": "https://example.com/a.json"}`)},
+		"other.json": {Data: []byte(`{"$ref": "https://example.com/other.json"}`)},
+	}
+
+	_, err := BundleSchema(fsys, "entry.json", Options{StrictSelfContained: true})
+	e.EqualError(err, `bundle entry.json: refs outside of the FS can't be resolved with StrictSelfContained: "https://example.com/a.json" at "a.json#"`)
+
+	// Without it, only the first one is found, while inlining.
+	_, err = BundleSchema(fsys, "entry.json")
+	var missing *missingRefError
+	e.True(errors.As(err, &missing))
+}
+
+func TestExternalTestSuite(t *testing.T) {
+	suite.Run(t, new(ExternalTestSuite))
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Format is an extra representation of each file InlineBundledSchemasInFS
+// outputs, written next to it from the same inlined schema.
+type Format struct {
+	// Suffix is inserted before the extension of the output path to name the
+	// extra output, so ".min" writes "user.min.json" next to "user.json".
+	// Required.
+	Suffix string
+	// Minify writes the output without any whitespace between tokens.
+	Minify bool
+	// Indent replaces Options.Indent for the output, unless Minify is set.
+	Indent string
+}
+
+// formatPath returns the path of the output in format f of the schema file at
+// p: "user.json" with the suffix ".min" has "user.min.json", and
+// "user.json.gz" has "user.min.json.gz".
+func formatPath(p string, f Format) string {
+	gz := ""
+	if isGzip(p) {
+		gz = p[len(p)-len(gzipExt):]
+		p = p[:len(p)-len(gzipExt)]
+	}
+	ext := path.Ext(p)
+	return p[:len(p)-len(ext)] + f.Suffix + ext + gz
+}
+
+// isFormatFile reports whether name looks like an output in one of the
+// OutputFormats, so it isn't read back as a source on the next run.
+func isFormatFile(name string, opts Options) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), gzipExt)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	for _, f := range opts.OutputFormats {
+		if strings.HasSuffix(name, strings.ToLower(f.Suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFormats returns an error for the first of formats without a suffix,
+// which would overwrite the main output.
+func checkFormats(formats []Format) error {
+	for i, f := range formats {
+		if f.Suffix == "" {
+			return fmt.Errorf("output format %d has no Suffix", i+1)
+		}
+	}
+	return nil
+}
+
+// formatOptions returns opts with its marshaling changed as f asks.
+func formatOptions(f Format, opts Options) Options {
+	out := opts
+	if f.Indent != "" {
+		out.Indent = f.Indent
+	}
+	if f.Minify {
+		out.Marshaler = func(v any) ([]byte, error) {
+			b, err := opts.marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, b); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+	}
+	return out
+}
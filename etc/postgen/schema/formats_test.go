@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FormatsTestSuite struct {
+	suite.Suite
+}
+
+func (f *FormatsTestSuite) TestInlineBundledSchemasInFSOutputFormats() {
+	fsys := fstest.MapFS{
+		"user.json": {Data: []byte(`{
+			"properties": {"name": {"$ref": "#/$defs/Name"}},
+			"$defs": {"Name": {"type": "string"}}
+		}`)},
+		"user.min.json":      {Data: []byte(`{"type": "null"}`)},
+		"archive/v1.json.gz": {Data: gzipped(f.T(), `{"type": "null"}`)},
+		"list.ndjson":        {Data: []byte("{\"type\": \"string\"}\n")},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{OutputFormats: []Format{
+		{Suffix: ".min", Minify: true},
+		{Suffix: ".tabs", Indent: "\t"},
+	}})
+	f.Require().NoError(err)
+
+	f.Len(updates, 9)
+	f.Equal("{\n  \"properties\": {\n    \"name\": {\n      \"type\": \"string\"\n    }\n  }\n}\n", string(updates["user.json"]))
+	f.Equal("{\"properties\":{\"name\":{\"type\":\"string\"}}}\n", string(updates["user.min.json"]))
+	f.Equal("{\n\t\"properties\": {\n\t\t\"name\": {\n\t\t\t\"type\": \"string\"\n\t\t}\n\t}\n}\n", string(updates["user.tabs.json"]))
+	f.Equal("{\"type\":\"null\"}\n", gunzipped(f.T(), updates["archive/v1.min.json.gz"]))
+	f.Contains(updates, "archive/v1.tabs.json.gz")
+	f.Equal("{\"type\":\"string\"}\n", string(updates["list.min.ndjson"]))
+	f.Contains(updates, "list.tabs.ndjson")
+}
+
+func (f *FormatsTestSuite) TestInlineBundledSchemasInFSOutputFormatsErrors() {
+	type test struct {
+		Given       fstest.MapFS
+		Opts        Options
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"no suffix": {
+			Given:       fstest.MapFS{"a.json": {Data: []byte(`{}`)}},
+			Opts:        Options{OutputFormats: []Format{{Suffix: ".min"}, {Minify: true}}},
+			ExpectedErr: "output format 2 has no Suffix",
+		},
+		"collision": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://example.com/user.min", "type": "string"}`)},
+				"b.json": {Data: []byte(`{"$id": "https://example.com/user"}`)},
+			},
+			Opts:        Options{OutputFormats: []Format{{Suffix: ".min", Minify: true}}, OutputPathFromID: true},
+			ExpectedErr: "a.json and b.json both have the output path user.min.json",
+		},
+	}
+
+	for desc, v := range tests {
+		f.Run(desc, func() {
+			_, err := InlineBundledSchemasInFS(v.Given, v.Opts)
+			f.EqualError(err, v.ExpectedErr)
+		})
+	}
+}
+
+func TestFormatsTestSuite(t *testing.T) {
+	suite.Run(t, new(FormatsTestSuite))
+}
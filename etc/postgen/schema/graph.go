@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"cmp"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RefEdge is a $ref from a schema file to its target.
+type RefEdge struct {
+	// From is the path of the file declaring the $ref.
+	From string
+	// To is the target as "<path>#<pointer>", or "<path>" for a whole file. A
+	// $ref that doesn't resolve is kept as written.
+	To string
+}
+
+// RefGraph returns the $refs declared by every *.json file in fsys, sorted and
+// without duplicates. Refs are resolved the way InlineBundledSchemasInFS
+// resolves them, including by $id and after RewriteRef, but aren't followed:
+// each file contributes only the refs it declares itself.
+func RefGraph(fsys fs.FS, options ...Option) ([]RefEdge, error) {
+	opts := buildOptions(options)
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	in := newInliner(opts)
+	if err := in.indexIDs(); err != nil {
+		return nil, err
+	}
+
+	var edges []RefEdge
+	for _, p := range in.cache.paths() {
+		doc, _ := in.cache.get(p)
+		for _, ref := range collectRefs(doc.root, opts.refKeyword()) {
+			ref, err := opts.rewriteRef(ref)
+			if err != nil {
+				return nil, err
+			}
+			to := ref
+			if target, err := in.resolveRef(ref, doc); err == nil {
+				to = strings.TrimSuffix(target.key(), "#")
+			}
+			edges = append(edges, RefEdge{From: p, To: to})
+		}
+	}
+	slices.SortFunc(edges, func(a, b RefEdge) int {
+		return cmp.Or(strings.Compare(a.From, b.From), strings.Compare(a.To, b.To))
+	})
+	return slices.Compact(edges), nil
+}
+
+// collectRefs returns every distinct ref by refKeyword in root.
+func collectRefs(root any, refKeyword string) []string {
+	seen := map[string]bool{}
+	var walk func(node any)
+	walk = func(node any) {
+		switch v := node.(type) {
+		case map[string]any:
+			if ref, ok := v[refKeyword].(string); ok {
+				seen[ref] = true
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return slices.Sorted(maps.Keys(seen))
+}
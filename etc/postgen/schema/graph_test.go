@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GraphTestSuite struct {
+	suite.Suite
+}
+
+func (g *GraphTestSuite) TestRefGraph() {
+	fsys := fstest.MapFS{
+		"schema.json": {Data: []byte(`{
+			"properties": {
+				"a": {"$ref": "#/$defs/A"},
+				"b": {"$ref": "common/types.json#/$defs/B"},
+				"c": {"$ref": "https://example.com/id"},
+				"d": {"$ref": "gone.json"},
+				"e": {"$ref": "#/$defs/A"}
+			},
+			"$defs": {"A": {"$ref": "common/types.json"}}
+		}`)},
+		"common/types.json": {Data: []byte(`{
+			"$defs": {"B": {"$ref": "../schema.json#/$defs/A"}}
+		}`)},
+		"id.json":    {Data: []byte(`{"$id": "https://example.com/id"}`)},
+		"empty.json": {Data: []byte(``)},
+	}
+
+	edges, err := RefGraph(fsys, Options{})
+	g.Require().NoError(err)
+	g.Equal([]RefEdge{
+		{From: "common/types.json", To: "schema.json#/$defs/A"},
+		{From: "schema.json", To: "common/types.json"},
+		{From: "schema.json", To: "common/types.json#/$defs/B"},
+		{From: "schema.json", To: "gone.json"},
+		{From: "schema.json", To: "id.json"},
+		{From: "schema.json", To: "schema.json#/$defs/A"},
+	}, edges)
+}
+
+func TestGraphTestSuite(t *testing.T) {
+	suite.Run(t, new(GraphTestSuite))
+}
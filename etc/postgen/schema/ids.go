@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CollectIDs returns every $id declared by the schema files in fsys, at the
+// top level or nested, mapped to the path of the file declaring it. A nested
+// $id is resolved against the $id of the nearest schema enclosing it that has
+// one, if that's absolute, so "address" within a file with the $id
+// "https://example.com/user" is collected as "https://example.com/address".
+// Other $ids are collected as written, without an empty fragment. An $id that's
+// declared twice, in one file or in two, is an error.
+func CollectIDs(fsys fs.FS, options ...Option) (map[string]string, error) {
+	opts := buildOptions(options)
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	in := newInliner(opts)
+	if err := in.indexIDs(); err != nil {
+		return nil, err
+	}
+
+	ids := map[string]string{}
+	declared := map[string]string{}
+	for _, p := range in.cache.paths() {
+		doc, _ := in.cache.get(p)
+		found, err := declaredIDs(doc.root, opts.maxDepth())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, d := range found {
+			at := p
+			if d.ptr != "" {
+				at += "#" + d.ptr
+			}
+			if other, ok := declared[d.id]; ok {
+				return nil, fmt.Errorf("$id %q is declared by both %s and %s", d.id, other, at)
+			}
+			declared[d.id] = at
+			ids[d.id] = p
+		}
+	}
+	return ids, nil
+}
+
+// declaredID is an $id declared by the schema at ptr.
+type declaredID struct {
+	ptr string
+	id  string
+}
+
+// declaredIDs returns the $ids declared in root ordered by pointer, each
+// resolved against the $id of the nearest schema enclosing it that has one, if
+// that's absolute.
+func declaredIDs(root any, max int) ([]declaredID, error) {
+	var found []declaredID
+	err := walkSchemas(root, "", max, func(m map[string]any, ptr string) {
+		if id, ok := m["$id"].(string); ok {
+			found = append(found, declaredID{ptr: ptr, id: id})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// An enclosing schema's pointer is a prefix of, so sorts before, those
+	// of the schemas within it.
+	slices.SortFunc(found, func(a, b declaredID) int { return strings.Compare(a.ptr, b.ptr) })
+	for i, d := range found {
+		u, err := url.Parse(d.id)
+		if err != nil {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if found[j].ptr != "" && !strings.HasPrefix(d.ptr, found[j].ptr+"/") {
+				continue
+			}
+			if base, err := url.Parse(found[j].id); err == nil && base.IsAbs() {
+				u = base.ResolveReference(u)
+			}
+			break
+		}
+		found[i].id = u.String()
+	}
+	return found, nil
+}
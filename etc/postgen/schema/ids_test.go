@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IDsTestSuite struct {
+	suite.Suite
+}
+
+func (i *IDsTestSuite) TestCollectIDs() {
+	type test struct {
+		Given       fstest.MapFS
+		Expected    map[string]string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"top-level and nested": {
+			Given: fstest.MapFS{
+				"user.json": {Data: []byte(`{
+					"$id": "https://example.com/schemas/user#",
+					"properties": {
+						"address": {
+							"$id": "address",
+							"properties": {"geo": {"$id": "geo/point.json"}}
+						},
+						"enum": {"enum": [{"$id": "not a schema"}]}
+					},
+					"$defs": {"Other": {"$id": "https://other.example.com/x"}}
+				}`)},
+				"common/id.json": {Data: []byte(`{"$id": "https://example.com/schemas/id"}`)},
+				"no-id.json":     {Data: []byte(`{"type": "string"}`)},
+				"relative.json":  {Data: []byte(`{"$id": "local/rel", "items": {"$id": "item"}}`)},
+			},
+			Expected: map[string]string{
+				"https://example.com/schemas/user":           "user.json",
+				"https://example.com/schemas/address":        "user.json",
+				"https://example.com/schemas/geo/point.json": "user.json",
+				"https://other.example.com/x":                "user.json",
+				"https://example.com/schemas/id":             "common/id.json",
+				"local/rel":                                  "relative.json",
+				"item":                                       "relative.json",
+			},
+		},
+		"none": {
+			Given:    fstest.MapFS{"a.json": {Data: []byte(`{}`)}},
+			Expected: map[string]string{},
+		},
+		"duplicate across files": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://example.com/a", "items": {"$id": "b"}}`)},
+				"b.json": {Data: []byte(`{"$id": "https://example.com/b"}`)},
+			},
+			ExpectedErr: `$id "https://example.com/b" is declared by both a.json#/items and b.json`,
+		},
+		"duplicate within a file": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://example.com/a", "$defs": {"X": {"$id": "x"}, "Y": {"$id": "https://example.com/x"}}}`)},
+			},
+			ExpectedErr: `$id "https://example.com/x" is declared by both a.json#/$defs/X and a.json#/$defs/Y`,
+		},
+		"duplicate top-level": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://example.com/a"}`)},
+				"b.json": {Data: []byte(`{"$id": "https://example.com/a#"}`)},
+			},
+			ExpectedErr: `$id "https://example.com/a" is declared by both a.json and b.json`,
+		},
+		"invalid json": {
+			Given:       fstest.MapFS{"a.json": {Data: []byte(`{`)}},
+			ExpectedErr: "parse a.json: unexpected end of JSON input",
+		},
+	}
+
+	for desc, v := range tests {
+		i.Run(desc, func() {
+			ids, err := CollectIDs(v.Given)
+			if v.ExpectedErr != "" {
+				i.EqualError(err, v.ExpectedErr)
+				return
+			}
+			i.Require().NoError(err)
+			i.Equal(v.Expected, ids)
+		})
+	}
+}
+
+func TestIDsTestSuite(t *testing.T) {
+	suite.Run(t, new(IDsTestSuite))
+}
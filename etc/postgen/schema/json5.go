@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/titanous/json5"
+)
+
+// Dialect is the syntax schema files are written in. Output is always strict
+// JSON.
+type Dialect string
+
+const (
+	// DialectJSON is strict JSON. It's the default.
+	DialectJSON Dialect = "JSON"
+	// DialectJSON5 is JSON5 (https://spec.json5.org), which adds comments,
+	// unquoted keys, single-quoted strings, trailing commas and more lenient
+	// numbers to JSON. Files named *.json5 are picked up as well as *.json.
+	DialectJSON5 Dialect = "JSON5"
+)
+
+// json5Ext is the extension of JSON5 files, which are schema files under
+// DialectJSON5.
+const json5Ext = ".json5"
+
+// parseSource decodes b, written in dialect, into the same types
+// encoding/json produces, ignoring a leading UTF-8 byte order mark.
+func parseSource(b []byte, dialect Dialect) (any, error) {
+	switch dialect {
+	case "", DialectJSON:
+		return parseJSON(b)
+	case DialectJSON5:
+		return parseJSON5(b)
+	}
+	return nil, fmt.Errorf("unknown dialect %q", dialect)
+}
+
+// isSourceFile reports whether name is a schema file in dialect.
+func isSourceFile(name string, dialect Dialect) bool {
+	if isSchemaFile(name) {
+		return true
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), gzipExt)
+	return dialect == DialectJSON5 && strings.HasSuffix(name, json5Ext)
+}
+
+// parseJSON5 decodes the JSON5 text b. Numbers are json.Number, as with
+// parseJSON, unless JSON can't write them as they are, like hex literals, in
+// which case they're float64. Infinity and NaN, which JSON has no way to write
+// at all, are rejected.
+func parseJSON5(b []byte) (any, error) {
+	b = bytes.TrimPrefix(b, utf8BOM)
+	// Only the Decoder keeps the text of numbers, but it stops after the
+	// first value, so Unmarshal checks there's nothing after it.
+	if err := json5.Unmarshal(b, new(any)); err != nil {
+		return nil, err
+	}
+	dec := json5.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return fromJSON5(v)
+}
+
+// fromJSON5 replaces the json5.Number values in v, decoded with UseNumber,
+// with the types parseJSON produces, in place.
+func fromJSON5(v any) (any, error) {
+	var err error
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if v[k], err = fromJSON5(e); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if v[i], err = fromJSON5(e); err != nil {
+				return nil, err
+			}
+		}
+	case json5.Number:
+		return json5Number(string(v))
+	case float64:
+		// With UseNumber, only Infinity and NaN are float64.
+		return nil, errors.New("JSON can't represent Infinity or NaN")
+	}
+	return v, nil
+}
+
+// json5Number converts the JSON5 number literal s. Literals JSON allows too
+// keep their text.
+func json5Number(s string) (any, error) {
+	s = strings.TrimPrefix(s, "+")
+	if json.Valid([]byte(s)) {
+		return json.Number(s), nil
+	}
+	if t := strings.TrimPrefix(s, "-"); strings.HasPrefix(strings.ToLower(t), "0x") {
+		s += "p0" // ParseFloat only takes hex with an exponent.
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s", strings.TrimSuffix(s, "p0"))
+	}
+	return f, nil
+}
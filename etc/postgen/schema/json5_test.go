@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type JSON5TestSuite struct {
+	suite.Suite
+}
+
+func (j *JSON5TestSuite) TestParseJSON5() {
+	type test struct {
+		Given       string
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"json": {
+			Given:    `{"a": [1, -2.5e3, true, false, null, "xA\n"], "b": {}}`,
+			Expected: `{"a": [1, -2500, true, false, null, "xA\n"], "b": {}}`,
+		},
+		"comments": {
+			Given: `// leading
+			{
+				/* block */ "a": 1, // trailing
+				"b": /* inside */ 2
+			}
+			/* after */`,
+			Expected: `{"a": 1, "b": 2}`,
+		},
+		"unquoted keys": {
+			Given:    `{type: "object", $id: "a", _x1: 1}`,
+			Expected: `{"type": "object", "$id": "a", "_x1": 1}`,
+		},
+		"trailing commas": {
+			Given:    `{"a": [1, 2,], "b": {"c": 3,},}`,
+			Expected: `{"a": [1, 2], "b": {"c": 3}}`,
+		},
+		"single quotes": {
+			Given:    `{'a': 'it\'s "quoted"', "b": "it's"}`,
+			Expected: `{"a": "it's \"quoted\"", "b": "it's"}`,
+		},
+		"numbers": {
+			Given:    `[+1, .5, 5., 0x1F, -0Xff, 1e+2, 0]`,
+			Expected: `[1, 0.5, 5, 31, -255, 100, 0]`,
+		},
+		"infinity": {
+			Given:       `{"a": -Infinity}`,
+			ExpectedErr: `JSON can't represent Infinity or NaN`,
+		},
+		"nan": {
+			Given:       `[NaN]`,
+			ExpectedErr: `JSON can't represent Infinity or NaN`,
+		},
+		"syntax error": {
+			Given:       `{"a": 1 "b": 2}`,
+			ExpectedErr: `invalid character '"' after object key:value pair`,
+		},
+		"two values": {
+			Given:       `{} {}`,
+			ExpectedErr: `invalid character '{' after top-level value`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			got, err := parseJSON5([]byte(v.Given))
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			b, err := json.Marshal(got)
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(b))
+		})
+	}
+}
+
+func (j *JSON5TestSuite) TestParseJSON5MatchesEncodingJSON() {
+	given := `{"a": [1, 2.5, "s", {"b": null}], "c": {}, "d": [], "a": true}`
+
+	want, err := parseJSON([]byte(given))
+	j.Require().NoError(err)
+	got, err := parseJSON5([]byte(given))
+	j.Require().NoError(err)
+	j.Equal(want, got)
+}
+
+func (j *JSON5TestSuite) TestInlineBundledSchemasInFSJSON5() {
+	fsys := fstest.MapFS{
+		"order.json5": {Data: []byte(`{
+			// Orders reference customers.
+			properties: {
+				customer: {$ref: 'customer.json5'},
+				id: {$ref: "common.json#/$defs/ID"},
+			},
+		}`)},
+		"customer.json5": {Data: []byte(`{type: 'object', required: ['name',],}`)},
+		"common.json":    {Data: []byte(`{"$defs": {"ID": {"type": "string"}}}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, WithDialect(DialectJSON5))
+	j.Require().NoError(err)
+	j.Len(updates, 3)
+	j.JSONEq(`{"properties": {"customer": {"type": "object", "required": ["name"]}, "id": {"type": "string"}}}`, string(updates["order.json5"]))
+	j.JSONEq(`{"type": "object", "required": ["name"]}`, string(updates["customer.json5"]))
+
+	// Without the dialect, *.json5 files aren't schema files.
+	updates, err = InlineBundledSchemasInFS(fstest.MapFS{"common.json": fsys["common.json"], "a.json5": fsys["order.json5"]}, Options{})
+	j.Require().NoError(err)
+	j.Equal([]string{"common.json"}, slices.Sorted(maps.Keys(updates)))
+
+	_, err = InlineBundledSchemasInFS(fstest.MapFS{"a.json": {Data: []byte(`{a: 1}`)}}, Options{})
+	j.EqualError(err, "parse a.json: invalid character 'a' looking for beginning of object key string")
+
+	_, err = InlineBundledSchemasInFS(fstest.MapFS{"a.json": {Data: []byte(`{}`)}}, WithDialect("YAML"))
+	j.EqualError(err, `parse a.json: unknown dialect "YAML"`)
+}
+
+func (j *JSON5TestSuite) TestInlineSchemaBytesJSON5() {
+	out, err := InlineSchemaBytes([]byte(`{items: {$ref: '#/$defs/A'}, $defs: {A: {type: 'string'}}}`), WithDialect(DialectJSON5))
+	j.Require().NoError(err)
+	j.JSONEq(`{"items": {"type": "string"}}`, string(out))
+}
+
+func TestJSON5TestSuite(t *testing.T) {
+	suite.Run(t, new(JSON5TestSuite))
+}
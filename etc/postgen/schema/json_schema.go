@@ -1,25 +1,522 @@
 package schema
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"maps"
+	"net/url"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-// InlineBundledSchemasInFS finds all *.json files in fsys, and for each file:
-// - parses JSON
-// - inlines local $ref pointers like "#/$defs/..."
-// - removes $defs (everywhere)
-// - removes all $id (everywhere, including top-level)
-// - removes all $schema except the top-level $schema
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// DefaultMaxDepth is the nesting depth Options.MaxDepth defaults to. It
+// matches the limit encoding/json applies when decoding.
+const DefaultMaxDepth = 10000
+
+// LineEnding selects the line terminator used in generated files.
+type LineEnding string
+
+const (
+	// LineEndingLF uses "\n". It's the default.
+	LineEndingLF LineEnding = "LF"
+	// LineEndingCRLF uses "\r\n".
+	LineEndingCRLF LineEnding = "CRLF"
+	// LineEndingAuto uses CRLF on Windows and LF everywhere else.
+	LineEndingAuto LineEnding = "Auto"
+)
+
+// MissingRefPolicy is what to do with a $ref whose target doesn't exist.
+type MissingRefPolicy string
+
+const (
+	// MissingRefError aborts with an error. It's the default.
+	MissingRefError MissingRefPolicy = "Error"
+	// MissingRefWarn leaves the $ref as is and records a diagnostic.
+	MissingRefWarn MissingRefPolicy = "Warn"
+	// MissingRefRemove drops the object holding the $ref from its parent and
+	// records a diagnostic. In an array the object is replaced with true, so
+	// the other elements keep their positions. An object under "not" can't
+	// be dropped without lifting its constraint, which is an error.
+	MissingRefRemove MissingRefPolicy = "Remove"
+)
+
+// DynamicRefPolicy is what to do with a $dynamicRef, which can't be inlined
+// since its target depends on the dynamic scope it's evaluated in.
+type DynamicRefPolicy string
+
+const (
+	// DynamicRefError aborts with an error. It's the default.
+	DynamicRefError DynamicRefPolicy = "Error"
+	// DynamicRefWarn leaves the $dynamicRef as is and records a diagnostic.
+	// The $defs entry declaring the $dynamicAnchor it points at is still
+	// removed, so the output only validates the same way if the anchor is
+	// declared elsewhere, such as in a schema that extends it.
+	DynamicRefWarn DynamicRefPolicy = "Warn"
+)
+
+// ConflictPolicy is what to do when a sibling of a $ref overrides a keyword of
+// its target with a different value.
+type ConflictPolicy string
+
+const (
+	// ConflictIgnore lets the sibling win silently. It's the default.
+	ConflictIgnore ConflictPolicy = "Ignore"
+	// ConflictWarn lets the sibling win and records a diagnostic.
+	ConflictWarn ConflictPolicy = "Warn"
+	// ConflictError aborts with an error.
+	ConflictError ConflictPolicy = "Error"
+)
+
+// Options configures how schemas are inlined and cleaned up.
+type Options struct {
+	// KeepAnchoredDefs retains $defs entries that declare an $anchor so that
+	// external "#anchor" references keep resolving after inlining.
+	KeepAnchoredDefs bool
+
+	// StrictEmpty makes empty or whitespace-only files an error. By default
+	// they are skipped with a diagnostic.
+	StrictEmpty bool
+
+	// AnnotateProvenance adds a "$comment" naming the source $ref to each
+	// object produced by inlining, appended to any comment the target
+	// already has, unless a sibling of the $ref sets one. Meant for
+	// debugging; leave off for release bundles.
+	AnnotateProvenance bool
+
+	// InjectTitleFromDefName sets the "title" of an object inlined from a ref
+	// to a whole $defs entry, such as "#/$defs/UserProfile", to the entry's
+	// name if it has no title of its own, so the name survives flattening.
+	// Refs to other locations, including ones within a $defs entry, are left
+	// alone, and a "title" next to the $ref still wins.
+	InjectTitleFromDefName bool
+
+	// UnionTypes merges the "type" of a $ref target with a "type" set next to
+	// the $ref, instead of letting the sibling replace it. For example a
+	// target of ["string", "null"] and a sibling of "integer" merge to
+	// ["string", "null", "integer"].
+	UnionTypes bool
+
+	// MergeArrays unions the arrays of "required", "allOf" and "enum" set both
+	// on a $ref target and next to the $ref, keeping the order values first
+	// appear in, instead of letting the sibling replace them. No other
+	// keywords are merged. Note that a union of "enum" accepts more values
+	// than either array alone.
+	MergeArrays bool
+
+	// DetectConflicts decides what happens when a sibling of a $ref overrides
+	// a keyword of the target with a different value, such as a target of
+	// "type": "string" next to "type": "number". Annotations like
+	// "description" are expected to be overridden and never conflict, nor
+	// does "type" with UnionTypes or the keywords merged by MergeArrays.
+	// Defaults to ConflictIgnore.
+	DetectConflicts ConflictPolicy
+
+	// WrapBooleanTargets inlines a $ref to a boolean schema, such as a $defs
+	// entry "Anything": true, that has siblings as the siblings plus an allOf
+	// holding the boolean, so nothing is dropped. Otherwise a true target
+	// inlines to the siblings alone, and a false one to false alone. A $ref
+	// without siblings always inlines to the boolean.
+	WrapBooleanTargets bool
+
+	// DedupCombinatorMembers removes members of allOf and anyOf arrays that
+	// are identical to an earlier member once inlined, such as two refs to
+	// the same $defs entry. Other arrays, like "required" or "enum", are left
+	// alone, and so is oneOf, where a duplicate member means no instance can
+	// match either copy; a diagnostic is recorded for those instead.
+	DedupCombinatorMembers bool
+
+	// StripAnnotations removes the AnnotationKeywords from every schema in
+	// the output, for a lean bundle meant only for validation. Data such as
+	// the values of "enum", and property names, are left alone. Refs to the
+	// annotations are still inlined, since they're stripped afterwards.
+	StripAnnotations bool
+
+	// AnnotationKeywords are the keywords StripAnnotations removes. Defaults
+	// to DefaultAnnotationKeywords.
+	AnnotationKeywords []string
+
+	// InlineMaxRefHops limits how many refs are followed along any path from
+	// the root. Refs beyond the limit are left in place and the $defs entries
+	// they point at are kept, producing a "shallow flatten". Zero means no
+	// limit.
+	InlineMaxRefHops int
+
+	// PreserveRecursiveRefs leaves a $ref that would close a cycle, such as
+	// one from a tree node to itself, in place instead of failing, and keeps
+	// the $defs entry it points at. A cycle through another document leaves a
+	// ref to that document. Report.Cycles lists the cycles found.
+	PreserveRecursiveRefs bool
+
+	// InlineOnly, if set, limits inlining to refs matching one of its
+	// patterns. A pattern containing any of "*?[" is a path.Match glob over the
+	// whole ref string, so "*" doesn't cross a "/"; any other pattern matches
+	// refs it's a prefix of, e.g. "#/$defs/Shared/". Other refs are left in
+	// place and the $defs entries they point at are kept.
+	InlineOnly []string
+
+	// InlineExternalOnly inlines only refs into other documents, leaving refs
+	// within the document as they are and keeping its whole $defs block, so
+	// the output is self-contained but keeps its structure. Refs within the
+	// inlined content are inlined too unless they point back into the
+	// document.
+	InlineExternalOnly bool
+
+	// KeepDefs keeps the document's whole $defs block and leaves refs to it,
+	// i.e. refs resolving to "#/$defs/..." in the same document, as they are,
+	// so named types stay named. Every other ref is inlined: refs to other
+	// locations in the document, such as "#/properties/a", refs to other
+	// documents, and refs within content inlined from other documents, even
+	// to their own $defs.
+	KeepDefs bool
+
+	// RespectInlineMarker leaves refs in place whose target carries
+	// InlineMarker set to false, such as a $defs entry declaring
+	// "x-inline": false, and keeps every such entry in the $defs of its
+	// document. The marker is stripped from the output.
+	RespectInlineMarker bool
+
+	// InlineMarker is the key RespectInlineMarker looks for. Defaults to
+	// "x-inline".
+	InlineMarker string
+
+	// RequireFullyInlined fails a document if any $ref or $dynamicRef is left
+	// in its output, whether it was unresolved, or left in place by an option
+	// such as InlineOnly, KeepDefs or OnDynamicRef. BundleSchema ignores it,
+	// since it leaves refs into the bundled $defs by design.
+	RequireFullyInlined bool
+
+	// StrictSelfContained fails before anything is inlined if a ref in the
+	// source, or in a document it refers to, points at an absolute URI
+	// outside of the FS that nothing can resolve: one that isn't a file://
+	// URI, the $id of a document or fetched by one of Schemes. All of them
+	// are listed, rather than only the first one inlining would fail on.
+	StrictSelfContained bool
+
+	// TargetDraft, if set, upgrades every document to that dialect before
+	// inlining, and sets the top-level $schema to it. Only Draft202012 is
+	// supported, upgrading from draft-07. Documents declaring another draft
+	// are an error.
+	TargetDraft Draft
+
+	// FormatOnly skips inlining and stripping altogether, and just re-emits
+	// each document with Indent, KeywordOrder and LineEnding, like a formatter
+	// for schemas. Options that check or change the inlined output, such as
+	// RequireFullyInlined, have no effect. BundleSchema ignores it.
+	FormatOnly bool
+
+	// FormatNumber, if set, rewrites each number in the output. It's given
+	// the number as the source wrote it, or without an exponent if it has no
+	// source text, as with JSON5 hex literals or float64 values in a tree
+	// passed to ResolveDocument, and must return a valid JSON number.
+	FormatNumber func(n json.Number) json.Number
+
+	// LineEnding is the line terminator of the output. Defaults to
+	// LineEndingLF.
+	LineEnding LineEnding
+
+	// PruneEmptyObjects drops objects that are left empty only because their
+	// $defs, $id or $schema were stripped, and then any objects left empty by
+	// that, such as a "properties" whose one entry only held $defs. Objects
+	// that are empty in the source are kept, as are empty objects in arrays,
+	// where removing them would shift the positions of later items, and the
+	// root.
+	PruneEmptyObjects bool
+
+	// StripKeys lists the keys removed everywhere from the output once refs
+	// are inlined, except the top-level $schema, which is always kept. Refs
+	// must not target them. $defs is always removed, apart from the entries
+	// KeepAnchoredDefs and similar options keep. Defaults to $id and $schema.
+	StripKeys []string
+
+	// StripPaths lists locations removed from the output once refs are
+	// inlined, as JSON Pointers from the root of each schema, such as
+	// "#/properties/internalField". A token may be a glob as path.Match
+	// takes, so "#/properties/*/x-internal" matches any property, though "*"
+	// doesn't match a "/" within a key. Objects lose the keys matched and
+	// arrays the items. Pointers that match nothing are ignored.
+	StripPaths []string
+
+	// SafeStrip keeps a nested $id that StripKeys would remove when a relative
+	// $ref left in the output beneath it, other than a bare "#..." fragment,
+	// depends on it as a base URI. Such refs are only left in the output when
+	// they aren't inlined, e.g. with OnMissingRef set to MissingRefWarn or with
+	// InlineOnly. Without SafeStrip, stripping such an $id is an error, since
+	// it would silently change what the ref points at. Refs left in place are
+	// written against the file, so keeping an $id above a bare fragment is an
+	// error too.
+	SafeStrip bool
+
+	// Indent is the indentation of the output per level of nesting. Defaults
+	// to two spaces.
+	Indent string
+
+	// Marshaler, if set, encodes each output file in place of the default,
+	// which indents by Indent like json.MarshalIndent but leaves "<", ">"
+	// and "&" unescaped, since schemas often have HTML in descriptions. It's
+	// given the value to write, with its numbers formatted and its keywords
+	// ordered as the options ask. A final newline is added if it leaves one
+	// out, and the lines of NDJSON output are compacted.
+	Marshaler func(v any) ([]byte, error)
+
+	// KeywordOrder, if set, orders the keywords of each schema in the output:
+	// listed keywords first, in the order given, then other keys
+	// alphabetically, then "x-" extension keys alphabetically. Names under
+	// "properties" and the like, and data such as "default", stay in
+	// alphabetical order. DefaultKeywordOrder is a conventional choice. By
+	// default all keys are alphabetical.
+	KeywordOrder []string
+
+	// RewriteRef, if set, is called with every $ref before it's resolved, and
+	// the $ref is resolved as the string it returns instead, so refs to a
+	// renamed $defs entry such as "#/$defs/OldName" can be redirected to
+	// "#/$defs/NewName" without editing the sources. Refs that are left in
+	// the output are left rewritten. Returning the ref as is leaves it
+	// alone; returning an error aborts.
+	RewriteRef func(ref string) (string, error)
+
+	// RefKeyword is the keyword refs are written with, for dialects that use
+	// one such as "$include" instead of "$ref". Inlining, bundling, RefGraph
+	// and Lint all look for it alone, and a "$ref" is then an ordinary
+	// keyword. Defaults to "$ref".
+	RefKeyword string
+
+	// LenientRefs treats a $ref starting with "/", such as "/$defs/Foo", as
+	// the fragment "#/$defs/Foo", as some generators write them, rather than
+	// as a path from the root of FS. RewriteRef sees the fixed ref.
+	LenientRefs bool
+
+	// OnMissingRef decides what happens to a $ref whose target doesn't exist.
+	// Defaults to MissingRefError.
+	OnMissingRef MissingRefPolicy
+
+	// OnDynamicRef decides what happens to a $dynamicRef, since inlining
+	// can't follow one. Defaults to DynamicRefError.
+	OnDynamicRef DynamicRefPolicy
+
+	// SubstituteVars replaces ${NAME} placeholders in string values, but not
+	// in object keys, with the value Substitute returns for NAME, before
+	// anything else is done with a document. That includes $ref values and
+	// documents loaded by cross-file refs. NAME is a letter or underscore
+	// followed by letters, digits and underscores; other text is left alone.
+	SubstituteVars bool
+
+	// Substitute looks up the variables for SubstituteVars. Defaults to
+	// os.LookupEnv.
+	Substitute func(name string) (string, bool)
+
+	// OnUnresolvedVar decides what happens to a placeholder whose variable
+	// Substitute doesn't find. Defaults to UnresolvedVarError.
+	OnUnresolvedVar UnresolvedVarPolicy
+
+	// ExtractExamples moves the "examples" and "example" keywords of every
+	// schema out of each file InlineBundledSchemasInFS outputs, into a
+	// sidecar file next to it named "<name>.examples.json". The sidecar is
+	// an object mapping the JSON Pointer each keyword was at in the output to
+	// its value, and is only written for files that had examples. Input files
+	// named like sidecars are skipped. InlineSchemaBytes and ResolveDocument
+	// ignore the option.
+	ExtractExamples bool
+
+	// PreserveFormatting keeps the bytes of every part of a source file that
+	// inlining and stripping leave unchanged, such as its whitespace, key
+	// order and how its numbers are written, and only marshals the parts that
+	// change, such as the objects refs were inlined into, indented to line up
+	// with where they start. Objects that only lose keys, such as a root
+	// without its $defs, keep the rest of their members in place. Line
+	// endings follow the source, and KeywordOrder and FormatNumber only apply
+	// to the parts marshaled. Sources that aren't plain JSON, such as NDJSON
+	// files or other Dialects, are marshaled as usual, as are OutputFormats.
+	// FormatOnly ignores it.
+	PreserveFormatting bool
+
+	// OutputFormats are extra representations of each file
+	// InlineBundledSchemasInFS outputs, such as a minified copy, written next
+	// to it and named by their Suffix. They're marshaled from the same
+	// inlined schema, so inlining happens once. Input files named like them
+	// are skipped. InlineSchemaBytes and ResolveDocument ignore the option.
+	OutputFormats []Format
+
+	// SamplesDir, if set, is a directory of fsys holding sample instances of
+	// the schema files, which InlineBundledSchemasInFS validates against each
+	// file both as read and as inlined, failing before anything is written
+	// if the results differ. The samples of "common/user.json" are the
+	// *.json files in "<SamplesDir>/common/user". SamplesDir itself is
+	// skipped when looking for schema files. The other options, such as
+	// InlineOnly, are expected not to change what a schema accepts, and this
+	// proves it for the samples given.
+	SamplesDir string
+
+	// Include, if set, limits the files InlineBundledSchemasInFS processes
+	// to those matching one of its globs, and Exclude skips the files
+	// matching any of its own, and everything under a directory that does.
+	// Globs are path.Match patterns over the slash-separated path within
+	// fsys, such as "fixtures/*.json", or over the name alone if they have
+	// no "/", such as "*.draft.json". A file left out isn't processed or
+	// searched for $id, but a $ref naming it by path still reads it.
+	Include []string
+	Exclude []string
+
+	// OutputPathFromID makes InlineBundledSchemasInFS key each output, and
+	// write it back, by a path derived from the document's absolute top-level
+	// $id rather than its input path. The path is what follows IDBaseURL in
+	// the $id, or the path of the $id if IDBaseURL is empty, with ".json"
+	// appended unless it already ends in it, and ".gz" for gzipped input. So
+	// "https://api.example.com/schemas/user" is written to
+	// "schemas/user.json". Input files are left in place. A document without
+	// such an $id, or two documents deriving the same path, is an error.
+	OutputPathFromID bool
+
+	// IDBaseURL is the prefix OutputPathFromID strips from each $id, such as
+	// "https://api.example.com/schemas/". Every $id must start with it.
+	IDBaseURL string
+
+	// Dialect is the syntax of the input: DialectJSON, the default, or
+	// DialectJSON5, which also picks up *.json5 files. Whatever the input,
+	// output is strict JSON, written back to the input's path.
+	Dialect Dialect
+
+	// FS is where documents named by cross-file refs such as
+	// "common.json#/$defs/A" are loaded from. InlineBundledSchemasInFS defaults
+	// it to the FS being walked.
+	FS fs.FS
+
+	// FallbackFS are searched in order for a document named by a cross-file
+	// ref when FS doesn't have it, like include directories in a compiler.
+	// Each lookup starts over from FS, including lookups from documents found
+	// in a fallback. Files in a fallback are never inlined themselves, and
+	// their $ids aren't indexed.
+	FallbackFS []fs.FS
+
+	// PriorBundles are the outputs of earlier BundleSchema runs, such as of
+	// shared libraries, that cross-file refs into the bundled files resolve
+	// from instead of the files themselves, which needn't exist. See
+	// PriorBundle.
+	PriorBundles []PriorBundle
+
+	// Schemes maps URI schemes, such as "s3", to functions fetching the
+	// documents refs with that scheme point at. Set it with RegisterScheme.
+	Schemes map[string]func(uri string) ([]byte, error)
+
+	// BasePath is the directory within FS that relative refs in a document
+	// passed to InlineSchemaBytes are resolved against. Files found by
+	// InlineBundledSchemasInFS always resolve against their own directory.
+	BasePath string
+
+	// Concurrency is how many files InlineBundledSchemasInFS inlines at once.
+	// Values below 2 inline one file at a time. With more, diagnostics are
+	// recorded in no particular order.
+	Concurrency int
+
+	// Progress, if set, is called by InlineBundledSchemasInFS each time a
+	// file has been inlined, with how many have been so far out of the total.
+	// Calls are never concurrent.
+	Progress func(done, total int)
+
+	// DefNameFunc names the $defs entries BundleSchema collects, given the
+	// path of the document an entry comes from and the name of the entry in
+	// that document's $defs, or "" for a whole document. Names must be unique.
+	// By default the path, without its extension and made an identifier, is
+	// prefixed to the name, so "common/user.json" and "Address" make
+	// "common_user_Address".
+	DefNameFunc func(sourcePath, origName string) string
+
+	// BundleID, if set, is the top-level $id of the output of BundleSchema.
+	BundleID string
+
+	// BundleSchema, if set, is the top-level $schema of the output of
+	// BundleSchema, instead of the one the entry declares.
+	BundleSchema string
+
+	// DefsOrder is the order of the $defs entries BundleSchema collects.
+	// Defaults to DefsOrderName.
+	DefsOrder DefsOrder
+
+	// IndexPath, if set, makes BundleSchema also write a JSON index of the
+	// $defs entries it collects to this path in fsys, if fsys is writable, so
+	// code generators can list the bundled types without parsing the bundle.
+	// See IndexEntry.
+	IndexPath string
+
+	// MaxInputBytes, if positive, makes InlineBundledSchemasInFS fail on any
+	// file it finds that's larger, counting gzipped files decompressed. It
+	// catches generated or already inlined schemas committed as sources.
+	MaxInputBytes int
+
+	// MaxDepth limits how deeply objects and arrays may nest, counting the
+	// content of inlined refs. Deeper trees are rejected with an error rather
+	// than recursed into, which also catches cyclic trees built in code and
+	// passed to ResolveDocument. Defaults to DefaultMaxDepth.
+	MaxDepth int
+
+	// Report, if set, collects diagnostics from the run.
+	Report *Report
+
+	// MeasureInlined records in Report the size of the JSON inlined for each
+	// ref target, as DefUsage.Bytes. It marshals every target inlined, so
+	// it's off by default; how often each target is inlined is recorded
+	// either way.
+	MeasureInlined bool
+
+	// Logger, if set, gets a debug log for each file inlined or written back
+	// and each $ref inlined or left in place, and a warning for each
+	// diagnostic. At LevelTrace, it also gets how each $ref was resolved. By
+	// default nothing is logged.
+	Logger *slog.Logger
+}
+
+// errMaxDepth is returned when a tree nests deeper than max.
+func errMaxDepth(max int) error {
+	return fmt.Errorf("schema nests deeper than %d levels; it may be cyclic", max)
+}
+
+// InlineBundledSchemasInFS finds all *.json files in fsys, and *.json.gz files
+// holding gzipped JSON, plus *.json5 files with DialectJSON5, and for each file:
+// - parses JSON, or JSON5 with DialectJSON5, ignoring a leading UTF-8 byte
+// order mark
+// - inlines local $ref pointers like "#/$defs/...", relative cross-file refs
+// like "common.json#/$defs/...", and refs to the absolute $id of any file in
+// fsys, with either a pointer or a plain-name anchor like "common.json#Address"
+// as the fragment
+// - fails on any $dynamicRef, which can't be inlined, unless OnDynamicRef says
+// otherwise
+// - merges keywords next to a $ref into its inlined target, replacing any the
+// target sets; a target that's itself a $ref is inlined first, so along a
+// chain of refs the siblings nearest the original $ref win
+// - treats a top-level array as a list of schemas, inlining each element on
+// its own, so "#" refers to the element rather than the array
+// - removes $defs (everywhere), except anchored entries if KeepAnchoredDefs
+// - removes StripKeys, by default all $id and all $schema except the top-level
+// $schema
 // - pretty-prints the result
 //
-// Returns a map of updated file contents keyed by file path.
-// If fsys is writable, it will also write each updated file back to fsys.
-func InlineBundledSchemasInFS(fsys fs.FS) (map[string][]byte, error) {
+// Returns a map of updated file contents keyed by file path, gzipped again for
+// *.json.gz files.
+// If fsys is writable, it will also write each updated file back to fsys, once
+// every file has been inlined successfully.
+// A read-only fsys, such as an embed.FS, is only read from, so the returned map
+// is the only output.
+func InlineBundledSchemasInFS(fsys fs.FS, options ...Option) (map[string][]byte, error) {
+	opts := buildOptions(options)
 	updates := map[string][]byte{}
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	if err := checkFormats(opts.OutputFormats); err != nil {
+		return nil, err
+	}
+	in := newInliner(opts)
 
 	// Optional write-back support for writable FS implementations.
 	type writeFileFS interface {
@@ -30,249 +527,1543 @@ func InlineBundledSchemasInFS(fsys fs.FS) (map[string][]byte, error) {
 		writer = w
 	}
 
-	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		if d.IsDir() {
-			return nil
+	// Parse everything up front so refs between files and $id lookups see
+	// the original documents rather than ones already written back.
+	var docs []*document
+	var sizes []int
+	err := walkSourceFiles(fsys, opts, func(path string) error {
+		var size int64
+		if opts.MaxInputBytes > 0 {
+			fi, err := fs.Stat(fsys, path)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", path, err)
+			}
+			size = fi.Size()
+			if !isGzip(path) && size > int64(opts.MaxInputBytes) {
+				return fmt.Errorf("%s is %d bytes, more than the maximum of %d for a source schema", path, size, opts.MaxInputBytes)
+			}
+		}
+		b, err := readSchemaFileLimit(fsys, path, opts.MaxInputBytes)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if opts.MaxInputBytes > 0 && len(b) > opts.MaxInputBytes {
+			// Decompression stopped past the maximum, so only the
+			// compressed size is known.
+			return fmt.Errorf("%s is %d bytes gzipped, and more than the maximum of %d for a source schema decompressed", path, size, opts.MaxInputBytes)
+		}
+		// Editors on Windows like to prepend a BOM, which encoding/json rejects.
+		// Output is re-encoded so it never carries one.
+		b = bytes.TrimPrefix(b, utf8BOM)
+
+		if isBlank(b) {
+			if opts.StrictEmpty {
+				return fmt.Errorf("parse %s: empty file", path)
+			}
+			opts.warn(filepath.ToSlash(path), "skipped empty file")
+			return nil
+		}
+
+		doc, err := in.addDocument(filepath.ToSlash(path), b)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		docs = append(docs, doc)
+		sizes = append(sizes, len(b))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Index $ids now so conflicts are reported even if no ref uses them.
+	if err := in.indexIDs(); err != nil {
+		return nil, err
+	}
+	if err := in.checkExternalRefs(docs); err != nil {
+		return nil, err
+	}
+
+	// Inline with a pool of workers sharing the parsed documents. Errors are
+	// reported for the first failing file in walk order, whatever order the
+	// workers finish in.
+	outs := make([][]byte, len(docs))
+	examples := make([][]byte, len(docs))
+	formats := make([][][]byte, len(docs))
+	errs := make([]error, len(docs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var progress sync.Mutex
+	done := 0
+	for range min(opts.concurrency(), len(docs)) {
+		worker := in.fork()
+		wg.Go(func() {
+			for i := range next {
+				outs[i], examples[i], formats[i], errs[i] = worker.inlineFile(docs[i])
+				if opts.Progress != nil {
+					progress.Lock()
+					done++
+					opts.Progress(done, len(docs))
+					progress.Unlock()
+				}
+			}
+		})
+	}
+	for i := range docs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.SamplesDir != "" {
+		if err := checkSamples(fsys, docs, outs, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Derive every output path before writing anything, so a collision
+	// leaves fsys untouched.
+	paths := make([]string, len(docs))
+	from := map[string]string{}
+	claim := func(path string, doc *document) error {
+		if other, ok := from[path]; ok {
+			return fmt.Errorf("%s and %s both have the output path %s", other, doc.path, path)
+		}
+		from[path] = doc.path
+		return nil
+	}
+	for i, doc := range docs {
+		if paths[i], err = outputPath(doc, opts); err != nil {
+			return nil, err
+		}
+		if err := claim(paths[i], doc); err != nil {
+			return nil, err
+		}
+		if examples[i] != nil {
+			if err := claim(examplesPath(paths[i]), doc); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range opts.OutputFormats {
+			if err := claim(formatPath(paths[i], f), doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	emit := func(path string, data []byte, doc *document) error {
+		out, err := encodeSchemaFile(path, data)
+		if err != nil {
+			return fmt.Errorf("compress %s: %w", path, err)
+		}
+		updates[path] = out
+
+		// Write back if possible
+		if writer != nil {
+			info, statErr := fs.Stat(fsys, doc.path)
+			perm := fs.FileMode(0644)
+			if statErr == nil {
+				perm = info.Mode().Perm()
+			}
+			if err := writer.WriteFile(path, out, perm); err != nil {
+				return fmt.Errorf("write %s: %w", path, err)
+			}
+			opts.logger().Debug("Wrote file", "path", path)
+		}
+		return nil
+	}
+	for i, doc := range docs {
+		opts.Report.addFile(sizes[i], len(outs[i]))
+		if err := emit(paths[i], outs[i], doc); err != nil {
+			return nil, err
+		}
+		if examples[i] != nil {
+			if err := emit(examplesPath(paths[i]), examples[i], doc); err != nil {
+				return nil, err
+			}
+		}
+		for j, f := range opts.OutputFormats {
+			if err := emit(formatPath(paths[i], f), formats[i][j], doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return updates, nil
+}
+
+// inlineFile inlines the file doc and marshals the result, along with the
+// examples extracted from it if ExtractExamples is set and there were any,
+// and the result in each of OutputFormats.
+func (in *inliner) inlineFile(doc *document) (out, examples []byte, formats [][]byte, err error) {
+	resolved, err := in.resolveDocument(doc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("inline refs in %s: %w", doc.path, err)
+	}
+	if in.opts.ExtractExamples && !in.opts.FormatOnly {
+		ex, err := extractExamples(resolved, in.opts.maxDepth())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("extract examples of %s: %w", doc.path, err)
+		}
+		if ex != nil {
+			if examples, err = marshalSchema(ex, Options{Indent: in.opts.Indent, LineEnding: in.opts.LineEnding, Marshaler: in.opts.Marshaler}); err != nil {
+				return nil, nil, nil, fmt.Errorf("marshal examples of %s: %w", doc.path, err)
+			}
+		}
+	}
+	if out, err = in.marshalDocument(doc, resolved); err != nil {
+		return nil, nil, nil, fmt.Errorf("marshal %s: %w", doc.path, err)
+	}
+	for _, f := range in.opts.OutputFormats {
+		b, err := marshalFile(doc, resolved, formatOptions(f, in.opts))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("marshal %s as %s: %w", doc.path, f.Suffix, err)
+		}
+		formats = append(formats, b)
+	}
+	in.opts.logger().Debug("Inlined file", "path", doc.path, "bytes", len(out))
+	return out, examples, formats, nil
+}
+
+// marshalDocument marshals resolved, the inlined root of doc, splicing it into
+// the source of doc with PreserveFormatting.
+func (in *inliner) marshalDocument(doc *document, resolved any) ([]byte, error) {
+	if doc.src != nil && !in.opts.FormatOnly {
+		out, ok, err := spliceSource(doc.src, resolved, in.opts)
+		if ok || err != nil {
+			return out, err
+		}
+	}
+	return marshalFile(doc, resolved, in.opts)
+}
+
+// marshalFile marshals resolved, the inlined root of the file doc, as one
+// schema per line if doc is NDJSON and as a single schema otherwise.
+func marshalFile(doc *document, resolved any, opts Options) ([]byte, error) {
+	if elems, ok := resolved.([]any); ok && doc.lines != nil {
+		return marshalNDJSON(elems, opts)
+	}
+	return marshalSchema(resolved, opts)
+}
+
+// outputPath returns the path the output for doc is keyed by: its own, or one
+// derived from its $id with OutputPathFromID.
+func outputPath(doc *document, opts Options) (string, error) {
+	if !opts.OutputPathFromID {
+		return doc.path, nil
+	}
+	if doc.id == "" {
+		return "", fmt.Errorf("%s has no absolute $id to derive an output path from", doc.path)
+	}
+
+	var rest string
+	ok := true
+	if opts.IDBaseURL != "" {
+		rest, ok = strings.CutPrefix(doc.id, opts.IDBaseURL)
+	} else if u, err := url.Parse(doc.id); err == nil {
+		rest = u.Path
+	}
+	p := path.Clean(strings.TrimPrefix(rest, "/"))
+	if !ok || rest == "" || p == "." || !fs.ValidPath(p) {
+		return "", fmt.Errorf("$id %q of %s has no usable path under %q", doc.id, doc.path, opts.IDBaseURL)
+	}
+	if !strings.HasSuffix(strings.ToLower(p), ".json") {
+		p += ".json"
+	}
+	if isGzip(doc.path) {
+		p += gzipExt
+	}
+	return p, nil
+}
+
+// InlineSchemaBytes inlines and cleans up a single in-memory schema document
+// the same way InlineBundledSchemasInFS does for each file. Cross-file refs
+// are loaded from Options.FS, relative to Options.BasePath.
+func InlineSchemaBytes(b []byte, options ...Option) ([]byte, error) {
+	opts := buildOptions(options)
+	root, err := parseSource(b, opts.Dialect)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	resolved, err := ResolveDocument(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	spliced := false
+	if opts.PreserveFormatting && !opts.FormatOnly {
+		out, spliced, err = spliceSource(b, resolved, opts)
+	}
+	if !spliced && err == nil {
+		out, err = marshalSchema(resolved, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	opts.Report.addFile(len(b), len(out))
+	return out, nil
+}
+
+// ResolveDocument is InlineSchemaBytes for an already parsed document, as
+// produced by encoding/json. It returns the inlined and cleaned up tree without
+// marshaling it. root is not modified.
+func ResolveDocument(root any, options ...Option) (any, error) {
+	opts := buildOptions(options)
+	in := newInliner(opts)
+	root, err := in.prepareRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	doc := newDocument("", root)
+	doc.dir = opts.BasePath
+	resolved, err := in.resolveDocument(doc)
+	if err != nil {
+		return nil, fmt.Errorf("inline refs: %w", err)
+	}
+	return resolved, nil
+}
+
+// InlineFragment is ResolveDocument for fragment, a part of the already parsed
+// document root such as one of its $defs entries. Refs in fragment resolve
+// against root as if fragment were still in place, without inlining the rest
+// of root, so parts of a large document can be inlined on demand. The result
+// is cleaned up like a document of its own, with root's $schema and any $defs
+// entries that options such as KeepDefs keep. Neither fragment nor root is
+// modified.
+func InlineFragment(fragment, root any, options ...Option) (any, error) {
+	opts := buildOptions(options)
+	in := newInliner(opts)
+	root, err := in.prepareRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if fragment, err = in.prepareRoot(fragment); err != nil {
+		return nil, err
+	}
+	doc := newDocument("", root)
+	doc.dir = opts.BasePath
+	resolved, err := in.resolveNode(doc, fragment)
+	if err != nil {
+		return nil, fmt.Errorf("inline refs: %w", err)
+	}
+	return resolved, nil
+}
+
+// inliner inlines documents one at a time. Inliners forked from the same one
+// share the documents they parse and can run concurrently.
+type inliner struct {
+	opts Options
+	// strip is the set of keys stripped from the output.
+	strip map[string]bool
+	cache *docCache
+
+	// host is the document currently being inlined.
+	host *document
+	// retained lists the host's $defs entries that refs were left pointing
+	// at, in the order they were first seen.
+	retained []string
+	// draftChecked records the host/document pairs whose $schema has already
+	// been compared.
+	draftChecked map[[2]*document]bool
+	// depth is the current nesting depth of inlineRefs.
+	depth int
+
+	// bundle is set by BundleSchema.
+	bundle bool
+	// bundled lists the $defs entries collected in bundle mode, in the order
+	// they were first referenced. bundledNames maps the key of each target to
+	// its name, and bundledKeys the other way around.
+	bundled      []bundledDef
+	bundledNames map[string]string
+	bundledKeys  map[string]string
+}
+
+func newInliner(opts Options) *inliner {
+	in := &inliner{opts: opts, strip: opts.stripSet(), cache: &docCache{docs: map[string]*document{}}}
+	return in.fork()
+}
+
+// fork returns a new inliner sharing in's options and documents.
+func (in *inliner) fork() *inliner {
+	return &inliner{opts: in.opts, strip: in.strip, cache: in.cache, draftChecked: map[[2]*document]bool{}}
+}
+
+// resolveDocument inlines refs in doc and strips the keys that no longer make
+// sense afterwards.
+func (in *inliner) resolveDocument(doc *document) (any, error) {
+	if in.opts.FormatOnly && !in.bundle {
+		return deepClone(doc.root)
+	}
+	if elems, ok := doc.root.([]any); ok {
+		return in.resolveElements(doc, elems)
+	}
+	return in.resolveNode(doc, doc.root)
+}
+
+// resolveNode is resolveDocument for node, doc.root or a part of it, treating
+// node as the root of the result.
+func (in *inliner) resolveNode(doc *document, node any) (any, error) {
+	in.host, in.retained = doc, nil
+	in.bundled, in.bundledNames, in.bundledKeys = nil, map[string]string{}, map[string]string{}
+	if in.opts.InlineExternalOnly || in.opts.KeepDefs {
+		m, _ := doc.root.(map[string]any)
+		defs, _ := m["$defs"].(map[string]any)
+		in.retained = slices.Sorted(maps.Keys(defs))
+	} else if in.opts.RespectInlineMarker {
+		m, _ := doc.root.(map[string]any)
+		defs, _ := m["$defs"].(map[string]any)
+		for _, name := range slices.Sorted(maps.Keys(defs)) {
+			if in.markedNoInline(defs[name]) {
+				in.retained = append(in.retained, name)
+			}
+		}
+	}
+
+	// Inline refs using the original root (which still includes $defs).
+	resolved, err := in.inlineRefs(node, doc, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if isRemoved(resolved) {
+		return nil, errors.New("document root is an unresolved $ref")
+	}
+
+	// Cleanup:
+	// - remove all $id everywhere
+	// - remove all $schema except top-level
+	// - remove all $defs everywhere (except anchored entries, if requested)
+	resolved, err = stripKeys(resolved, in.topSchema(doc, nil), in.strip, in.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Put back the $defs entries that refs were left pointing at.
+	if err := in.restoreRetainedDefs(resolved); err != nil {
+		return nil, err
+	}
+	if err := in.restoreBundledDefs(resolved); err != nil {
+		return nil, err
+	}
+	if in.opts.DedupCombinatorMembers {
+		if err := in.dedupCombinators(resolved); err != nil {
+			return nil, err
+		}
+	}
+	if in.opts.StripAnnotations {
+		if err := stripAnnotations(resolved, in.opts.annotationKeywords(), in.opts.maxDepth()); err != nil {
+			return nil, err
+		}
+	}
+	if resolved, err = stripPaths(resolved, in.opts.StripPaths); err != nil {
+		return nil, err
+	}
+	if in.opts.RequireFullyInlined && !in.bundle {
+		if err := checkFullyInlined(resolved, in.opts.refKeyword(), in.opts.maxDepth()); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// resolveElements resolves a document whose root is an array, as some tools
+// write several schemas to one file, by resolving each element as a schema of
+// its own: local refs like "#/$defs/..." point into the element, and each
+// element keeps its own top-level $schema.
+func (in *inliner) resolveElements(doc *document, elems []any) (any, error) {
+	out := make([]any, len(elems))
+	for i, elem := range elems {
+		// Elements of NDJSON documents are known by their line.
+		where := fmt.Sprintf("element %d", i)
+		if doc.lines != nil {
+			where = fmt.Sprintf("line %d", doc.lines[i])
+		}
+		if _, ok := elem.([]any); ok {
+			return nil, fmt.Errorf("%s is an array, not a schema", where)
+		}
+		el := newDocument(doc.path, elem)
+		el.dir = doc.dir
+		resolved, err := in.resolveDocument(el)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		out[i] = resolved
+	}
+	return out, nil
+}
+
+// marshalSchema pretty-prints a resolved schema.
+func marshalSchema(v any, opts Options) ([]byte, error) {
+	out, err := opts.marshal(outputValue(v, opts))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(out, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return withLineEnding(out, opts.LineEnding)
+}
+
+// outputValue returns the resolved schema v with its numbers formatted and
+// its keywords ordered as opts ask, ready to marshal.
+func outputValue(v any, opts Options) any {
+	v = formatNumbers(v, opts.FormatNumber)
+	if len(opts.KeywordOrder) > 0 {
+		v = orderKeywords(v, keywordRank(opts.KeywordOrder))
+	}
+	return v
+}
+
+// marshalJSON is json.Marshal, but leaving "<", ">" and "&" unescaped.
+func marshalJSON(v any) ([]byte, error) {
+	return marshalIndentJSON(v, "")
+}
+
+// marshalIndentJSON is json.MarshalIndent without a prefix, but leaving "<",
+// ">" and "&" unescaped.
+func marshalIndentJSON(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// withLineEnding converts the LF line endings of marshaled JSON to le. Newlines
+// within strings are escaped by the encoder, so every "\n" is a line break.
+func withLineEnding(b []byte, le LineEnding) ([]byte, error) {
+	switch le {
+	case "", LineEndingLF:
+		return b, nil
+	case LineEndingAuto:
+		if runtime.GOOS != "windows" {
+			return b, nil
+		}
+	case LineEndingCRLF:
+	default:
+		return nil, fmt.Errorf("unknown line ending %q", le)
+	}
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n")), nil
+}
+
+// inlineRefs replaces every $ref in node with its target. Refs are resolved
+// against doc, the document node belongs to, where node is at the JSON
+// Pointer ptr; stack holds the keys of the refs currently being expanded so
+// cycles can be reported.
+func (in *inliner) inlineRefs(node any, doc *document, ptr string, stack []string) (any, error) {
+	opts := in.opts
+	in.depth++
+	defer func() { in.depth-- }()
+	if in.depth > opts.maxDepth() {
+		return nil, errMaxDepth(opts.maxDepth())
+	}
+	switch v := node.(type) {
+	case map[string]any:
+		// Refs within a schema declaring its own $id resolve against it.
+		if _, ok := v["$id"].(string); ok && ptr != doc.scope {
+			doc = embeddedDocument(doc, v, ptr)
+		}
+		if dyn, ok := v["$dynamicRef"]; ok {
+			if err := in.dynamicRef(dyn); err != nil {
+				return nil, err
+			}
+		}
+		// If this object has a $ref, inline it (local refs only).
+		if refVal, ok := v[opts.refKeyword()]; ok {
+			refStr, ok := refVal.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string, got %T", opts.refKeyword(), refVal)
+			}
+			refStr, err := opts.rewriteRef(refStr)
+			if err != nil {
+				return nil, err
+			}
+
+			target, err := in.resolveRef(refStr, doc)
+			if err != nil {
+				return in.missingRef(v, refStr, err, doc, ptr, stack)
+			}
+			opts.Report.addResolved(in.host.path, doc.path+"#"+ptr, refStr, target.key())
+			if in.bundles(target) {
+				bundled, err := in.bundleRef(target)
+				if err != nil {
+					return nil, err
+				}
+				opts.logger().Debug("Bundled $ref", "path", in.host.path, "ref", refStr, "target", target.key(), "as", bundled)
+				return in.keepRef(v, bundled, doc, ptr, stack)
+			}
+			inline, err := opts.shouldInline(refStr)
+			if err != nil {
+				return nil, err
+			}
+			key := target.key()
+			if !inline || in.keepsLocal(target) || in.markedNoInline(target.value) || (opts.InlineMaxRefHops > 0 && len(stack) >= opts.InlineMaxRefHops) {
+				opts.logger().Debug("Left $ref in place", "path", in.host.path, "ref", refStr, "target", key)
+				in.retain(target)
+				return in.keepRef(v, in.relativeRef(target), doc, ptr, stack)
+			}
+			in.checkDraft(target.doc)
+			if i := slices.Index(stack, key); i >= 0 {
+				if opts.PreserveRecursiveRefs {
+					opts.logger().Debug("Left recursive $ref in place", "path", in.host.path, "ref", refStr, "target", key)
+					opts.Report.addCycle(stack[i:])
+					in.retain(target)
+					return in.keepRef(v, in.relativeRef(target), doc, ptr, stack)
+				}
+				return nil, fmt.Errorf("cyclic %s detected: %s", opts.refKeyword(), strings.Join(append(stack, key), " -> "))
+			}
+			opts.logger().Debug("Inlining $ref", "path", in.host.path, "ref", refStr, "target", key)
+
+			// Resolve the target first, against the document it came from.
+			clone, err := deepClone(target.value)
+			if err != nil {
+				return nil, fmt.Errorf("copy target of $ref %q: %w", refStr, err)
+			}
+			resolvedTarget, err := in.inlineRefs(clone, target.doc, target.frag, append(stack, key))
+			if err != nil {
+				return nil, err
+			}
+			if isRemoved(resolvedTarget) {
+				return resolvedTarget, nil
+			}
+			size := 0
+			if opts.Report != nil && opts.MeasureInlined {
+				b, _ := json.Marshal(resolvedTarget)
+				size = len(b)
+			}
+			opts.Report.addInlined(key, size)
+
+			// Resolve siblings (everything except $ref and $defs) and merge (siblings win).
+			siblings := make(map[string]any, len(v))
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				child := v[k]
+				if k == opts.refKeyword() || k == "$defs" {
+					continue
+				}
+				resolvedChild, err := in.inlineRefs(child, doc, ptr+"/"+escapeToken(k), stack)
+				if err != nil {
+					return nil, err
+				}
+				if removed, err := droppedChild(resolvedChild, k, ptr); err != nil {
+					return nil, err
+				} else if removed {
+					continue
+				}
+				siblings[k] = resolvedChild
+			}
+
+			// Merge if both are objects.
+			if rm, ok := resolvedTarget.(map[string]any); ok {
+				if err := in.checkConflicts(refStr, rm, siblings); err != nil {
+					return nil, err
+				}
+				out := make(map[string]any, len(rm)+len(siblings))
+				for k, val := range rm {
+					if k == "$defs" {
+						in.markStripped(out, k)
+						continue
+					}
+					out[k] = val
+				}
+				if opts.AnnotateProvenance {
+					// Keep the target's own comment and note the ref after it.
+					if c, ok := out["$comment"].(string); ok && c != "" {
+						out["$comment"] = c + " (inlined from " + refStr + ")"
+					} else {
+						out["$comment"] = "inlined from " + refStr
+					}
+				}
+				if name, ok := defName(target.frag); ok && opts.InjectTitleFromDefName && out["title"] == nil && target.frag == "/$defs/"+escapeToken(name) {
+					out["title"] = name
+				}
+				// Siblings replace keywords from the target wholesale, so
+				// "type": ["string", "null"] overridden by "type": "string" is
+				// just "string", unless the types or arrays should be unioned.
+				for k, val := range siblings {
+					out[k] = val
+				}
+				if opts.MergeArrays {
+					for k := range mergeableArrayKeywords {
+						if a, b, ok := bothArrays(rm[k], siblings[k]); ok {
+							out[k] = unionArrays(a, b)
+						}
+					}
+				}
+				if t, ok := siblings["type"]; ok && opts.UnionTypes {
+					if tt, ok := rm["type"]; ok {
+						out["type"] = unionTypes(tt, t)
+					}
+				}
+				return in.trace(doc, refStr, key, siblings, out), nil
+			}
+
+			// A true target is the empty schema, which the siblings narrow
+			// down to themselves. Nothing widens a false one.
+			if b, ok := resolvedTarget.(bool); ok && len(siblings) > 0 {
+				if opts.WrapBooleanTargets {
+					return in.trace(doc, refStr, key, siblings, wrapBoolean(b, siblings)), nil
+				}
+				if b {
+					return in.trace(doc, refStr, key, siblings, siblings), nil
+				}
+			}
+
+			// If resolved target isn't an object, return it (siblings can't reliably merge).
+			return in.trace(doc, refStr, key, siblings, resolvedTarget), nil
+		}
+
+		// Normal object: recursively resolve all keys, skipping "$defs" unless
+		// anchored entries must be kept. Keys are visited in order so the
+		// first error and the log lines don't depend on map iteration.
+		out := make(map[string]any, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			child := v[k]
+			if k == "$defs" {
+				if !opts.KeepAnchoredDefs {
+					in.markStripped(out, k)
+					continue
+				}
+				defs := anchoredDefs(child)
+				if defs == nil {
+					in.markStripped(out, k)
+					continue
+				}
+				child = defs
+			}
+			resolvedChild, err := in.inlineRefs(child, doc, ptr+"/"+escapeToken(k), stack)
+			if err != nil {
+				return nil, err
+			}
+			if removed, err := droppedChild(resolvedChild, k, ptr); err != nil {
+				return nil, err
+			} else if removed {
+				continue
+			}
+			out[k] = resolvedChild
+		}
+		return out, nil
+
+	case []any:
+		out := make([]any, len(v))
+		for i := range v {
+			r, err := in.inlineRefs(v[i], doc, ptr+"/"+strconv.Itoa(i), stack)
+			if err != nil {
+				return nil, err
+			}
+			if isRemoved(r) {
+				r = true
+			}
+			out[i] = r
+		}
+		return out, nil
+
+	default:
+		return node, nil
+	}
+}
+
+// checkFullyInlined returns an error listing the refs left in root, by
+// refKeyword or $dynamicRef, if any.
+func checkFullyInlined(root any, refKeyword string, max int) error {
+	var left []string
+	err := walkSchemas(root, "", max, func(m map[string]any, ptr string) {
+		for _, k := range []string{refKeyword, "$dynamicRef"} {
+			if ref, ok := m[k].(string); ok {
+				left = append(left, fmt.Sprintf("%q at %q", ref, "#"+ptr))
+			}
+		}
+	})
+	if err != nil || len(left) == 0 {
+		return err
+	}
+	slices.Sort(left)
+	return fmt.Errorf("not fully inlined, $refs remain: %s", strings.Join(left, ", "))
+}
+
+// keepsLocal reports whether a ref to target stays in place because it points
+// into the host under InlineExternalOnly, or into its $defs under KeepDefs.
+func (in *inliner) keepsLocal(target refTarget) bool {
+	if target.doc != in.host {
+		return false
+	}
+	_, isDef := defName(target.frag)
+	return in.opts.InlineExternalOnly || (in.opts.KeepDefs && isDef)
+}
+
+// markedNoInline reports whether node opts out of inlining with
+// RespectInlineMarker.
+func (in *inliner) markedNoInline(node any) bool {
+	m, ok := node.(map[string]any)
+	return ok && in.opts.RespectInlineMarker && m[in.opts.inlineMarker()] == false
+}
+
+// checkConflicts applies the DetectConflicts policy to the siblings of ref that
+// replace a keyword of its resolved target with a different value.
+func (in *inliner) checkConflicts(ref string, target, siblings map[string]any) error {
+	policy := in.opts.DetectConflicts
+	switch policy {
+	case "", ConflictIgnore:
+		return nil
+	case ConflictWarn, ConflictError:
+	default:
+		return fmt.Errorf("unknown conflict policy %q", policy)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(siblings)) {
+		if annotationKeywords[k] || (k == "type" && in.opts.UnionTypes) || (mergeableArrayKeywords[k] && in.opts.MergeArrays) {
+			continue
+		}
+		tv, ok := target[k]
+		if !ok {
+			continue
+		}
+		a, b := canonicalJSON(tv), canonicalJSON(siblings[k])
+		if bytes.Equal(a, b) {
+			continue
+		}
+		msg := fmt.Sprintf("sibling %q of $ref %q overrides %s from the target with %s", k, ref, a, b)
+		if policy == ConflictError {
+			return errors.New(msg)
+		}
+		in.opts.warn(in.host.path, "%s", msg)
+	}
+	return nil
+}
+
+// shouldInline reports whether ref matches InlineOnly, or true if it's unset.
+func (o Options) shouldInline(ref string) (bool, error) {
+	if len(o.InlineOnly) == 0 {
+		return true, nil
+	}
+	for _, pattern := range o.InlineOnly {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if strings.HasPrefix(ref, pattern) {
+				return true, nil
+			}
+			continue
+		}
+		ok, err := path.Match(pattern, ref)
+		if err != nil {
+			return false, fmt.Errorf("invalid InlineOnly pattern %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// missingRef applies the OnMissingRef policy to node, at ptr in doc, whose
+// $ref couldn't be resolved because of err.
+func (in *inliner) missingRef(node map[string]any, ref string, err error, doc *document, ptr string, stack []string) (any, error) {
+	if !isMissingRef(err) {
+		return nil, err
+	}
+	switch in.opts.OnMissingRef {
+	case "", MissingRefError:
+		return nil, err
+	case MissingRefWarn:
+		in.opts.warn(in.host.path, "left unresolved $ref %q: %v", ref, err)
+		return in.keepRef(node, ref, doc, ptr, stack)
+	case MissingRefRemove:
+		in.opts.warn(in.host.path, "removed unresolved $ref %q: %v", ref, err)
+		return removedNode{}, nil
+	default:
+		return nil, fmt.Errorf("unknown missing ref policy %q", in.opts.OnMissingRef)
+	}
+}
+
+// dynamicRef applies the OnDynamicRef policy to the $dynamicRef ref.
+func (in *inliner) dynamicRef(refVal any) error {
+	ref, ok := refVal.(string)
+	if !ok {
+		return fmt.Errorf("$dynamicRef must be a string, got %T", refVal)
+	}
+	switch in.opts.OnDynamicRef {
+	case "", DynamicRefError:
+		return fmt.Errorf("cannot inline $dynamicRef %q: its target depends on the dynamic scope", ref)
+	case DynamicRefWarn:
+		in.opts.warn(in.host.path, "left $dynamicRef %q in place: its target depends on the dynamic scope", ref)
+		return nil
+	default:
+		return fmt.Errorf("unknown dynamic ref policy %q", in.opts.OnDynamicRef)
+	}
+}
+
+// trace logs the result of inlining ref, found in doc, at LevelTrace and
+// returns it.
+func (in *inliner) trace(doc *document, ref, target string, siblings map[string]any, result any) any {
+	l := in.opts.logger()
+	if !l.Enabled(context.Background(), LevelTrace) {
+		return result
+	}
+	shape, _ := json.Marshal(result)
+	l.Log(context.Background(), LevelTrace, "Resolved $ref",
+		"path", in.host.path, "doc", doc.path, "ref", ref, "target", target,
+		"siblings", slices.Sorted(maps.Keys(siblings)), "result", string(shape))
+	return result
+}
+
+// removedNode stands in for a node that should be dropped from its parent.
+type removedNode struct{}
+
+func isRemoved(v any) bool {
+	_, ok := v.(removedNode)
+	return ok
+}
+
+// droppedChild reports whether child, the resolved value of the key k of the
+// object at ptr, was removed and should be left out of the object. Leaving
+// out "not" would lift its constraint, so that's an error.
+func droppedChild(child any, k, ptr string) (bool, error) {
+	if !isRemoved(child) {
+		return false, nil
+	}
+	if k == "not" {
+		return false, fmt.Errorf("can't remove the unresolved $ref at %q: dropping \"not\" would lift its constraint", "#"+ptr+"/not")
+	}
+	return true, nil
+}
+
+// keepRef leaves node's $ref as ref rather than inlining it, while still
+// inlining its siblings. node is at ptr in doc.
+func (in *inliner) keepRef(node map[string]any, ref string, doc *document, ptr string, stack []string) (any, error) {
+	out := make(map[string]any, len(node))
+	for _, k := range slices.Sorted(maps.Keys(node)) {
+		child := node[k]
+		if k == "$defs" {
+			in.markStripped(out, k)
+			continue
 		}
-		if !strings.HasSuffix(strings.ToLower(d.Name()), ".json") {
-			return nil
+		if k == in.opts.refKeyword() {
+			out[k] = ref
+			continue
 		}
-
-		b, err := fs.ReadFile(fsys, path)
+		resolvedChild, err := in.inlineRefs(child, doc, ptr+"/"+escapeToken(k), stack)
 		if err != nil {
-			return fmt.Errorf("read %s: %w", path, err)
+			return nil, err
 		}
-
-		var root any
-		if err := json.Unmarshal(b, &root); err != nil {
-			return fmt.Errorf("parse %s: %w", path, err)
+		if removed, err := droppedChild(resolvedChild, k, ptr); err != nil {
+			return nil, err
+		} else if removed {
+			continue
 		}
+		out[k] = resolvedChild
+	}
+	return out, nil
+}
 
-		// Inline refs using the original root (which still includes $defs).
-		resolved, err := inlineRefs(root, root, nil)
-		if err != nil {
-			return fmt.Errorf("inline refs in %s: %w", path, err)
-		}
+// markStripped leaves k, a key that's dropped from the output, in out with a
+// nil value when PruneEmptyObjects is set, so stripKeys can tell objects it
+// leaves empty from objects that were empty to begin with.
+func (in *inliner) markStripped(out map[string]any, k string) {
+	if in.opts.PruneEmptyObjects {
+		out[k] = nil
+	}
+}
 
-		// Cleanup:
-		// - remove all $id everywhere
-		// - remove all $schema except top-level
-		// - remove all $defs everywhere
-		resolved = stripKeys(resolved, true /*keepTopLevelSchema*/)
+// retain records that a ref to target is left in the output, so the host's
+// $defs entry it points into must be kept.
+func (in *inliner) retain(target refTarget) {
+	if name, ok := defName(target.frag); ok && target.doc == in.host && !slices.Contains(in.retained, name) {
+		in.retained = append(in.retained, name)
+	}
+}
 
-		out, err := json.MarshalIndent(resolved, "", "  ")
+// restoreRetainedDefs inlines the host's retained $defs entries and adds them
+// to the $defs of the cleaned-up root. Inlining an entry may retain more.
+func (in *inliner) restoreRetainedDefs(root any) error {
+	if len(in.retained) == 0 {
+		return nil
+	}
+	m, ok := root.(map[string]any)
+	if !ok {
+		return fmt.Errorf("cannot keep $defs in a document of type %T", root)
+	}
+	defs, _ := m["$defs"].(map[string]any)
+	if defs == nil {
+		defs = map[string]any{}
+	}
+	for i := 0; i < len(in.retained); i++ {
+		name := in.retained[i]
+		if _, ok := defs[name]; ok {
+			continue
+		}
+		target, err := getByPointer(in.host.root, "#/$defs/"+escapeToken(name), in.cache)
 		if err != nil {
-			return fmt.Errorf("marshal %s: %w", path, err)
+			return err
 		}
-		out = append(out, '\n')
-
-		updates[filepath.ToSlash(path)] = out
-
-		// Write back if possible
-		if writer != nil {
-			info, statErr := fs.Stat(fsys, path)
-			perm := fs.FileMode(0644)
-			if statErr == nil {
-				perm = info.Mode().Perm()
-			}
-			if err := writer.WriteFile(path, out, perm); err != nil {
-				return fmt.Errorf("write %s: %w", path, err)
-			}
+		clone, err := deepClone(target)
+		if err != nil {
+			return fmt.Errorf("copy $defs entry %q: %w", name, err)
+		}
+		frag := "/$defs/" + escapeToken(name)
+		var stack []string
+		if in.opts.PreserveRecursiveRefs {
+			// Start from the entry itself, so a cycle back to it ends in a
+			// ref to the entry rather than in another copy of it.
+			stack = []string{refTarget{doc: in.host, frag: frag}.key()}
+		}
+		resolved, err := in.inlineRefs(clone, in.host, frag, stack)
+		if err != nil {
+			return err
+		}
+		if isRemoved(resolved) {
+			continue
+		}
+		if defs[name], err = stripKeysRecursive(resolved, in.strip, in.opts, 2); err != nil {
+			return err
 		}
+	}
+	m["$defs"] = defs
+	return nil
+}
 
+// topSchema returns the $schema declared at the top level of doc or, if doc is
+// just a ref to a whole document, at the top level of that document, so
+// merging the target of a root $ref never promotes a nested $schema to the top
+// level. seen guards against cycles of such documents.
+func (in *inliner) topSchema(doc *document, seen []*document) any {
+	m, ok := doc.root.(map[string]any)
+	if !ok || slices.Contains(seen, doc) {
 		return nil
-	})
+	}
+	if s, ok := m["$schema"]; ok {
+		return s
+	}
+	ref, ok := m[in.opts.refKeyword()].(string)
+	if !ok {
+		return nil
+	}
+	ref, err := in.opts.rewriteRef(ref)
+	if err != nil {
+		return nil
+	}
+	target, err := in.resolveRef(ref, doc)
+	if err != nil || target.frag != "" || target.doc == doc {
+		return nil
+	}
+	return in.topSchema(target.doc, append(seen, doc))
+}
 
+// stripKeys removes:
+// - all strip keys everywhere, by default "$id" and "$schema"
+// - all "$defs" fields everywhere, except entries declaring an $anchor when
+// opts.KeepAnchoredDefs is set
+// and then sets the top-level "$schema" to topSchema, unless it's nil.
+func stripKeys(node any, topSchema any, strip map[string]bool, opts Options) (any, error) {
+	cleaned, err := stripKeysRecursive(node, strip, opts, 0)
 	if err != nil {
 		return nil, err
 	}
-	return updates, nil
+
+	if topSchema != nil {
+		if m, ok := cleaned.(map[string]any); ok {
+			m["$schema"] = topSchema
+		}
+	}
+
+	return cleaned, nil
 }
 
-func inlineRefs(node any, root any, stack []string) (any, error) {
+func stripKeysRecursive(node any, strip map[string]bool, opts Options, depth int) (any, error) {
+	if depth >= opts.maxDepth() {
+		return nil, errMaxDepth(opts.maxDepth())
+	}
+	var err error
 	switch v := node.(type) {
 	case map[string]any:
-		// If this object has a $ref, inline it (local refs only).
-		if refVal, ok := v["$ref"]; ok {
-			refStr, ok := refVal.(string)
-			if !ok {
-				return nil, fmt.Errorf("$ref must be a string, got %T", refVal)
-			}
-			if contains(stack, refStr) {
-				return nil, fmt.Errorf("cyclic $ref detected: %s", strings.Join(append(stack, refStr), " -> "))
-			}
-
-			target, err := getByPointer(root, refStr)
-			if err != nil {
-				return nil, err
-			}
-
-			// Resolve the target first.
-			resolvedTarget, err := inlineRefs(deepClone(target), root, append(stack, refStr))
-			if err != nil {
-				return nil, err
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			if k == "$defs" && opts.KeepAnchoredDefs {
+				if defs := anchoredDefs(child); defs != nil {
+					if out[k], err = stripNamedSchemas(defs, strip, opts, depth+1); err != nil {
+						return nil, err
+					}
+				}
+				continue
 			}
-
-			// Resolve siblings (everything except $ref and $defs) and merge (siblings win).
-			siblings := make(map[string]any, len(v))
-			for k, child := range v {
-				if k == "$ref" || k == "$defs" {
+			// Remove everywhere:
+			if strip[k] {
+				if k != "$id" || depth == 0 {
 					continue
 				}
-				resolvedChild, err := inlineRefs(child, root, stack)
+				keep, err := checkStrippedID(v, opts)
 				if err != nil {
 					return nil, err
 				}
-				siblings[k] = resolvedChild
-			}
-
-			// Merge if both are objects.
-			if rm, ok := resolvedTarget.(map[string]any); ok {
-				out := make(map[string]any, len(rm)+len(siblings))
-				for k, val := range rm {
-					if k == "$defs" {
-						continue
-					}
-					out[k] = val
-				}
-				for k, val := range siblings {
-					out[k] = val
+				if !keep {
+					continue
 				}
-				return out, nil
 			}
-
-			// If resolved target isn't an object, return it (siblings can't reliably merge).
-			return resolvedTarget, nil
-		}
-
-		// Normal object: recursively resolve all keys, skipping "$defs".
-		out := make(map[string]any, len(v))
-		for k, child := range v {
-			if k == "$defs" {
-				continue
+			var cleaned any
+			if subs, ok := child.(map[string]any); ok && schemaMapKeywords[k] {
+				cleaned, err = stripNamedSchemas(subs, strip, opts, depth+1)
+			} else {
+				cleaned, err = stripKeysRecursive(child, strip, opts, depth+1)
 			}
-			resolvedChild, err := inlineRefs(child, root, stack)
 			if err != nil {
 				return nil, err
 			}
-			out[k] = resolvedChild
+			if opts.PruneEmptyObjects && emptiedObject(child, cleaned) {
+				continue
+			}
+			out[k] = cleaned
 		}
 		return out, nil
-
 	case []any:
 		out := make([]any, len(v))
 		for i := range v {
-			r, err := inlineRefs(v[i], root, stack)
-			if err != nil {
+			if out[i], err = stripKeysRecursive(v[i], strip, opts, depth+1); err != nil {
 				return nil, err
 			}
-			out[i] = r
 		}
 		return out, nil
-
 	default:
 		return node, nil
 	}
 }
 
-// stripKeys removes:
-// - all "$id" fields everywhere
-// - all "$schema" fields except top-level (if keepTopLevelSchema==true)
-// - all "$defs" fields everywhere
-func stripKeys(node any, keepTopLevelSchema bool) any {
-	// Capture the original top-level $schema if we want to preserve it.
-	var topSchema any
-	if keepTopLevelSchema {
-		if m, ok := node.(map[string]any); ok {
-			if v, exists := m["$schema"]; exists {
-				topSchema = v
-			}
-		}
+// stripNamedSchemas is stripKeysRecursive for the value of a keyword like
+// "properties", at depth, whose keys are names rather than keywords, so a
+// property named "$schema" isn't stripped.
+func stripNamedSchemas(m map[string]any, strip map[string]bool, opts Options, depth int) (map[string]any, error) {
+	if depth >= opts.maxDepth() {
+		return nil, errMaxDepth(opts.maxDepth())
 	}
-
-	cleaned := stripKeysRecursive(node)
-
-	// Restore top-level $schema only (if it existed).
-	if keepTopLevelSchema && topSchema != nil {
-		if m, ok := cleaned.(map[string]any); ok {
-			m["$schema"] = topSchema
+	out := make(map[string]any, len(m))
+	for name, sub := range m {
+		cleaned, err := stripKeysRecursive(sub, strip, opts, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if opts.PruneEmptyObjects && emptiedObject(sub, cleaned) {
+			continue
 		}
+		out[name] = cleaned
 	}
+	return out, nil
+}
 
-	return cleaned
+// checkStrippedID reports whether the $id of the nested schema m must be kept
+// because a relative $ref beneath it resolves against it, per SafeStrip, or
+// returns an error if it can't be kept. Fragment refs left in place are
+// written against the file, so the $id can't be kept above any.
+func checkStrippedID(m map[string]any, opts Options) (bool, error) {
+	id, ok := m["$id"].(string)
+	if !ok || strings.HasPrefix(id, "#") {
+		// A plain-name fragment is an anchor, not a base URI.
+		return false, nil
+	}
+	ref, ok, err := findRelativeRef(m, opts.refKeyword(), false, opts.maxDepth())
+	if err != nil || !ok {
+		return false, err
+	}
+	if !opts.SafeStrip {
+		return false, fmt.Errorf("stripping $id %q would change what the relative $ref %q beneath it resolves to", id, ref)
+	}
+	frag, ok, err := findRelativeRef(m, opts.refKeyword(), true, opts.maxDepth())
+	if err != nil || !ok {
+		return true, err
+	}
+	return false, fmt.Errorf("keeping $id %q for the relative $ref %q beneath it would change what the $ref %q resolves to", id, ref, frag)
 }
 
-func stripKeysRecursive(node any) any {
-	switch v := node.(type) {
-	case map[string]any:
-		out := make(map[string]any, len(v))
-		for k, child := range v {
-			// Remove everywhere:
-			if k == "$id" || k == "$defs" || k == "$schema" {
-				continue
-			}
-			out[k] = stripKeysRecursive(child)
+// findRelativeRef returns a relative ref by refKeyword within node, a bare
+// fragment if fragment is set and any other relative ref if it isn't, picking
+// the one that sorts first so errors are deterministic.
+func findRelativeRef(node any, refKeyword string, fragment bool, max int) (string, bool, error) {
+	var found []string
+	err := walkSchemas(node, "", max, func(m map[string]any, _ string) {
+		ref, ok := m[refKeyword].(string)
+		if !ok || strings.HasPrefix(ref, "#") != fragment {
+			return
 		}
-		return out
-	case []any:
-		out := make([]any, len(v))
-		for i := range v {
-			out[i] = stripKeysRecursive(v[i])
+		if u, err := url.Parse(ref); err == nil && !u.IsAbs() {
+			found = append(found, ref)
 		}
-		return out
-	default:
-		return node
+	})
+	if err != nil || len(found) == 0 {
+		return "", false, err
+	}
+	slices.Sort(found)
+	return found[0], true, nil
+}
+
+// emptiedObject reports whether stripping turned the non-empty object before
+// into the empty object after.
+func emptiedObject(before, after any) bool {
+	b, ok := before.(map[string]any)
+	if !ok || len(b) == 0 {
+		return false
 	}
+	a, ok := after.(map[string]any)
+	return ok && len(a) == 0
 }
 
 // getByPointer resolves a local JSON Pointer against root.
-// Supports pointers like "#/a/b" (commonly "#/$defs/Name").
+// Supports pointers like "#/a/b" (commonly "#/$defs/Name"). Empty reference
+// tokens are rejected.
 // Implements JSON Pointer unescaping: ~1 => /, ~0 => ~
-func getByPointer(root any, ptr string) (any, error) {
+// The parsed pointer is kept in cache, if it's not nil.
+func getByPointer(root any, ptr string, cache *docCache) (any, error) {
+	return lookupPointer(root, ptr, true, cache)
+}
+
+// parsePointer returns the unescaped reference tokens of ptr, a local JSON
+// Pointer starting with "#/", from cache if it's not nil and has them. The
+// result is shared and must not be modified.
+func parsePointer(ptr string, cache *docCache) ([]string, error) {
+	if cache != nil {
+		if toks, ok := cache.pointers.Load(ptr); ok {
+			return toks.([]string), nil
+		}
+	}
 	if !strings.HasPrefix(ptr, "#/") {
 		return nil, fmt.Errorf("only local refs supported, got: %q", ptr)
 	}
+	toks := strings.Split(ptr[len("#/"):], "/")
+	for i, raw := range toks {
+		if strings.Contains(raw, "~") {
+			toks[i] = unescapeToken(raw)
+		}
+	}
+	if cache != nil {
+		cache.pointers.Store(ptr, toks)
+	}
+	return toks, nil
+}
 
-	path := strings.TrimPrefix(ptr, "#/")
-	if path == "" {
-		return root, nil
+// lookupPointer is getByPointer, explaining why a key is missing if hint is
+// set. Hints look up other pointers without hints themselves, so they can't
+// recurse.
+func lookupPointer(root any, ptr string, hint bool, cache *docCache) (any, error) {
+	toks, err := parsePointer(ptr, cache)
+	if err != nil {
+		return nil, err
 	}
-	parts := strings.Split(path, "/")
 
 	cur := root
-	for _, raw := range parts {
-		p := strings.ReplaceAll(raw, "~1", "/")
-		p = strings.ReplaceAll(p, "~0", "~")
+	for i, p := range toks {
+		// Empty keys are legal JSON Pointer but in practice come from typos
+		// like "#/$defs/" or "#//x".
+		if p == "" {
+			return nil, fmt.Errorf("invalid JSON Pointer %q: empty reference token", ptr)
+		}
 
+		// Whether a token is an index or a key depends only on the value
+		// it's applied to, as RFC 6901 specifies, so "2" is a key of an
+		// object even where it could be an index.
+		if arr, ok := cur.([]any); ok {
+			// "-" is the index past the end of an array, for adding to it.
+			if p == "-" {
+				return nil, fmt.Errorf("pointer %q: '-' token is not valid in a reference pointer, it only appends to an array", ptr)
+			}
+			idx, err := arrayIndex(p)
+			if err != nil {
+				return nil, fmt.Errorf("pointer %q: %w", ptr, err)
+			}
+			if idx >= len(arr) {
+				return nil, &missingRefError{fmt.Sprintf("unresolved $ref %q: index %d out of range of an array of %d", ptr, idx, len(arr))}
+			}
+			cur = arr[idx]
+			continue
+		}
 		obj, ok := cur.(map[string]any)
 		if !ok {
-			return nil, fmt.Errorf("pointer %q: encountered non-object at %q (got %T)", ptr, p, cur)
+			return nil, fmt.Errorf("pointer %q: encountered non-container at %q (got %T)", ptr, p, cur)
 		}
 		next, ok := obj[p]
 		if !ok {
-			return nil, fmt.Errorf("unresolved $ref %q: missing key %q", ptr, p)
+			var why string
+			if hint {
+				// Hints rebuild pointers, so they work on the escaped tokens.
+				parts := strings.Split(ptr[len("#/"):], "/")
+				why = dotPathHint(root, obj, parts, i)
+				if why == "" {
+					why = defsKeywordHint(root, parts[:i+1], parts[i+1:])
+				}
+			}
+			return nil, &missingRefError{fmt.Sprintf("unresolved $ref %q: missing key %q%s", ptr, p, why)}
 		}
 		cur = next
 	}
 	return cur, nil
 }
 
-func contains(stack []string, s string) bool {
-	for _, x := range stack {
-		if x == s {
-			return true
+// arrayIndex parses the JSON Pointer token tok as an index into an array: a
+// decimal number without leading zeros.
+func arrayIndex(tok string) (int, error) {
+	valid := tok != "" && strings.Trim(tok, "0123456789") == "" && (tok == "0" || tok[0] != '0')
+	idx, err := strconv.Atoi(tok)
+	if !valid || err != nil {
+		return 0, fmt.Errorf("%q is not an array index", tok)
+	}
+	return idx, nil
+}
+
+// dotPathHint explains a missing dotted token parts[i] of a pointer into root,
+// found missing in obj, if it looks like it was meant as a dot-separated path:
+// the pointer with the token split on "." is suggested if it resolves.
+func dotPathHint(root any, obj map[string]any, parts []string, i int) string {
+	if !strings.Contains(parts[i], ".") {
+		return ""
+	}
+	nested := slices.Concat(parts[:i], strings.Split(parts[i], "."), parts[i+1:])
+	alt := "#/" + strings.Join(nested, "/")
+	if _, err := lookupPointer(root, alt, false, nil); err == nil {
+		return fmt.Sprintf(`; JSON Pointer tokens are separated by "/", did you mean %q?`, alt)
+	}
+	first, _, _ := strings.Cut(parts[i], ".")
+	first = strings.ReplaceAll(strings.ReplaceAll(first, "~1", "/"), "~0", "~")
+	if _, ok := obj[first]; ok {
+		return `; JSON Pointer tokens are separated by "/", not "."`
+	}
+	return ""
+}
+
+// defsKeywordHint suggests a pointer into root for the tokens head and tail,
+// where the last of head is missing, that swaps "definitions" for "$defs" or
+// vice versa in head, if that resolves. Mixing the two up is a common mistake
+// when moving between draft-07 and 2020-12.
+func defsKeywordHint(root any, head, tail []string) string {
+	swap := map[string]string{"definitions": "$defs", "$defs": "definitions"}
+	for j, tok := range head {
+		other, ok := swap[tok]
+		if !ok {
+			continue
+		}
+		alt := "#/" + strings.Join(slices.Concat(head[:j], []string{other}, head[j+1:], tail), "/")
+		if _, err := lookupPointer(root, alt, false, nil); err == nil {
+			return fmt.Sprintf("; the document declares it under %q, did you mean %q?", other, alt)
+		}
+	}
+	return ""
+}
+
+// unionTypes combines two "type" keyword values, each a string or an array of
+// strings, keeping the order they first appear in.
+func unionTypes(a, b any) any {
+	var out []any
+	for _, t := range []any{a, b} {
+		ts, ok := t.([]any)
+		if !ok {
+			ts = []any{t}
+		}
+		for _, t := range ts {
+			if !slices.Contains(out, t) {
+				out = append(out, t)
+			}
+		}
+	}
+	if len(out) == 1 {
+		return out[0]
+	}
+	return out
+}
+
+// dedupCombinators removes the members of each allOf and anyOf in root that are
+// identical to an earlier member, and warns about identical members of oneOf.
+// root is modified.
+func (in *inliner) dedupCombinators(root any) error {
+	return walkSchemas(root, "", in.opts.maxDepth(), func(m map[string]any, ptr string) {
+		for _, k := range []string{"allOf", "anyOf"} {
+			if members, ok := m[k].([]any); ok {
+				m[k] = uniqueSchemas(members)
+			}
+		}
+		if members, ok := m["oneOf"].([]any); ok && len(uniqueSchemas(members)) < len(members) {
+			in.opts.warn(in.host.path, "oneOf at %q has identical members, which no instance can match", "#"+ptr)
+		}
+	})
+}
+
+// stripAnnotations removes the keywords in keys from every schema in root.
+// root is modified.
+func stripAnnotations(root any, keys []string, max int) error {
+	return walkSchemas(root, "", max, func(m map[string]any, _ string) {
+		for _, k := range keys {
+			delete(m, k)
+		}
+	})
+}
+
+// stripPaths removes the locations in root matching any of patterns, as
+// StripPaths describes, and returns root. root is modified.
+func stripPaths(root any, patterns []string) (any, error) {
+	for _, pattern := range patterns {
+		ptr := pattern
+		if strings.HasPrefix(ptr, "/") {
+			ptr = "#" + ptr
+		}
+		toks, err := parsePointer(ptr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid StripPaths pattern %q: %w", pattern, err)
+		}
+		for _, tok := range toks {
+			if tok == "" {
+				return nil, fmt.Errorf("invalid StripPaths pattern %q: empty reference token", pattern)
+			}
+			if _, err := path.Match(tok, ""); err != nil {
+				return nil, fmt.Errorf("invalid StripPaths pattern %q: %w", pattern, err)
+			}
+		}
+		root = deletePath(root, toks)
+	}
+	return root, nil
+}
+
+// deletePath removes what the pointer tokens toks, which may be globs, match
+// in node and returns node. Objects are modified in place, while arrays are
+// copied without the items removed.
+func deletePath(node any, toks []string) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if !matchToken(toks[0], k) {
+				continue
+			}
+			if len(toks) == 1 {
+				delete(v, k)
+				continue
+			}
+			v[k] = deletePath(child, toks[1:])
+		}
+	case []any:
+		out := make([]any, 0, len(v))
+		for i, child := range v {
+			if matchToken(toks[0], strconv.Itoa(i)) {
+				if len(toks) == 1 {
+					continue
+				}
+				child = deletePath(child, toks[1:])
+			}
+			out = append(out, child)
+		}
+		return out
+	}
+	return node
+}
+
+// matchToken reports whether the reference token tok matches pattern, a
+// token that may be a glob. Patterns have been checked to be valid.
+func matchToken(pattern, tok string) bool {
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		return pattern == tok
+	}
+	ok, _ := path.Match(pattern, tok)
+	return ok
+}
+
+// uniqueSchemas returns schemas without those identical to an earlier one.
+func uniqueSchemas(schemas []any) []any {
+	out := make([]any, 0, len(schemas))
+	seen := map[string]bool{}
+	for _, s := range schemas {
+		h := canonicalHash(s)
+		if seen[h] {
+			continue
 		}
+		seen[h] = true
+		out = append(out, s)
 	}
-	return false
+	return out
+}
+
+// wrapBoolean returns the siblings of a $ref to the boolean schema b with b
+// added to their allOf, ahead of any schemas already in it.
+func wrapBoolean(b bool, siblings map[string]any) map[string]any {
+	allOf := []any{b}
+	if existing, ok := siblings["allOf"].([]any); ok {
+		allOf = append(allOf, existing...)
+	}
+	siblings["allOf"] = allOf
+	return siblings
+}
+
+// bothArrays returns a and b as arrays, or false if either isn't one.
+func bothArrays(a, b any) ([]any, []any, bool) {
+	aa, ok := a.([]any)
+	if !ok {
+		return nil, nil, false
+	}
+	ba, ok := b.([]any)
+	return aa, ba, ok
+}
+
+// unionArrays returns the values of a followed by those of b that aren't
+// already present, comparing values as canonical JSON.
+func unionArrays(a, b []any) []any {
+	out := make([]any, 0, len(a)+len(b))
+	seen := map[string]bool{}
+	for _, v := range slices.Concat(a, b) {
+		k := string(canonicalJSON(v))
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// isSchemaFile reports whether name looks like a JSON Schema file, possibly
+// gzipped.
+func isSchemaFile(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), gzipExt)
+	return strings.HasSuffix(name, ".json") || isNDJSON(name)
+}
+
+// isBlank reports whether b holds nothing but whitespace.
+func isBlank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
 }
 
-func deepClone(v any) any {
-	// JSON round-trip clone (fine for schema-sized objects).
-	b, _ := json.Marshal(v)
-	var out any
-	_ = json.Unmarshal(b, &out)
+// anchoredDefs returns the entries of a $defs object that declare an $anchor,
+// or nil if there are none.
+func anchoredDefs(defs any) map[string]any {
+	m, ok := defs.(map[string]any)
+	if !ok {
+		return nil
+	}
+	var out map[string]any
+	for name, def := range m {
+		d, ok := def.(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := d["$anchor"]; !ok {
+			continue
+		}
+		if out == nil {
+			out = map[string]any{}
+		}
+		out[name] = def
+	}
 	return out
 }
+
+// escapeToken escapes a JSON Pointer reference token.
+func escapeToken(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~", "~0"), "/", "~1")
+}
+
+// unescapeToken unescapes a JSON Pointer reference token.
+func unescapeToken(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+}
+
+func deepClone(v any) (any, error) {
+	// JSON round-trip clone (fine for schema-sized objects). Marshaling fails
+	// on cyclic trees.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
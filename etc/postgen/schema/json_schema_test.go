@@ -0,0 +1,2536 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"runtime"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type JSONSchemaTestSuite struct {
+	suite.Suite
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFS() {
+	type test struct {
+		Given    string
+		Opts     Options
+		Expected string
+	}
+
+	tests := map[string]test{
+		"refs within a nested $id resolve against it": {
+			Given: `{
+				"$ref": "#/$defs/A",
+				"$defs": {"A": {"$id": "https://example.com/a", "$defs": {"B": {"type": "string"}}, "properties": {"x": {"$ref": "#/$defs/B"}}}}
+			}`,
+			Expected: `{"properties": {"x": {"type": "string"}}}`,
+		},
+		"ref to a property named $schema": {
+			Given:    `{"properties": {"$schema": {"type": "string"}, "a": {"$ref": "#/properties/$schema"}}}`,
+			Expected: `{"properties": {"$schema": {"type": "string"}, "a": {"type": "string"}}}`,
+		},
+		"ref to a def named $id": {
+			Given:    `{"properties": {"a": {"$ref": "#/$defs/$id"}}, "$defs": {"$id": {"type": "string"}}}`,
+			Expected: `{"properties": {"a": {"type": "string"}}}`,
+		},
+		"inlines local refs": {
+			Given: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"$id": "root",
+				"properties": {"a": {"$ref": "#/$defs/A"}},
+				"$defs": {"A": {"$id": "a", "type": "string"}}
+			}`,
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {"a": {"type": "string"}}
+			}`,
+		},
+		"anchored defs dropped by default": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A"}},
+				"$defs": {
+					"A": {"$anchor": "a", "type": "string"},
+					"B": {"type": "number"}
+				}
+			}`,
+			Expected: `{
+				"properties": {"a": {"$anchor": "a", "type": "string"}}
+			}`,
+		},
+		"keep anchored defs": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A"}, "b": {"$ref": "#/$defs/B"}},
+				"$defs": {
+					"A": {"$anchor": "a", "$id": "a", "properties": {"c": {"$ref": "#/$defs/C"}}, "$defs": {"C": {"type": "string"}}},
+					"B": {"type": "number"}
+				}
+			}`,
+			Opts: Options{KeepAnchoredDefs: true},
+			Expected: `{
+				"properties": {
+					"a": {"$anchor": "a", "properties": {"c": {"type": "string"}}},
+					"b": {"type": "number"}
+				},
+				"$defs": {
+					"A": {"$anchor": "a", "properties": {"c": {"type": "string"}}}
+				}
+			}`,
+		},
+		"annotate provenance": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/A"},
+					"b": {"$ref": "#/$defs/A", "$comment": "mine"},
+					"c": {"$ref": "#/$defs/C"},
+					"d": {"$ref": "#/$defs/D"}
+				},
+				"$defs": {
+					"A": {"type": "string", "items": {"$ref": "#/$defs/C"}},
+					"C": true,
+					"D": {"$comment": "an id", "type": "integer"}
+				}
+			}`,
+			Opts: Options{AnnotateProvenance: true},
+			Expected: `{
+				"properties": {
+					"a": {"$comment": "inlined from #/$defs/A", "type": "string", "items": true},
+					"b": {"$comment": "mine", "type": "string", "items": true},
+					"c": true,
+					"d": {"$comment": "an id (inlined from #/$defs/D)", "type": "integer"}
+				}
+			}`,
+		},
+		"type array passes through": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A"}, "b": {"type": ["string", "null"]}},
+				"$defs": {"A": {"type": ["string", "null"]}}
+			}`,
+			Expected: `{"properties": {"a": {"type": ["string", "null"]}, "b": {"type": ["string", "null"]}}}`,
+		},
+		"sibling type replaces type array": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A", "type": "string"}},
+				"$defs": {"A": {"type": ["string", "null"], "minLength": 1}}
+			}`,
+			Expected: `{"properties": {"a": {"type": "string", "minLength": 1}}}`,
+		},
+		"ref chain merges siblings along the way": {
+			Given: `{
+				"properties": {"x": {"$ref": "#/$defs/A", "title": "x"}},
+				"$defs": {
+					"A": {"$ref": "#/$defs/B", "description": "A", "minLength": 1},
+					"B": {"$ref": "#/$defs/C", "description": "B", "minLength": 2, "maxLength": 5},
+					"C": {"$ref": "#/$defs/D", "description": "C", "minLength": 3, "pattern": "^[a-z]+$"},
+					"D": {"type": "string", "description": "D", "minLength": 4}
+				}
+			}`,
+			Expected: `{
+				"properties": {"x": {"type": "string", "title": "x", "description": "A", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"}}
+			}`,
+		},
+		"inject title from def name": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/UserProfile"},
+					"b": {"$ref": "#/$defs/Titled"},
+					"c": {"$ref": "#/$defs/UserProfile", "title": "c"},
+					"d": {"$ref": "#/$defs/UserProfile/properties/name"},
+					"e": {"$ref": "#/properties/a"},
+					"f": {"$ref": "#/$defs/a~1b"}
+				},
+				"$defs": {
+					"UserProfile": {"properties": {"name": {"type": "string"}}},
+					"Titled": {"title": "Named", "type": "null"},
+					"a/b": {"type": "integer"}
+				}
+			}`,
+			Opts: Options{InjectTitleFromDefName: true},
+			Expected: `{
+				"properties": {
+					"a": {"title": "UserProfile", "properties": {"name": {"type": "string"}}},
+					"b": {"title": "Named", "type": "null"},
+					"c": {"title": "c", "properties": {"name": {"type": "string"}}},
+					"d": {"type": "string"},
+					"e": {"title": "UserProfile", "properties": {"name": {"type": "string"}}},
+					"f": {"title": "a/b", "type": "integer"}
+				}
+			}`,
+		},
+		"refs to additionalProperties": {
+			Given: `{
+				"properties": {
+					"object": {"$ref": "#/$defs/Map/additionalProperties", "maxLength": 5},
+					"true": {"$ref": "#/$defs/Open/additionalProperties"},
+					"trueWithSiblings": {"$ref": "#/$defs/Open/additionalProperties", "type": "integer"},
+					"false": {"$ref": "#/$defs/Closed/additionalProperties", "type": "integer"},
+					"map": {"$ref": "#/$defs/Map"}
+				},
+				"$defs": {
+					"Map": {"type": "object", "additionalProperties": {"$ref": "#/$defs/Value", "minLength": 1}},
+					"Open": {"additionalProperties": true},
+					"Closed": {"additionalProperties": false},
+					"Value": {"type": "string"}
+				}
+			}`,
+			Expected: `{
+				"properties": {
+					"object": {"type": "string", "minLength": 1, "maxLength": 5},
+					"true": true,
+					"trueWithSiblings": {"type": "integer"},
+					"false": false,
+					"map": {"type": "object", "additionalProperties": {"type": "string", "minLength": 1}}
+				}
+			}`,
+		},
+		"refs in and into if/then/else": {
+			Given: `{
+				"properties": {
+					"payment": {"$ref": "#/$defs/Payment"},
+					"cardOnly": {"$ref": "#/$defs/Payment/then", "title": "card"},
+					"condition": {"$ref": "#/$defs/Payment/if/properties/method"},
+					"fallback": {"$ref": "#/$defs/Payment/else"}
+				},
+				"$defs": {
+					"Payment": {
+						"if": {"properties": {"method": {"$ref": "#/$defs/Card"}}},
+						"then": {"required": ["number"], "properties": {"number": {"$ref": "#/$defs/Number"}}},
+						"else": {"$ref": "#/$defs/Iban"}
+					},
+					"Card": {"const": "card"},
+					"Number": {"type": "string", "pattern": "^[0-9]{16}$"},
+					"Iban": {"required": ["iban"]}
+				}
+			}`,
+			Expected: `{
+				"properties": {
+					"payment": {
+						"if": {"properties": {"method": {"const": "card"}}},
+						"then": {"required": ["number"], "properties": {"number": {"type": "string", "pattern": "^[0-9]{16}$"}}},
+						"else": {"required": ["iban"]}
+					},
+					"cardOnly": {"title": "card", "required": ["number"], "properties": {"number": {"type": "string", "pattern": "^[0-9]{16}$"}}},
+					"condition": {"const": "card"},
+					"fallback": {"required": ["iban"]}
+				}
+			}`,
+		},
+		"array indexes and numeric keys": {
+			Given: `{
+				"properties": {
+					"index": {"$ref": "#/$defs/Shapes/oneOf/1"},
+					"key": {"$ref": "#/$defs/Codes/properties/1"},
+					"nested": {"$ref": "#/$defs/Codes/properties/2/anyOf/0"},
+					"tuple": {"$ref": "#/$defs/Pair/prefixItems/10"}
+				},
+				"$defs": {
+					"Shapes": {"oneOf": [{"type": "string"}, {"type": "integer"}]},
+					"Codes": {"properties": {
+						"1": {"const": "one"},
+						"2": {"anyOf": [{"const": "two"}, {"const": 2}]}
+					}},
+					"Pair": {"prefixItems": [{}, {}, {}, {}, {}, {}, {}, {}, {}, {}, {"type": "boolean"}]}
+				}
+			}`,
+			Expected: `{
+				"properties": {
+					"index": {"type": "integer"},
+					"key": {"const": "one"},
+					"nested": {"const": "two"},
+					"tuple": {"type": "boolean"}
+				}
+			}`,
+		},
+		"union types": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/A", "type": "string"},
+					"b": {"$ref": "#/$defs/A", "type": ["integer", "null"]},
+					"c": {"$ref": "#/$defs/B", "type": "integer"},
+					"d": {"$ref": "#/$defs/B"}
+				},
+				"$defs": {"A": {"type": ["string", "null"]}, "B": {"type": "string"}}
+			}`,
+			Opts: Options{UnionTypes: true},
+			Expected: `{
+				"properties": {
+					"a": {"type": ["string", "null"]},
+					"b": {"type": ["string", "null", "integer"]},
+					"c": {"type": ["string", "integer"]},
+					"d": {"type": "string"}
+				}
+			}`,
+		},
+		"merge arrays": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/A", "required": ["b", "c"], "enum": [{"x": 1}, 2], "allOf": [{"minProperties": 1}]},
+					"b": {"$ref": "#/$defs/A", "anyOf": [{}], "const": 1}
+				},
+				"$defs": {"A": {
+					"required": ["a", "b"],
+					"enum": [1, {"x": 1}],
+					"allOf": [{"maxProperties": 3}],
+					"anyOf": [{"type": "object"}]
+				}}
+			}`,
+			Opts: Options{MergeArrays: true},
+			Expected: `{
+				"properties": {
+					"a": {"required": ["a", "b", "c"], "enum": [1, {"x": 1}, 2], "allOf": [{"maxProperties": 3}, {"minProperties": 1}], "anyOf": [{"type": "object"}]},
+					"b": {"required": ["a", "b"], "enum": [1, {"x": 1}], "allOf": [{"maxProperties": 3}], "anyOf": [{}], "const": 1}
+				}
+			}`,
+		},
+		"arrays are replaced by default": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A", "required": ["b"]}},
+				"$defs": {"A": {"required": ["a"]}}
+			}`,
+			Expected: `{"properties": {"a": {"required": ["b"]}}}`,
+		},
+		"max ref hops": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/A"}, "c": {"$ref": "#/$defs/C/items", "title": "c"}},
+				"$defs": {
+					"A": {"properties": {"b": {"$ref": "#/$defs/B"}}},
+					"B": {"properties": {"c": {"$ref": "#/$defs/C"}}},
+					"C": {"items": {"type": "string"}},
+					"Unused": {}
+				}
+			}`,
+			Opts: Options{InlineMaxRefHops: 1},
+			Expected: `{
+				"properties": {
+					"a": {"properties": {"b": {"$ref": "#/$defs/B"}}},
+					"c": {"type": "string", "title": "c"}
+				},
+				"$defs": {
+					"B": {"properties": {"c": {"items": {"type": "string"}}}}
+				}
+			}`,
+		},
+		"max ref hops with recursion": {
+			Given: `{
+				"$ref": "#/$defs/Node",
+				"$defs": {"Node": {"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}}}}
+			}`,
+			Opts: Options{InlineMaxRefHops: 1},
+			Expected: `{
+				"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}},
+				"$defs": {
+					"Node": {"properties": {"children": {"items": {"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}}}}}}
+				}
+			}`,
+		},
+		"inline only prefix": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/Shared/$defs/Id"},
+					"b": {"$ref": "#/$defs/Local"}
+				},
+				"$defs": {
+					"Shared": {"$defs": {"Id": {"type": "string"}}},
+					"Local": {"properties": {"id": {"$ref": "#/$defs/Shared/$defs/Id"}}}
+				}
+			}`,
+			Opts: Options{InlineOnly: []string{"#/$defs/Shared/"}},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"$ref": "#/$defs/Local"}
+				},
+				"$defs": {
+					"Local": {"properties": {"id": {"type": "string"}}}
+				}
+			}`,
+		},
+		"inline only glob": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/SharedId"},
+					"b": {"$ref": "#/$defs/LocalId"}
+				},
+				"$defs": {"SharedId": {"type": "string"}, "LocalId": {"type": "integer"}}
+			}`,
+			Opts: Options{InlineOnly: []string{"#/$defs/Shared*"}},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"$ref": "#/$defs/LocalId"}
+				},
+				"$defs": {"LocalId": {"type": "integer"}}
+			}`,
+		},
+		"dotted keys resolve literally": {
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/v1.Name"},
+					"b": {"$ref": "#/$defs/foo.bar"}
+				},
+				"$defs": {"v1.Name": {"type": "string"}, "foo.bar": {"type": "integer"}, "foo": {"bar": {"type": "null"}}}
+			}`,
+			Expected: `{"properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}`,
+		},
+		"prune empty objects": {
+			Given: `{
+				"properties": {
+					"a": {"$defs": {"X": {"type": "string"}}},
+					"b": {},
+					"c": {"$id": "c", "type": "string"},
+					"d": {"properties": {"e": {"$id": "e"}}},
+					"f": {"$ref": "#/$defs/OnlyDefs"},
+					"g": {"$ref": "#/$defs/Empty"}
+				},
+				"prefixItems": [{"$schema": "x"}, {"type": "null"}],
+				"$defs": {"OnlyDefs": {"$defs": {}}, "Empty": {}}
+			}`,
+			Opts: Options{PruneEmptyObjects: true},
+			Expected: `{
+				"properties": {
+					"b": {},
+					"c": {"type": "string"},
+					"g": {}
+				},
+				"prefixItems": [{}, {"type": "null"}]
+			}`,
+		},
+		"prune empty objects keeps the root": {
+			Given:    `{"properties": {"a": {"$id": "a"}}, "$defs": {}}`,
+			Opts:     Options{PruneEmptyObjects: true},
+			Expected: `{}`,
+		},
+		"empty objects are kept by default": {
+			Given:    `{"properties": {"a": {"$defs": {"X": {}}}, "b": {"$id": "b"}}}`,
+			Expected: `{"properties": {"a": {}, "b": {}}}`,
+		},
+		"pattern properties": {
+			Given: `{
+				"patternProperties": {
+					"^/api/v1/~[a-z]+$": {"$ref": "#/$defs/X", "description": "route"},
+					"#/$defs/X": {"$ref": "#/patternProperties/^~1api~1v1~1~0[a-z]+$"},
+					"~1~0": {"type": "null"}
+				},
+				"properties": {"p": {"$ref": "#/patternProperties/~01~00"}},
+				"$defs": {"X": {"type": "string", "description": "x"}}
+			}`,
+			Expected: `{
+				"patternProperties": {
+					"^/api/v1/~[a-z]+$": {"type": "string", "description": "route"},
+					"#/$defs/X": {"type": "string", "description": "route"},
+					"~1~0": {"type": "null"}
+				},
+				"properties": {"p": {"type": "null"}}
+			}`,
+		},
+		"leading bom": {
+			Given:    "\xEF\xBB\xBF" + `{"properties": {"a": {"$ref": "#/$defs/A"}}, "$defs": {"A": {"type": "string"}}}`,
+			Expected: `{"properties": {"a": {"type": "string"}}}`,
+		},
+		"keep anchored defs without anchors": {
+			Given: `{
+				"properties": {"b": {"$ref": "#/$defs/B"}},
+				"$defs": {"B": {"type": "number"}}
+			}`,
+			Opts: Options{KeepAnchoredDefs: true},
+			Expected: `{
+				"properties": {"b": {"type": "number"}}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}
+
+			updates, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if !j.NoError(err) {
+				return
+			}
+
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytesInlineOnlyBadPattern() {
+	_, err := InlineSchemaBytes([]byte(`{"$ref": "#/$defs/A", "$defs": {"A": {}}}`), Options{InlineOnly: []string{"#/$defs/["}})
+	j.EqualError(err, `inline refs: invalid InlineOnly pattern "#/$defs/[": syntax error in pattern`)
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSErrors() {
+	type test struct {
+		Given       string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"cyclic ref": {
+			Given:       `{"$ref": "#/$defs/A", "$defs": {"A": {"items": {"$ref": "#/$defs/A"}}}}`,
+			ExpectedErr: "inline refs in schema.json: cyclic $ref detected: schema.json#/$defs/A -> schema.json#/$defs/A",
+		},
+		"cyclic ref chain": {
+			Given: `{
+				"properties": {"x": {"$ref": "#/$defs/A"}},
+				"$defs": {"A": {"$ref": "#/$defs/B"}, "B": {"$ref": "#/$defs/C", "title": "B"}, "C": {"$ref": "#/$defs/A"}}
+			}`,
+			ExpectedErr: "cyclic $ref detected: schema.json#/$defs/A -> schema.json#/$defs/B -> schema.json#/$defs/C -> schema.json#/$defs/A",
+		},
+		"index out of range": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/A/oneOf/2"}}, "$defs": {"A": {"oneOf": [{}, {}]}}}`,
+			ExpectedErr: `unresolved $ref "#/$defs/A/oneOf/2": index 2 out of range of an array of 2`,
+		},
+		"index with a leading zero": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/A/oneOf/01"}}, "$defs": {"A": {"oneOf": [{}, {}]}}}`,
+			ExpectedErr: `pointer "#/$defs/A/oneOf/01": "01" is not an array index`,
+		},
+		"key into an array": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/A/oneOf/x"}}, "$defs": {"A": {"oneOf": [{}]}}}`,
+			ExpectedErr: `pointer "#/$defs/A/oneOf/x": "x" is not an array index`,
+		},
+		"append token": {
+			Given:       `{"properties": {"a": {"$ref": "#/prefixItems/-"}}, "prefixItems": [{"type": "string"}]}`,
+			ExpectedErr: `pointer "#/prefixItems/-": '-' token is not valid in a reference pointer, it only appends to an array`,
+		},
+		"numeric key missing from an object": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/A/properties/0"}}, "$defs": {"A": {"properties": {"00": {}}, "oneOf": [{}]}}}`,
+			ExpectedErr: `unresolved $ref "#/$defs/A/properties/0": missing key "0"`,
+		},
+		"ref to stripped $schema": {
+			Given:       `{"$schema": "https://json-schema.org/draft/2020-12/schema", "properties": {"a": {"$ref": "#/$schema"}}}`,
+			ExpectedErr: `$ref "#/$schema" targets "$schema", which is stripped from the output`,
+		},
+		"ref to nested stripped $id": {
+			Given:       `{"properties": {"a": {"$id": "a"}, "b": {"$ref": "#/properties/a/$id"}}}`,
+			ExpectedErr: `$ref "#/properties/a/$id" targets "$id", which is stripped from the output`,
+		},
+		"ref to stripped $defs": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs"}}, "$defs": {"A": {}}}`,
+			ExpectedErr: `$ref "#/$defs" targets "$defs", which is stripped from the output`,
+		},
+		"empty pointer": {
+			Given:       `{"properties": {"a": {"$ref": "#/"}}}`,
+			ExpectedErr: `invalid JSON Pointer "#/": empty reference token`,
+		},
+		"trailing slash": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/"}}, "$defs": {"": {}}}`,
+			ExpectedErr: `invalid JSON Pointer "#/$defs/": empty reference token`,
+		},
+		"double slash": {
+			Given:       `{"properties": {"a": {"$ref": "#//x"}}}`,
+			ExpectedErr: `invalid JSON Pointer "#//x": empty reference token`,
+		},
+		"missing ref": {
+			Given:       `{"$ref": "#/$defs/A"}`,
+			ExpectedErr: `unresolved $ref "#/$defs/A": missing key "$defs"`,
+		},
+		"dot path": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/Shared.Id/type"}}, "$defs": {"Shared": {"Id": {"type": "string"}}}}`,
+			ExpectedErr: `unresolved $ref "#/$defs/Shared.Id/type": missing key "Shared.Id"; JSON Pointer tokens are separated by "/", did you mean "#/$defs/Shared/Id/type"?`,
+		},
+		"dot path with a wrong nested key": {
+			Given:       `{"properties": {"a": {"$ref": "#/properties/foo.bar/type"}, "foo": {"type": "string"}}}`,
+			ExpectedErr: `unresolved $ref "#/properties/foo.bar/type": missing key "foo.bar"; JSON Pointer tokens are separated by "/", not "."`,
+		},
+		"definitions instead of $defs": {
+			Given:       `{"properties": {"a": {"$ref": "#/definitions/A/type"}}, "$defs": {"A": {"type": "string"}}}`,
+			ExpectedErr: `unresolved $ref "#/definitions/A/type": missing key "definitions"; the document declares it under "$defs", did you mean "#/$defs/A/type"?`,
+		},
+		"$defs instead of definitions": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/A"}}, "definitions": {"A": {}}, "$defs": {"B": {}}}`,
+			ExpectedErr: `unresolved $ref "#/$defs/A": missing key "A"; the document declares it under "definitions", did you mean "#/definitions/A"?`,
+		},
+		"nested definitions": {
+			Given:       `{"properties": {"a": {"$ref": "#/properties/b/definitions/C"}, "b": {"$defs": {"C": {}}}}}`,
+			ExpectedErr: `unresolved $ref "#/properties/b/definitions/C": missing key "definitions"; the document declares it under "$defs", did you mean "#/properties/b/$defs/C"?`,
+		},
+		"missing under both": {
+			Given:       `{"properties": {"a": {"$ref": "#/definitions/A"}}, "$defs": {"B": {}}}`,
+			ExpectedErr: `unresolved $ref "#/definitions/A": missing key "definitions"`,
+		},
+		"missing dotted key": {
+			Given:       `{"properties": {"a": {"$ref": "#/$defs/v1.Name"}}, "$defs": {"v2.Name": {}}}`,
+			ExpectedErr: `unresolved $ref "#/$defs/v1.Name": missing key "v1.Name"`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}
+
+			_, err := InlineBundledSchemasInFS(fsys, Options{})
+			j.ErrorContains(err, v.ExpectedErr)
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSSafeStrip() {
+	type test struct {
+		Given       string
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	given := `{
+		"$id": "https://example.com/order.json",
+		"properties": {
+			"line": {"$id": "https://example.com/lines/", "properties": {"sku": {"$ref": "sku.json"}}},
+			"note": {"$id": "notes/", "$ref": "../order.json#/$defs/Note"}
+		},
+		"$defs": {"Note": {"type": "string"}}
+	}`
+
+	tests := map[string]test{
+		"error": {
+			Given:       given,
+			Opts:        Options{OnMissingRef: MissingRefWarn},
+			ExpectedErr: `inline refs in schema.json: stripping $id "https://example.com/lines/" would change what the relative $ref "sku.json" beneath it resolves to`,
+		},
+		"safe strip": {
+			Given: given,
+			Opts:  Options{OnMissingRef: MissingRefWarn, SafeStrip: true},
+			Expected: `{
+				"properties": {
+					"line": {"$id": "https://example.com/lines/", "properties": {"sku": {"$ref": "sku.json"}}},
+					"note": {"type": "string"}
+				}
+			}`,
+		},
+		"kept $id with a kept fragment ref": {
+			Given: `{
+				"$id": "https://example.com/order.json",
+				"properties": {
+					"line": {"$id": "https://example.com/lines/", "properties": {"sku": {"$ref": "sku.json"}, "note": {"$ref": "../order.json#/$defs/Note"}}}
+				},
+				"$defs": {"Note": {"type": "string"}}
+			}`,
+			Opts:        Options{OnMissingRef: MissingRefWarn, SafeStrip: true, KeepDefs: true},
+			ExpectedErr: `inline refs in schema.json: keeping $id "https://example.com/lines/" for the relative $ref "sku.json" beneath it would change what the $ref "#/$defs/Note" resolves to`,
+		},
+		"fragment refs and anchors": {
+			Given: `{
+				"properties": {
+					"a": {"$id": "a/", "$ref": "#/$defs/A", "$defs": {"A": {"type": "string"}}},
+					"b": {"$id": "#b", "$ref": "other.json"}
+				}
+			}`,
+			Opts: Options{OnMissingRef: MissingRefWarn},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"$ref": "other.json"}
+				}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}
+
+			updates, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if j.NoError(err) {
+				j.JSONEq(v.Expected, string(updates["schema.json"]))
+			}
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSAnchors() {
+	type test struct {
+		Given       fstest.MapFS
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	common := `{
+		"$defs": {
+			"Address": {"$anchor": "Address", "properties": {"country": {"$ref": "#Country"}}},
+			"Country": {"$dynamicAnchor": "Country", "type": "string"}
+		}
+	}`
+
+	tests := map[string]test{
+		"file and anchor": {
+			Given: fstest.MapFS{
+				"order.json":  {Data: []byte(`{"properties": {"ship_to": {"$ref": "common.json#Address", "title": "Ship to"}}}`)},
+				"common.json": {Data: []byte(common)},
+			},
+			Expected: `{
+				"properties": {
+					"ship_to": {"$anchor": "Address", "title": "Ship to", "properties": {"country": {"$dynamicAnchor": "Country", "type": "string"}}}
+				}
+			}`,
+		},
+		"local anchor": {
+			Given: fstest.MapFS{
+				"order.json": {Data: []byte(`{"items": {"$ref": "#item"}, "$defs": {"Item": {"$anchor": "item", "type": "integer"}}}`)},
+			},
+			Expected: `{"items": {"$anchor": "item", "type": "integer"}}`,
+		},
+		"kept ref": {
+			Given: fstest.MapFS{
+				"order.json": {Data: []byte(`{"items": {"$ref": "#item"}, "$defs": {"Item": {"$anchor": "item", "type": "integer"}}}`)},
+			},
+			Opts:     Options{KeepDefs: true},
+			Expected: `{"items": {"$ref": "#/$defs/Item"}, "$defs": {"Item": {"$anchor": "item", "type": "integer"}}}`,
+		},
+		"cycle through anchor and pointer": {
+			Given: fstest.MapFS{
+				"order.json": {Data: []byte(`{"$ref": "#/$defs/Node", "$defs": {"Node": {"$anchor": "node", "items": {"$ref": "#node"}}}}`)},
+			},
+			ExpectedErr: `inline refs in order.json: cyclic $ref detected: order.json#/$defs/Node -> order.json#/$defs/Node`,
+		},
+		"missing anchor": {
+			Given: fstest.MapFS{
+				"order.json":  {Data: []byte(`{"properties": {"a": {"$ref": "common.json#Street"}}}`)},
+				"common.json": {Data: []byte(common)},
+			},
+			ExpectedErr: `inline refs in order.json: common.json: unresolved $ref "#Street": no schema declares the anchor`,
+		},
+		"duplicate anchor": {
+			Given: fstest.MapFS{
+				"order.json": {Data: []byte(`{"items": {"$ref": "#a"}, "$defs": {"A": {"$anchor": "a"}, "B": {"$anchor": "a"}}}`)},
+			},
+			ExpectedErr: `inline refs in order.json: anchor "a" is declared by both "#/$defs/A" and "#/$defs/B"`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(v.Given, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if j.NoError(err) {
+				j.JSONEq(v.Expected, string(updates["order.json"]))
+			}
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSOutputPathFromID() {
+	type test struct {
+		Given       fstest.MapFS
+		Opts        Options
+		Expected    []string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"path of the $id": {
+			Given: fstest.MapFS{
+				"user.json":       {Data: []byte(`{"$id": "https://api.example.com/schemas/user"}`)},
+				"v1/order.json":   {Data: []byte(`{"$id": "https://api.example.com/schemas/orders/order.json#"}`)},
+				"archive.json.gz": {Data: gzipped(j.T(), `{"$id": "https://api.example.com/old"}`)},
+			},
+			Opts:     Options{OutputPathFromID: true},
+			Expected: []string{"old.json.gz", "schemas/orders/order.json", "schemas/user.json"},
+		},
+		"base url stripped": {
+			Given: fstest.MapFS{
+				"user.json": {Data: []byte(`{"$id": "https://api.example.com/schemas/user"}`)},
+			},
+			Opts:     Options{OutputPathFromID: true, IDBaseURL: "https://api.example.com/schemas/"},
+			Expected: []string{"user.json"},
+		},
+		"no $id": {
+			Given:       fstest.MapFS{"user.json": {Data: []byte(`{"$id": "user"}`)}},
+			Opts:        Options{OutputPathFromID: true},
+			ExpectedErr: "user.json has no absolute $id to derive an output path from",
+		},
+		"outside base url": {
+			Given:       fstest.MapFS{"user.json": {Data: []byte(`{"$id": "https://other.example.com/user"}`)}},
+			Opts:        Options{OutputPathFromID: true, IDBaseURL: "https://api.example.com/"},
+			ExpectedErr: `$id "https://other.example.com/user" of user.json has no usable path under "https://api.example.com/"`,
+		},
+		"no path": {
+			Given:       fstest.MapFS{"user.json": {Data: []byte(`{"$id": "urn:example:user"}`)}},
+			Opts:        Options{OutputPathFromID: true},
+			ExpectedErr: `$id "urn:example:user" of user.json has no usable path under ""`,
+		},
+		"collision": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://a.example.com/user"}`)},
+				"b.json": {Data: []byte(`{"$id": "https://b.example.com/user.json"}`)},
+			},
+			Opts:        Options{OutputPathFromID: true},
+			ExpectedErr: "a.json and b.json both have the output path user.json",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(v.Given, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if j.NoError(err) {
+				j.ElementsMatch(v.Expected, slices.Collect(maps.Keys(updates)))
+			}
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSCrossFile() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"customer": {"$ref": "common/customer.json#/$defs/Customer"},
+				"id": {"$ref": "common/id.json"}
+			}
+		}`)},
+		"common/customer.json": {Data: []byte(`{
+			"$defs": {"Customer": {"properties": {"id": {"$ref": "id.json"}}}}
+		}`)},
+		"common/id.json": {Data: []byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "string"}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{})
+	j.Require().NoError(err)
+
+	j.JSONEq(`{
+		"properties": {
+			"customer": {"properties": {"id": {"type": "string"}}},
+			"id": {"type": "string"}
+		}
+	}`, string(updates["order.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSApplicators() {
+	type test struct {
+		Given    string
+		Expected string
+	}
+
+	tests := map[string]test{
+		"refs in contains": {
+			Given:    `{"contains": {"$ref": "#/$defs/Int"}, "$defs": {"Int": {"type": "integer"}}}`,
+			Expected: `{"contains": {"type": "integer"}}`,
+		},
+		"refs in unevaluatedProperties": {
+			Given:    `{"unevaluatedProperties": {"$ref": "#/$defs/Int"}, "$defs": {"Int": {"type": "integer"}}}`,
+			Expected: `{"unevaluatedProperties": {"type": "integer"}}`,
+		},
+		"refs in unevaluatedItems": {
+			Given:    `{"unevaluatedItems": {"$ref": "#/$defs/Int"}, "$defs": {"Int": {"type": "integer"}}}`,
+			Expected: `{"unevaluatedItems": {"type": "integer"}}`,
+		},
+		"refs in propertyNames": {
+			Given:    `{"propertyNames": {"$ref": "#/$defs/Key"}, "$defs": {"Key": {"pattern": "^[a-z]+$"}}}`,
+			Expected: `{"propertyNames": {"pattern": "^[a-z]+$"}}`,
+		},
+		"contains as target": {
+			Given:    `{"properties": {"a": {"contains": {"minimum": 1}}, "b": {"items": {"$ref": "#/properties/a/contains"}}}}`,
+			Expected: `{"properties": {"a": {"contains": {"minimum": 1}}, "b": {"items": {"minimum": 1}}}}`,
+		},
+		"unevaluatedProperties as target": {
+			Given:    `{"properties": {"a": {"unevaluatedProperties": {"type": "string"}}, "b": {"$ref": "#/properties/a/unevaluatedProperties"}}}`,
+			Expected: `{"properties": {"a": {"unevaluatedProperties": {"type": "string"}}, "b": {"type": "string"}}}`,
+		},
+		"unevaluatedItems as target": {
+			Given:    `{"properties": {"a": {"unevaluatedItems": false}, "b": {"not": {"$ref": "#/properties/a/unevaluatedItems"}}}}`,
+			Expected: `{"properties": {"a": {"unevaluatedItems": false}, "b": {"not": false}}}`,
+		},
+		"propertyNames as target": {
+			Given:    `{"properties": {"a": {"propertyNames": {"maxLength": 3}}, "b": {"propertyNames": {"$ref": "#/properties/a/propertyNames"}}}}`,
+			Expected: `{"properties": {"a": {"propertyNames": {"maxLength": 3}}, "b": {"propertyNames": {"maxLength": 3}}}}`,
+		},
+		"nested in each other": {
+			Given: `{
+				"contains": {"unevaluatedProperties": {"propertyNames": {"$ref": "#/$defs/Key"}}},
+				"unevaluatedItems": {"$ref": "#/contains/unevaluatedProperties"},
+				"$defs": {"Key": {"minLength": 1}}
+			}`,
+			Expected: `{
+				"contains": {"unevaluatedProperties": {"propertyNames": {"minLength": 1}}},
+				"unevaluatedItems": {"propertyNames": {"minLength": 1}}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}, Options{})
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSCrossFileLocalRefs() {
+	// Every file declares an Address, so each local ref only inlines the
+	// right one if it's resolved against the file it's written in.
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"customer": {"$ref": "customer.json#/$defs/Customer"},
+				"shipTo": {"$ref": "#/$defs/Address"}
+			},
+			"$defs": {"Address": {"description": "order address"}}
+		}`)},
+		"customer.json": {Data: []byte(`{
+			"$defs": {
+				"Customer": {"properties": {"address": {"$ref": "#/$defs/Address"}}},
+				"Address": {"description": "customer address", "properties": {"country": {"$ref": "geo.json#/$defs/Country"}}}
+			}
+		}`)},
+		"geo.json": {Data: []byte(`{
+			"$defs": {
+				"Country": {"properties": {"code": {"$ref": "#/$defs/Code"}, "address": {"$ref": "#/$defs/Address"}}},
+				"Code": {"type": "string", "pattern": "^[A-Z]{2}$"},
+				"Address": {"description": "geo address"}
+			}
+		}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{})
+	j.Require().NoError(err)
+	j.JSONEq(`{
+		"properties": {
+			"customer": {
+				"properties": {
+					"address": {
+						"description": "customer address",
+						"properties": {
+							"country": {
+								"properties": {
+									"code": {"type": "string", "pattern": "^[A-Z]{2}$"},
+									"address": {"description": "geo address"}
+								}
+							}
+						}
+					}
+				}
+			},
+			"shipTo": {"description": "order address"}
+		}
+	}`, string(updates["order.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSCrossFileRoots() {
+	type test struct {
+		Given       fstest.MapFS
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"local refs resolve against the target file": {
+			Given: fstest.MapFS{
+				"host.json": {Data: []byte(`{
+					"properties": {
+						"a": {"$ref": "lib/common.json#/$defs/A"},
+						"b": {"$ref": "#/$defs/B"}
+					},
+					"$defs": {"B": {"type": "boolean"}}
+				}`)},
+				"lib/common.json": {Data: []byte(`{
+					"$defs": {
+						"A": {"properties": {"b": {"$ref": "#/$defs/B"}, "self": {"$ref": "common.json#/$defs/C"}}},
+						"B": {"items": {"$ref": "#/$defs/C"}},
+						"C": {"type": "integer"}
+					}
+				}`)},
+			},
+			Expected: `{
+				"properties": {
+					"a": {"properties": {"b": {"items": {"type": "integer"}}, "self": {"type": "integer"}}},
+					"b": {"type": "boolean"}
+				}
+			}`,
+		},
+		"refs back into the host": {
+			Given: fstest.MapFS{
+				"host.json": {Data: []byte(`{
+					"items": {"$ref": "lib/common.json#/$defs/A"},
+					"$defs": {"B": {"type": "boolean"}}
+				}`)},
+				"lib/common.json": {Data: []byte(`{
+					"$defs": {"A": {"not": {"$ref": "../host.json#/$defs/B"}}, "B": {"type": "null"}}
+				}`)},
+			},
+			Expected: `{"items": {"not": {"type": "boolean"}}}`,
+		},
+		"cycle across files": {
+			Given: fstest.MapFS{
+				"host.json": {Data: []byte(`{
+					"items": {"$ref": "lib/common.json#/$defs/A"},
+					"$defs": {"B": {"items": {"$ref": "lib/common.json#/$defs/A"}}}
+				}`)},
+				"lib/common.json": {Data: []byte(`{
+					"$defs": {"A": {"not": {"$ref": "../host.json#/$defs/B"}}}
+				}`)},
+			},
+			ExpectedErr: "inline refs in host.json: cyclic $ref detected: lib/common.json#/$defs/A -> host.json#/$defs/B -> lib/common.json#/$defs/A",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(v.Given)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if !j.NoError(err) {
+				return
+			}
+			j.JSONEq(v.Expected, string(updates["host.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSExternalOnly() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"$id": "https://example.com/order",
+			"properties": {
+				"customer": {"$ref": "common/customer.json#/$defs/Customer"},
+				"lines": {"items": {"$ref": "#/$defs/Line"}},
+				"total": {"$ref": "https://example.com/order#/$defs/Money"}
+			},
+			"$defs": {
+				"Line": {"properties": {"price": {"$ref": "#/$defs/Money"}, "sku": {"$ref": "common/sku.json"}}},
+				"Money": {"type": "integer"},
+				"Unused": {"$id": "unused", "type": "null"}
+			}
+		}`)},
+		"common/customer.json": {Data: []byte(`{
+			"$defs": {
+				"Customer": {"properties": {"name": {"$ref": "#/$defs/Name"}, "lastOrder": {"$ref": "../order.json#/$defs/Money"}}},
+				"Name": {"type": "string"}
+			}
+		}`)},
+		"common/sku.json": {Data: []byte(`{"type": "string", "pattern": "^[A-Z]+$"}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{InlineExternalOnly: true})
+	j.Require().NoError(err)
+
+	j.JSONEq(`{
+		"properties": {
+			"customer": {"properties": {"name": {"type": "string"}, "lastOrder": {"$ref": "#/$defs/Money"}}},
+			"lines": {"items": {"$ref": "#/$defs/Line"}},
+			"total": {"$ref": "#/$defs/Money"}
+		},
+		"$defs": {
+			"Line": {"properties": {"price": {"$ref": "#/$defs/Money"}, "sku": {"type": "string", "pattern": "^[A-Z]+$"}}},
+			"Money": {"type": "integer"},
+			"Unused": {"type": "null"}
+		}
+	}`, string(updates["order.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSKeepDefs() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"id": {"type": "string", "format": "uuid"},
+				"parent": {"$ref": "#/properties/id"},
+				"lines": {"items": {"$ref": "#/$defs/Line"}},
+				"sku": {"$ref": "#/$defs/Line/properties/sku"},
+				"customer": {"$ref": "common/customer.json#/$defs/Customer"}
+			},
+			"$defs": {
+				"Line": {"properties": {"sku": {"type": "string"}, "order": {"$ref": "#/properties/id"}}},
+				"Unused": {"$id": "unused", "type": "null"}
+			}
+		}`)},
+		"common/customer.json": {Data: []byte(`{
+			"$defs": {
+				"Customer": {"properties": {"name": {"$ref": "#/$defs/Name"}, "line": {"$ref": "../order.json#/$defs/Line"}}},
+				"Name": {"type": "string"}
+			}
+		}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{KeepDefs: true})
+	j.Require().NoError(err)
+
+	j.JSONEq(`{
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"parent": {"type": "string", "format": "uuid"},
+			"lines": {"items": {"$ref": "#/$defs/Line"}},
+			"sku": {"$ref": "#/$defs/Line/properties/sku"},
+			"customer": {"properties": {"name": {"type": "string"}, "line": {"$ref": "#/$defs/Line"}}}
+		},
+		"$defs": {
+			"Line": {"properties": {"sku": {"type": "string"}, "order": {"type": "string", "format": "uuid"}}},
+			"Unused": {"type": "null"}
+		}
+	}`, string(updates["order.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSRespectInlineMarker() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"id": {"$ref": "#/$defs/ID"},
+				"money": {"$ref": "#/$defs/Money", "description": "total"},
+				"customer": {"$ref": "customer.json#/$defs/Customer"},
+				"note": {"$ref": "#/$defs/Note"}
+			},
+			"$defs": {
+				"ID": {"type": "string", "x-inline": true},
+				"Money": {"type": "object", "x-inline": false, "properties": {"currency": {"$ref": "#/$defs/Currency"}}},
+				"Currency": {"type": "string", "x-inline": false},
+				"Note": {"type": "string", "x-inline": "no"},
+				"Unused": {"type": "null", "x-inline": false}
+			}
+		}`)},
+		"customer.json": {Data: []byte(`{
+			"$defs": {
+				"Customer": {"properties": {"id": {"$ref": "order.json#/$defs/ID"}, "name": {"$ref": "#/$defs/Name"}}},
+				"Name": {"type": "string", "x-inline": false}
+			}
+		}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{RespectInlineMarker: true})
+	j.Require().NoError(err)
+
+	j.JSONEq(`{
+		"properties": {
+			"id": {"type": "string"},
+			"money": {"$ref": "#/$defs/Money", "description": "total"},
+			"customer": {"properties": {"id": {"type": "string"}, "name": {"$ref": "customer.json#/$defs/Name"}}},
+			"note": {"type": "string"}
+		},
+		"$defs": {
+			"Money": {"type": "object", "properties": {"currency": {"$ref": "#/$defs/Currency"}}},
+			"Currency": {"type": "string"},
+			"Unused": {"type": "null"}
+		}
+	}`, string(updates["order.json"]))
+	j.JSONEq(`{"$defs": {"Name": {"type": "string"}}}`, string(updates["customer.json"]))
+
+	updates, err = InlineBundledSchemasInFS(fstest.MapFS{
+		"a.json": {Data: []byte(`{"items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"type": "string", "inline": false, "x-inline": false}}}`)},
+	}, Options{RespectInlineMarker: true, InlineMarker: "inline"})
+	j.Require().NoError(err)
+	j.JSONEq(`{"items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"type": "string", "x-inline": false}}}`, string(updates["a.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSRequireFullyInlined() {
+	type test struct {
+		Opts        Options
+		ExpectedErr string
+	}
+
+	given := `{
+		"properties": {
+			"a": {"$ref": "#/$defs/A"},
+			"b": {"$ref": "#/$defs/Gone"},
+			"c": {"$ref": "common.json#/$defs/C"},
+			"d": {"enum": [{"$ref": "#/$defs/A"}]}
+		},
+		"$defs": {"A": {"type": "string"}}
+	}`
+
+	tests := map[string]test{
+		"not required": {
+			Opts: Options{OnMissingRef: MissingRefWarn},
+		},
+		"all inlined": {
+			Opts: Options{RequireFullyInlined: true, OnMissingRef: MissingRefRemove},
+		},
+		"unresolved": {
+			Opts:        Options{RequireFullyInlined: true, OnMissingRef: MissingRefWarn},
+			ExpectedErr: `inline refs in schema.json: not fully inlined, $refs remain: "#/$defs/Gone" at "#/properties/b"`,
+		},
+		"skipped": {
+			Opts:        Options{RequireFullyInlined: true, OnMissingRef: MissingRefRemove, InlineOnly: []string{"common.json"}},
+			ExpectedErr: `inline refs in schema.json: not fully inlined, $refs remain: "#/$defs/A" at "#/properties/a"`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{
+				"schema.json": {Data: []byte(given)},
+				"common.json": {Data: []byte(`{"$defs": {"C": {"type": "integer"}}}`)},
+			}
+
+			_, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.NoError(err)
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSRewriteRef() {
+	type test struct {
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	given := `{
+		"properties": {
+			"a": {"$ref": "#/$defs/OldName"},
+			"b": {"$ref": "common.json#/$defs/Old"},
+			"c": {"$ref": "#/$defs/Gone"}
+		},
+		"$defs": {"NewName": {"type": "string"}}
+	}`
+	rename := func(ref string) (string, error) {
+		switch ref {
+		case "#/$defs/OldName":
+			return "#/$defs/NewName", nil
+		case "common.json#/$defs/Old":
+			return "common.json#/$defs/New", nil
+		case "#/$defs/Gone":
+			return "#/$defs/StillGone", nil
+		}
+		return ref, nil
+	}
+
+	tests := map[string]test{
+		"rename": {
+			Opts: Options{RewriteRef: rename, OnMissingRef: MissingRefWarn},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"type": "integer"},
+					"c": {"$ref": "#/$defs/StillGone"}
+				}
+			}`,
+		},
+		"abort": {
+			Opts: Options{RewriteRef: func(ref string) (string, error) {
+				if ref == "#/$defs/Gone" {
+					return "", errors.New("no longer supported")
+				}
+				return rename(ref)
+			}},
+			ExpectedErr: `inline refs in schema.json: rewrite $ref "#/$defs/Gone": no longer supported`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{
+				"schema.json": {Data: []byte(given)},
+				"common.json": {Data: []byte(`{"$defs": {"New": {"type": "integer"}}}`)},
+			}
+			updates, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSLenientRefs() {
+	type test struct {
+		Opts     Options
+		Expected string
+	}
+
+	given := `{
+		"properties": {
+			"a": {"$ref": "/$defs/Foo"},
+			"b": {"items": {"$ref": "/properties/c"}},
+			"c": {"$ref": "#/$defs/Foo"}
+		},
+		"$defs": {"Foo": {"type": "string"}}
+	}`
+
+	tests := map[string]test{
+		"lenient": {
+			Opts: Options{LenientRefs: true},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"items": {"type": "string"}},
+					"c": {"type": "string"}
+				}
+			}`,
+		},
+		"lenient before rewrite": {
+			Opts: Options{LenientRefs: true, RewriteRef: func(ref string) (string, error) {
+				if ref == "/$defs/Foo" {
+					return "", errors.New("not fixed")
+				}
+				return ref, nil
+			}},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"items": {"type": "string"}},
+					"c": {"type": "string"}
+				}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(given)}}, v.Opts)
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+
+	// Strictly, it's a path from the root of the FS.
+	_, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(`{"$ref": "/$defs/Foo", "$defs": {"Foo": {}}}`)}}, Options{})
+	j.EqualError(err, "inline refs in schema.json: read $defs/Foo: open $defs/Foo: file does not exist")
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSRefKeyword() {
+	type test struct {
+		Given       fstest.MapFS
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"local and cross-file": {
+			Given: fstest.MapFS{
+				"schema.json": {Data: []byte(`{
+					"properties": {
+						"a": {"$include": "#/$defs/Foo", "description": "A"},
+						"b": {"$include": "common.json"},
+						"c": {"$ref": "#/$defs/Foo"}
+					},
+					"$defs": {"Foo": {"type": "string"}}
+				}`)},
+				"common.json": {Data: []byte(`{"type": "integer"}`)},
+			},
+			Expected: `{
+				"properties": {
+					"a": {"type": "string", "description": "A"},
+					"b": {"type": "integer"},
+					"c": {"$ref": "#/$defs/Foo"}
+				}
+			}`,
+		},
+		"cycle": {
+			Given: fstest.MapFS{
+				"schema.json": {Data: []byte(`{"$include": "#/$defs/A", "$defs": {"A": {"items": {"$include": "#/$defs/A"}}}}`)},
+			},
+			ExpectedErr: "inline refs in schema.json: cyclic $include detected: schema.json#/$defs/A -> schema.json#/$defs/A",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(v.Given, Options{RefKeyword: "$include"})
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSKeywordDefNames() {
+	type test struct {
+		Opts     Options
+		Expected string
+	}
+
+	given := `{
+		"type": "object",
+		"properties": {
+			"a": {"$ref": "#/$defs/type"},
+			"b": {"$ref": "#/$defs/properties", "required": ["y"]},
+			"c": {"$ref": "#/$defs/required"}
+		},
+		"required": ["a"],
+		"$defs": {
+			"type": {"type": "string"},
+			"properties": {"properties": {"x": {"$ref": "#/$defs/type"}}, "required": ["x"]},
+			"required": {"type": "array", "items": {"$ref": "#/$defs/type"}}
+		}
+	}`
+
+	tests := map[string]test{
+		"inlined": {
+			Expected: `{
+				"type": "object",
+				"properties": {
+					"a": {"type": "string"},
+					"b": {"properties": {"x": {"type": "string"}}, "required": ["y"]},
+					"c": {"type": "array", "items": {"type": "string"}}
+				},
+				"required": ["a"]
+			}`,
+		},
+		"merged arrays and titles": {
+			Opts: Options{MergeArrays: true, InjectTitleFromDefName: true},
+			Expected: `{
+				"type": "object",
+				"properties": {
+					"a": {"title": "type", "type": "string"},
+					"b": {"title": "properties", "properties": {"x": {"title": "type", "type": "string"}}, "required": ["x", "y"]},
+					"c": {"title": "required", "type": "array", "items": {"title": "type", "type": "string"}}
+				},
+				"required": ["a"]
+			}`,
+		},
+		"kept defs": {
+			Opts: Options{KeepDefs: true},
+			Expected: `{
+				"type": "object",
+				"properties": {
+					"a": {"$ref": "#/$defs/type"},
+					"b": {"$ref": "#/$defs/properties", "required": ["y"]},
+					"c": {"$ref": "#/$defs/required"}
+				},
+				"required": ["a"],
+				"$defs": {
+					"type": {"type": "string"},
+					"properties": {"properties": {"x": {"$ref": "#/$defs/type"}}, "required": ["x"]},
+					"required": {"type": "array", "items": {"$ref": "#/$defs/type"}}
+				}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(given)}}, v.Opts)
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSStripPaths() {
+	type test struct {
+		StripPaths  []string
+		Expected    string
+		ExpectedErr string
+	}
+
+	given := `{
+		"properties": {
+			"name": {"type": "string", "x-internal": true},
+			"internalField": {"$ref": "#/$defs/Secret"},
+			"tags": {"prefixItems": [{"type": "string"}, {"type": "integer"}, {"type": "null"}]}
+		},
+		"$defs": {"Secret": {"type": "string", "x-internal": true}}
+	}`
+
+	tests := map[string]test{
+		"pointer": {
+			StripPaths: []string{"#/properties/internalField"},
+			Expected: `{
+				"properties": {
+					"name": {"type": "string", "x-internal": true},
+					"tags": {"prefixItems": [{"type": "string"}, {"type": "integer"}, {"type": "null"}]}
+				}
+			}`,
+		},
+		"glob": {
+			StripPaths: []string{"/properties/*/x-internal", "#/properties/tags/prefixItems/[02]"},
+			Expected: `{
+				"properties": {
+					"name": {"type": "string"},
+					"internalField": {"type": "string"},
+					"tags": {"prefixItems": [{"type": "integer"}]}
+				}
+			}`,
+		},
+		"no match": {
+			StripPaths: []string{"#/properties/missing/type", "#/$defs/Secret"},
+			Expected: `{
+				"properties": {
+					"name": {"type": "string", "x-internal": true},
+					"internalField": {"type": "string", "x-internal": true},
+					"tags": {"prefixItems": [{"type": "string"}, {"type": "integer"}, {"type": "null"}]}
+				}
+			}`,
+		},
+		"bad glob": {
+			StripPaths:  []string{"#/properties/["},
+			ExpectedErr: `inline refs in schema.json: invalid StripPaths pattern "#/properties/[": syntax error in pattern`,
+		},
+		"empty token": {
+			StripPaths:  []string{"#/properties/"},
+			ExpectedErr: `inline refs in schema.json: invalid StripPaths pattern "#/properties/": empty reference token`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(given)}}, Options{StripPaths: v.StripPaths})
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSBooleanDefs() {
+	type test struct {
+		Given    string
+		Opts     Options
+		Expected string
+	}
+
+	defs := `"$defs": {"Anything": true, "Nothing": false}`
+
+	tests := map[string]test{
+		"true": {
+			Given:    `{"items": {"$ref": "#/$defs/Anything"}, ` + defs + `}`,
+			Expected: `{"items": true}`,
+		},
+		"false": {
+			Given:    `{"items": {"$ref": "#/$defs/Nothing"}, ` + defs + `}`,
+			Expected: `{"items": false}`,
+		},
+		"true with siblings": {
+			Given:    `{"items": {"$ref": "#/$defs/Anything", "description": "any"}, ` + defs + `}`,
+			Expected: `{"items": {"description": "any"}}`,
+		},
+		"false with siblings": {
+			Given:    `{"items": {"$ref": "#/$defs/Nothing", "description": "none"}, ` + defs + `}`,
+			Expected: `{"items": false}`,
+		},
+		"true wrapped": {
+			Given:    `{"items": {"$ref": "#/$defs/Anything", "description": "any"}, ` + defs + `}`,
+			Opts:     Options{WrapBooleanTargets: true},
+			Expected: `{"items": {"allOf": [true], "description": "any"}}`,
+		},
+		"false wrapped": {
+			Given:    `{"items": {"$ref": "#/$defs/Nothing", "description": "none", "allOf": [{"$ref": "#/$defs/Anything"}, {"type": "string"}]}, ` + defs + `}`,
+			Opts:     Options{WrapBooleanTargets: true},
+			Expected: `{"items": {"allOf": [false, true, {"type": "string"}], "description": "none"}}`,
+		},
+		"wrapped without siblings": {
+			Given:    `{"items": {"$ref": "#/$defs/Nothing"}, ` + defs + `}`,
+			Opts:     Options{WrapBooleanTargets: true},
+			Expected: `{"items": false}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}, v.Opts)
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSDedupCombinatorMembers() {
+	fsys := fstest.MapFS{"schema.json": {Data: []byte(`{
+		"allOf": [{"$ref": "#/$defs/A"}, {"$ref": "#/$defs/B"}, {"$ref": "#/$defs/A"}, {"required": ["a"], "type": "object"}],
+		"properties": {
+			"p": {"anyOf": [{"$ref": "#/$defs/B"}, {"$ref": "#/$defs/B", "$schema": "https://json-schema.org/draft/2020-12/schema"}, true, true]},
+			"q": {"oneOf": [{"$ref": "#/$defs/A"}, {"$ref": "#/$defs/A"}]}
+		},
+		"required": ["a", "a"],
+		"enum": [{"a": 1}, {"a": 1}],
+		"$defs": {"A": {"type": "object", "required": ["a"]}, "B": {"minimum": 1.0}}
+	}`)}}
+
+	report := new(Report)
+	updates, err := InlineBundledSchemasInFS(fsys, Options{DedupCombinatorMembers: true, Report: report})
+	j.Require().NoError(err)
+	j.JSONEq(`{
+		"allOf": [{"type": "object", "required": ["a"]}, {"minimum": 1.0}],
+		"properties": {
+			"p": {"anyOf": [{"minimum": 1}, true]},
+			"q": {"oneOf": [{"type": "object", "required": ["a"]}, {"type": "object", "required": ["a"]}]}
+		},
+		"required": ["a", "a"],
+		"enum": [{"a": 1}, {"a": 1}]
+	}`, string(updates["schema.json"]))
+	j.Equal([]Diagnostic{{Path: "schema.json", Message: `oneOf at "#/properties/q" has identical members, which no instance can match`}}, report.Diagnostics)
+
+	updates, err = InlineBundledSchemasInFS(fsys, Options{})
+	j.Require().NoError(err)
+	j.Contains(string(updates["schema.json"]), `"anyOf": [
+        {
+          "minimum": 1.0
+        },
+        {
+          "minimum": 1.0
+        },`)
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSMixedDrafts() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"properties": {
+				"a": {"$ref": "old.json#/properties/a"},
+				"b": {"$ref": "old.json#/properties/b"},
+				"c": {"$ref": "new.json"},
+				"d": {"$ref": "none.json"}
+			}
+		}`)},
+		"old.json":  {Data: []byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"a": {}, "b": {}}}`)},
+		"new.json":  {Data: []byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema"}`)},
+		"none.json": {Data: []byte(`{}`)},
+	}
+
+	report := new(Report)
+	_, err := InlineBundledSchemasInFS(fsys, Options{Report: report})
+	j.Require().NoError(err)
+
+	j.Equal([]Diagnostic{{
+		Path:    "order.json",
+		Message: `inlined content from old.json declares $schema "http://json-schema.org/draft-07/schema#", but the document declares "https://json-schema.org/draft/2020-12/schema"`,
+	}}, report.Diagnostics)
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytes() {
+	type test struct {
+		Given       string
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	fsys := fstest.MapFS{
+		"schemas/address.json": {Data: []byte(`{"$defs": {"Address": {"properties": {"zip": {"$ref": "#/$defs/Zip"}}}, "Zip": {"type": "string"}}}`)},
+		"schemas/loop.json":    {Data: []byte(`{"items": {"$ref": "loop.json"}}`)},
+	}
+
+	tests := map[string]test{
+		"local refs": {
+			Given:    `{"properties": {"a": {"$ref": "#/$defs/A"}}, "$defs": {"A": {"type": "string"}}}`,
+			Expected: `{"properties": {"a": {"type": "string"}}}`,
+		},
+		"sibling file relative to base path": {
+			Given:    `{"properties": {"address": {"$ref": "address.json#/$defs/Address"}}}`,
+			Opts:     Options{FS: fsys, BasePath: "schemas"},
+			Expected: `{"properties": {"address": {"properties": {"zip": {"type": "string"}}}}}`,
+		},
+		"path relative to fs root": {
+			Given:    `{"properties": {"address": {"$ref": "/schemas/address.json#/$defs/Address"}}}`,
+			Opts:     Options{FS: fsys, BasePath: "other"},
+			Expected: `{"properties": {"address": {"properties": {"zip": {"type": "string"}}}}}`,
+		},
+		"max ref hops across files": {
+			Given:    `{"properties": {"address": {"$ref": "../schemas/address.json#/$defs/Address"}}}`,
+			Opts:     Options{FS: fsys, BasePath: "other", InlineMaxRefHops: 1},
+			Expected: `{"properties": {"address": {"properties": {"zip": {"$ref": "../schemas/address.json#/$defs/Zip"}}}}}`,
+		},
+		"no fs": {
+			Given:       `{"$ref": "address.json#/$defs/Address"}`,
+			ExpectedErr: `inline refs: cannot resolve ref to "address.json": no FS configured`,
+		},
+		"missing file": {
+			Given:       `{"$ref": "nope.json"}`,
+			Opts:        Options{FS: fsys, BasePath: "schemas"},
+			ExpectedErr: "inline refs: read schemas/nope.json: open schemas/nope.json: file does not exist",
+		},
+		"outside fs root": {
+			Given:       `{"$ref": "../../address.json"}`,
+			Opts:        Options{FS: fsys, BasePath: "schemas"},
+			ExpectedErr: `inline refs: ref to "../../address.json" resolves outside of the FS root`,
+		},
+		"missing def in other file": {
+			Given:       `{"$ref": "address.json#/$defs/Nope"}`,
+			Opts:        Options{FS: fsys, BasePath: "schemas"},
+			ExpectedErr: `inline refs: schemas/address.json: unresolved $ref "#/$defs/Nope": missing key "Nope"`,
+		},
+		"cycle across files": {
+			Given:       `{"$ref": "loop.json"}`,
+			Opts:        Options{FS: fsys, BasePath: "schemas"},
+			ExpectedErr: "inline refs: cyclic $ref detected: schemas/loop.json# -> schemas/loop.json#",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if !j.NoError(err) {
+				return
+			}
+			j.JSONEq(v.Expected, string(out))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSTopLevelSchema() {
+	type test struct {
+		Given    string
+		Expected string
+	}
+
+	tests := map[string]test{
+		"whole document ref": {
+			Given:    `{"$ref": "other.json"}`,
+			Expected: `{"$schema": "other", "type": "string"}`,
+		},
+		"whole document ref with an empty fragment": {
+			Given:    `{"$ref": "other.json#"}`,
+			Expected: `{"$schema": "other", "type": "string"}`,
+		},
+		"chain of whole document refs": {
+			Given:    `{"$ref": "alias.json"}`,
+			Expected: `{"$schema": "other", "type": "string"}`,
+		},
+		"own $schema wins": {
+			Given:    `{"$schema": "root", "$ref": "other.json"}`,
+			Expected: `{"$schema": "root", "type": "string"}`,
+		},
+		"nested $schema of a def in another document": {
+			Given:    `{"$ref": "other.json#/$defs/X"}`,
+			Expected: `{"type": "integer"}`,
+		},
+		"nested $schema of a local def": {
+			Given:    `{"$ref": "#/$defs/X", "$defs": {"X": {"$schema": "nested", "type": "null"}}}`,
+			Expected: `{"type": "null"}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{
+				"root.json":  {Data: []byte(v.Given)},
+				"alias.json": {Data: []byte(`{"$ref": "other.json"}`)},
+				"other.json": {Data: []byte(`{"$schema": "other", "type": "string", "$defs": {"X": {"$schema": "nested", "type": "integer"}}}`)},
+			}
+			updates, err := InlineBundledSchemasInFS(fsys)
+			if j.NoError(err) {
+				j.JSONEq(v.Expected, string(updates["root.json"]))
+			}
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSArrayRoot() {
+	type test struct {
+		Given       string
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"each element is a schema": {
+			Given: `[
+				{"$schema": "a", "$id": "a", "items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"type": "string"}}},
+				{"$schema": "b", "items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"type": "integer"}}},
+				{"$ref": "other.json"},
+				true
+			]`,
+			Expected: `[
+				{"$schema": "a", "items": {"type": "string"}},
+				{"$schema": "b", "items": {"type": "integer"}},
+				{"$schema": "other", "type": "null"},
+				true
+			]`,
+		},
+		"empty": {
+			Given:    `[]`,
+			Expected: `[]`,
+		},
+		"ref to the array": {
+			Given:       `[{"items": {"$ref": "#/0"}}]`,
+			ExpectedErr: `inline refs in root.json: element 0: unresolved $ref "#/0": missing key "0"`,
+		},
+		"nested array": {
+			Given:       `[{}, []]`,
+			ExpectedErr: "inline refs in root.json: element 1 is an array, not a schema",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{
+				"root.json":  {Data: []byte(v.Given)},
+				"other.json": {Data: []byte(`{"$schema": "other", "type": "null"}`)},
+			}
+			updates, err := InlineBundledSchemasInFS(fsys)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["root.json"]))
+		})
+	}
+
+	// Other documents point into the array as it is.
+	fsys := fstest.MapFS{
+		"list.json": {Data: []byte(`[{"$defs": {"A": {"type": "string"}}}]`)},
+		"root.json": {Data: []byte(`{"items": {"$ref": "list.json#/0/$defs/A"}}`)},
+	}
+	updates, err := InlineBundledSchemasInFS(fsys)
+	j.Require().NoError(err)
+	j.JSONEq(`{"items": {"type": "string"}}`, string(updates["root.json"]))
+	j.JSONEq(`[{}]`, string(updates["list.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestResolveDocument() {
+	var given any
+	j.Require().NoError(json.Unmarshal([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "root",
+		"properties": {"a": {"$ref": "#/$defs/A"}},
+		"$defs": {"A": {"type": "string"}}
+	}`), &given))
+	original, err := deepClone(given)
+	j.Require().NoError(err)
+
+	resolved, err := ResolveDocument(given, Options{})
+	j.Require().NoError(err)
+
+	j.Equal(map[string]any{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"properties": map[string]any{"a": map[string]any{"type": "string"}},
+	}, resolved)
+	j.Equal(original, given)
+
+	_, err = ResolveDocument(map[string]any{"$ref": "#/$defs/A"}, Options{})
+	j.EqualError(err, `inline refs: unresolved $ref "#/$defs/A": missing key "$defs"`)
+}
+
+func (j *JSONSchemaTestSuite) TestInlineFragment() {
+	type test struct {
+		Fragment    func(root map[string]any) any
+		Opts        Options
+		Expected    any
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"def": {
+			Fragment: func(root map[string]any) any { return root["$defs"].(map[string]any)["User"] },
+			Expected: map[string]any{
+				"$schema":    "https://json-schema.org/draft/2020-12/schema",
+				"properties": map[string]any{"name": map[string]any{"type": "string"}},
+			},
+		},
+		"kept defs": {
+			Fragment: func(root map[string]any) any { return root["$defs"].(map[string]any)["User"] },
+			Opts:     Options{KeepDefs: true},
+			Expected: map[string]any{
+				"$schema":    "https://json-schema.org/draft/2020-12/schema",
+				"properties": map[string]any{"name": map[string]any{"$ref": "#/$defs/Name"}},
+				"$defs": map[string]any{
+					"User": map[string]any{"properties": map[string]any{"name": map[string]any{"$ref": "#/$defs/Name"}}},
+					"Name": map[string]any{"type": "string"},
+				},
+			},
+		},
+		"detached": {
+			Fragment: func(map[string]any) any { return map[string]any{"items": map[string]any{"$ref": "#/$defs/Name"}} },
+			Expected: map[string]any{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"items":   map[string]any{"type": "string"},
+			},
+		},
+		"missing": {
+			Fragment:    func(map[string]any) any { return map[string]any{"$ref": "#/$defs/Missing"} },
+			ExpectedErr: `inline refs: unresolved $ref "#/$defs/Missing": missing key "Missing"`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			var root map[string]any
+			j.Require().NoError(json.Unmarshal([]byte(`{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {"user": {"$ref": "#/$defs/User"}},
+				"$defs": {
+					"User": {"properties": {"name": {"$ref": "#/$defs/Name"}}},
+					"Name": {"type": "string"}
+				}
+			}`), &root))
+			original, err := deepClone(root)
+			j.Require().NoError(err)
+
+			resolved, err := InlineFragment(v.Fragment(root), root, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.Equal(v.Expected, resolved)
+			j.Equal(original, any(root))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSOnMissingRef() {
+	type test struct {
+		Given               MissingRefPolicy
+		Expected            string
+		ExpectedDiagnostics []Diagnostic
+		ExpectedErr         string
+	}
+
+	given := `{
+		"properties": {
+			"a": {"$ref": "#/$defs/Renamed", "description": "a"},
+			"b": {"$ref": "#/$defs/B"},
+			"c": {"$ref": "gone.json"}
+		},
+		"allOf": [{"$ref": "#/$defs/Renamed"}, {"type": "object"}],
+		"$defs": {"B": {"type": "string"}}
+	}`
+
+	tests := map[string]test{
+		"error": {
+			Given:       MissingRefError,
+			ExpectedErr: `unresolved $ref "#/$defs/Renamed": missing key "Renamed"`,
+		},
+		"warn": {
+			Given: MissingRefWarn,
+			Expected: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/Renamed", "description": "a"},
+					"b": {"type": "string"},
+					"c": {"$ref": "gone.json"}
+				},
+				"allOf": [{"$ref": "#/$defs/Renamed"}, {"type": "object"}]
+			}`,
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "schema.json", Message: `left unresolved $ref "#/$defs/Renamed": unresolved $ref "#/$defs/Renamed": missing key "Renamed"`},
+				{Path: "schema.json", Message: `left unresolved $ref "#/$defs/Renamed": unresolved $ref "#/$defs/Renamed": missing key "Renamed"`},
+				{Path: "schema.json", Message: `left unresolved $ref "gone.json": read gone.json: open gone.json: file does not exist`},
+			},
+		},
+		"remove": {
+			Given: MissingRefRemove,
+			Expected: `{
+				"properties": {"b": {"type": "string"}},
+				"allOf": [true, {"type": "object"}]
+			}`,
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "schema.json", Message: `removed unresolved $ref "#/$defs/Renamed": unresolved $ref "#/$defs/Renamed": missing key "Renamed"`},
+				{Path: "schema.json", Message: `removed unresolved $ref "#/$defs/Renamed": unresolved $ref "#/$defs/Renamed": missing key "Renamed"`},
+				{Path: "schema.json", Message: `removed unresolved $ref "gone.json": read gone.json: open gone.json: file does not exist`},
+			},
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(given)}}
+
+			report := new(Report)
+			updates, err := InlineBundledSchemasInFS(fsys, Options{OnMissingRef: v.Given, Report: report})
+			if v.ExpectedErr != "" {
+				j.ErrorContains(err, v.ExpectedErr)
+				return
+			}
+			if !j.NoError(err) {
+				return
+			}
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+			j.ElementsMatch(v.ExpectedDiagnostics, report.Diagnostics)
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSOnDynamicRef() {
+	type test struct {
+		Opts                Options
+		Expected            string
+		ExpectedDiagnostics []Diagnostic
+		ExpectedErr         string
+	}
+
+	given := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$ref": "#/$defs/Tree",
+		"$defs": {
+			"Tree": {
+				"$dynamicAnchor": "node",
+				"type": "object",
+				"properties": {"children": {"type": "array", "items": {"$dynamicRef": "#node"}}}
+			}
+		}
+	}`
+
+	tests := map[string]test{
+		"error": {
+			ExpectedErr: `inline refs in tree.json: cannot inline $dynamicRef "#node": its target depends on the dynamic scope`,
+		},
+		"warn": {
+			Opts: Options{OnDynamicRef: DynamicRefWarn},
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"$dynamicAnchor": "node",
+				"type": "object",
+				"properties": {"children": {"type": "array", "items": {"$dynamicRef": "#node"}}}
+			}`,
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "tree.json", Message: `left $dynamicRef "#node" in place: its target depends on the dynamic scope`},
+			},
+		},
+		"warn but require fully inlined": {
+			Opts:        Options{OnDynamicRef: DynamicRefWarn, RequireFullyInlined: true},
+			ExpectedErr: `inline refs in tree.json: not fully inlined, $refs remain: "#node" at "#/properties/children/items"`,
+		},
+		"unknown policy": {
+			Opts:        Options{OnDynamicRef: "Resolve"},
+			ExpectedErr: `inline refs in tree.json: unknown dynamic ref policy "Resolve"`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"tree.json": {Data: []byte(given)}}
+
+			report := new(Report)
+			opts := v.Opts
+			opts.Report = report
+			updates, err := InlineBundledSchemasInFS(fsys, opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["tree.json"]))
+			j.Equal(v.ExpectedDiagnostics, report.Diagnostics)
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSDetectConflicts() {
+	type test struct {
+		Opts                Options
+		ExpectedDiagnostics []Diagnostic
+		ExpectedErr         string
+	}
+
+	given := `{
+		"properties": {
+			"a": {"$ref": "#/$defs/A", "type": "number", "description": "a", "minLength": 1},
+			"b": {"$ref": "#/$defs/A", "type": "string", "maxLength": 2, "required": ["b"]}
+		},
+		"$defs": {"A": {"type": "string", "description": "A", "maxLength": 3, "required": ["a"]}}
+	}`
+
+	tests := map[string]test{
+		"ignore": {},
+		"warn": {
+			Opts: Options{DetectConflicts: ConflictWarn},
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "schema.json", Message: `sibling "type" of $ref "#/$defs/A" overrides "string" from the target with "number"`},
+				{Path: "schema.json", Message: `sibling "maxLength" of $ref "#/$defs/A" overrides 3 from the target with 2`},
+				{Path: "schema.json", Message: `sibling "required" of $ref "#/$defs/A" overrides ["a"] from the target with ["b"]`},
+			},
+		},
+		"warn with union types": {
+			Opts: Options{DetectConflicts: ConflictWarn, UnionTypes: true},
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "schema.json", Message: `sibling "maxLength" of $ref "#/$defs/A" overrides 3 from the target with 2`},
+				{Path: "schema.json", Message: `sibling "required" of $ref "#/$defs/A" overrides ["a"] from the target with ["b"]`},
+			},
+		},
+		"warn with merge arrays": {
+			Opts: Options{DetectConflicts: ConflictWarn, MergeArrays: true},
+			ExpectedDiagnostics: []Diagnostic{
+				{Path: "schema.json", Message: `sibling "type" of $ref "#/$defs/A" overrides "string" from the target with "number"`},
+				{Path: "schema.json", Message: `sibling "maxLength" of $ref "#/$defs/A" overrides 3 from the target with 2`},
+			},
+		},
+		"error": {
+			Opts:        Options{DetectConflicts: ConflictError},
+			ExpectedErr: `inline refs in schema.json: sibling "`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(given)}}
+
+			report := new(Report)
+			v.Opts.Report = report
+			_, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				j.ErrorContains(err, v.ExpectedErr)
+				return
+			}
+			if !j.NoError(err) {
+				return
+			}
+			j.ElementsMatch(v.ExpectedDiagnostics, report.Diagnostics)
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytesRemoveMissingRoot() {
+	_, err := InlineSchemaBytes([]byte(`{"$ref": "#/$defs/Nope"}`), Options{OnMissingRef: MissingRefRemove})
+	j.EqualError(err, "inline refs: document root is an unresolved $ref")
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytesRemoveMissingRef() {
+	type test struct {
+		Given       string
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"allOf member": {
+			Given:    `{"allOf": [{"$ref": "#/$defs/Gone"}]}`,
+			Expected: `{"allOf": [true]}`,
+		},
+		"prefixItems keep positions": {
+			Given:    `{"prefixItems": [{"$ref": "#/$defs/Gone"}, {"type": "integer"}]}`,
+			Expected: `{"prefixItems": [true, {"type": "integer"}]}`,
+		},
+		"property": {
+			Given:    `{"properties": {"a": {"$ref": "#/$defs/Gone"}, "b": {"type": "string"}}}`,
+			Expected: `{"properties": {"b": {"type": "string"}}}`,
+		},
+		"not": {
+			Given:       `{"items": {"not": {"$ref": "#/$defs/Gone"}}}`,
+			ExpectedErr: `inline refs: can't remove the unresolved $ref at "#/items/not": dropping "not" would lift its constraint`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), Options{OnMissingRef: MissingRefRemove})
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(out))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSBlankFiles() {
+	type test struct {
+		Given string
+	}
+
+	tests := map[string]test{
+		"empty":              {Given: ""},
+		"whitespace":         {Given: " \n\t\r\n"},
+		"bom only":           {Given: "\xEF\xBB\xBF"},
+		"bom and whitespace": {Given: "\xEF\xBB\xBF\n  \n"},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			fsys := fstest.MapFS{
+				"blank.json":  {Data: []byte(v.Given)},
+				"schema.json": {Data: []byte(`{"type": "string"}`)},
+			}
+
+			report := new(Report)
+			updates, err := InlineBundledSchemasInFS(fsys, Options{Report: report})
+			if !j.NoError(err) {
+				return
+			}
+			j.Contains(updates, "schema.json")
+			j.NotContains(updates, "blank.json")
+			j.Equal([]Diagnostic{{Path: "blank.json", Message: "skipped empty file"}}, report.Diagnostics)
+
+			_, err = InlineBundledSchemasInFS(fsys, Options{StrictEmpty: true})
+			j.EqualError(err, "parse blank.json: empty file")
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytesEscapeHTML() {
+	out, err := InlineSchemaBytes([]byte(`{
+		"description": "must be > 0, see <https://example.com/?a=1&b=2>",
+		"properties": {"a&b": {"$ref": "#/$defs/A"}},
+		"$defs": {"A": {"pattern": "^<[a-z]+>$"}}
+	}`), Options{})
+	j.Require().NoError(err)
+	j.Equal(`{
+  "description": "must be > 0, see <https://example.com/?a=1&b=2>",
+  "properties": {
+    "a&b": {
+      "pattern": "^<[a-z]+>$"
+    }
+  }
+}
+`, string(out))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineSchemaBytesLineEnding() {
+	type test struct {
+		Given       LineEnding
+		Expected    string
+		ExpectedErr string
+	}
+
+	crlf := "{\r\n  \"description\": \"a\\nb\"\r\n}\r\n"
+	lf := "{\n  \"description\": \"a\\nb\"\n}\n"
+	auto := lf
+	if runtime.GOOS == "windows" {
+		auto = crlf
+	}
+
+	tests := map[string]test{
+		"default": {Expected: lf},
+		"lf":      {Given: LineEndingLF, Expected: lf},
+		"crlf":    {Given: LineEndingCRLF, Expected: crlf},
+		"auto":    {Given: LineEndingAuto, Expected: auto},
+		"unknown": {Given: "CR", ExpectedErr: `unknown line ending "CR"`},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(`{"description": "a\nb"}`), Options{LineEnding: v.Given})
+			if v.ExpectedErr != "" {
+				j.ErrorContains(err, v.ExpectedErr)
+				return
+			}
+			if !j.NoError(err) {
+				return
+			}
+			j.Equal(v.Expected, string(out))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSStripAnnotations() {
+	type test struct {
+		Opts     Options
+		Expected string
+	}
+
+	fsys := fstest.MapFS{"schema.json": {Data: []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$comment": "Top-level comment.",
+		"title": "Order",
+		"description": "An order.",
+		"properties": {
+			"title": {"type": "string", "title": "Title", "examples": ["Mr"]},
+			"status": {"$ref": "#/$defs/Status", "description": "Where it's at.", "deprecated": true},
+			"id": {"type": "string", "readOnly": true, "default": {"title": "kept, it's data"}},
+			"secret": {"type": "string", "writeOnly": true},
+			"label": {"const": {"description": "kept"}, "default": {"$ref": "#/properties/title/title"}}
+		},
+		"$defs": {"Status": {"enum": ["new", "done"], "title": "Status", "default": "new"}}
+	}`)}}
+
+	tests := map[string]test{
+		"default keywords": {
+			Opts: Options{StripAnnotations: true},
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"properties": {
+					"title": {"type": "string"},
+					"status": {"enum": ["new", "done"]},
+					"id": {"type": "string"},
+					"secret": {"type": "string"},
+					"label": {"const": {"description": "kept"}}
+				}
+			}`,
+		},
+		"custom keywords": {
+			Opts: Options{StripAnnotations: true, AnnotationKeywords: []string{"examples", "deprecated"}},
+			Expected: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"$comment": "Top-level comment.",
+				"title": "Order",
+				"description": "An order.",
+				"properties": {
+					"title": {"type": "string", "title": "Title"},
+					"status": {"enum": ["new", "done"], "title": "Status", "default": "new", "description": "Where it's at."},
+					"id": {"type": "string", "readOnly": true, "default": {"title": "kept, it's data"}},
+					"secret": {"type": "string", "writeOnly": true},
+					"label": {"const": {"description": "kept"}, "default": "Title"}
+				}
+			}`,
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			j.Require().NoError(err)
+			j.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSMarshaler() {
+	type test struct {
+		Opts        Options
+		Path        string
+		Expected    string
+		ExpectedErr string
+	}
+
+	fsys := fstest.MapFS{
+		"a.json":   {Data: []byte(`{"description": "<b>Tom & Jerry</b>", "not": {"$ref": "#/$defs/A"}, "$defs": {"A": {"const": "a<b"}}}`)},
+		"b.ndjson": {Data: []byte(`{"description": "<i>x</i>"}` + "\n")},
+	}
+
+	tests := map[string]test{
+		"html left alone": {
+			Path:     "a.json",
+			Expected: "{\n  \"description\": \"<b>Tom & Jerry</b>\",\n  \"not\": {\n    \"const\": \"a<b\"\n  }\n}\n",
+		},
+		"html left alone in keyword order": {
+			Opts:     Options{KeywordOrder: DefaultKeywordOrder, Indent: "\t"},
+			Path:     "a.json",
+			Expected: "{\n\t\"description\": \"<b>Tom & Jerry</b>\",\n\t\"not\": {\n\t\t\"const\": \"a<b\"\n\t}\n}\n",
+		},
+		"custom": {
+			Opts:     Options{Marshaler: json.Marshal},
+			Path:     "a.json",
+			Expected: `{"description":"\u003cb\u003eTom \u0026 Jerry\u003c/b\u003e","not":{"const":"a\u003cb"}}` + "\n",
+		},
+		"custom ndjson": {
+			Opts: Options{Marshaler: func(v any) ([]byte, error) {
+				return json.MarshalIndent(v, "", "    ")
+			}},
+			Path:     "b.ndjson",
+			Expected: `{"description":"\u003ci\u003ex\u003c/i\u003e"}` + "\n",
+		},
+		"error": {
+			Opts: Options{Marshaler: func(any) ([]byte, error) {
+				return nil, errors.New("no thanks")
+			}},
+			ExpectedErr: "marshal a.json: no thanks",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				j.EqualError(err, v.ExpectedErr)
+				return
+			}
+			j.Require().NoError(err)
+			j.Equal(v.Expected, string(updates[v.Path]))
+		})
+	}
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSFormatOnly() {
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(`{"type":"object","$id":"a","properties":{"b":{"$ref":"b.json#/$defs/B"}},"$schema":"x","examples":[{}],"$defs":{"A":{}}}`)},
+		"b.json": {Data: []byte(`{"$defs": {"B": {"$ref": "#/$defs/Gone"}}}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{
+		FormatOnly:          true,
+		KeywordOrder:        DefaultKeywordOrder,
+		RequireFullyInlined: true,
+		ExtractExamples:     true,
+	})
+	j.Require().NoError(err)
+	j.Equal([]string{"a.json", "b.json"}, slices.Sorted(maps.Keys(updates)))
+	j.Equal(`{
+  "$schema": "x",
+  "$id": "a",
+  "type": "object",
+  "examples": [
+    {}
+  ],
+  "properties": {
+    "b": {
+      "$ref": "b.json#/$defs/B"
+    }
+  },
+  "$defs": {
+    "A": {}
+  }
+}
+`, string(updates["a.json"]))
+}
+
+func (j *JSONSchemaTestSuite) TestInlineBundledSchemasInFSEmbed() {
+	fsys, err := fs.Sub(embedded, "testdata/embedded")
+	j.Require().NoError(err)
+
+	updates, err := InlineBundledSchemasInFS(fsys)
+	j.Require().NoError(err)
+	j.Equal([]string{"common/id.json", "order.json"}, slices.Sorted(maps.Keys(updates)))
+	j.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "string",
+		"pattern": "^[A-Z0-9]+$"
+	}`, string(updates["common/id.json"]))
+
+	// Nothing was written back.
+	b, err := fs.ReadFile(fsys, "order.json")
+	j.Require().NoError(err)
+	j.Contains(string(b), `"$defs"`)
+}
+
+func (j *JSONSchemaTestSuite) TestStripKeys() {
+	var given any
+	j.Require().NoError(json.Unmarshal([]byte(`{
+		"$schema": "top",
+		"$id": "top",
+		"items": {"$schema": "nested", "$id": "nested", "type": "string"}
+	}`), &given))
+
+	stripped, err := stripKeys(given, "top", Options{}.stripSet(), Options{})
+	j.Require().NoError(err)
+	j.Equal(map[string]any{
+		"$schema": "top",
+		"items":   map[string]any{"type": "string"},
+	}, stripped)
+}
+
+func (j *JSONSchemaTestSuite) TestResolveDocumentMaxDepth() {
+	cyclic := map[string]any{"type": "object"}
+	cyclic["properties"] = map[string]any{"self": cyclic}
+
+	type test struct {
+		Given       any
+		Opts        Options
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"cyclic tree": {
+			Given:       cyclic,
+			ExpectedErr: "inline refs: schema nests deeper than 10000 levels; it may be cyclic",
+		},
+		"cyclic tree with target draft": {
+			Given:       cyclic,
+			Opts:        Options{TargetDraft: Draft202012},
+			ExpectedErr: "schema nests deeper than 10000 levels; it may be cyclic",
+		},
+		"cyclic ref target": {
+			Given: map[string]any{
+				"$ref":  "#/$defs/A",
+				"$defs": map[string]any{"A": cyclic},
+			},
+			ExpectedErr: `inline refs: copy target of $ref "#/$defs/A": json: unsupported value: encountered a cycle via map[string]interface {}`,
+		},
+		"cyclic tree with anchor ref": {
+			Given: map[string]any{
+				"$ref":  "#a",
+				"$defs": map[string]any{"A": cyclic},
+			},
+			ExpectedErr: "inline refs: schema nests deeper than 10000 levels; it may be cyclic",
+		},
+		"custom max depth": {
+			Given:       map[string]any{"items": map[string]any{"items": map[string]any{}}},
+			Opts:        Options{MaxDepth: 2},
+			ExpectedErr: "inline refs: schema nests deeper than 2 levels; it may be cyclic",
+		},
+		"max depth counts inlined content": {
+			Given: map[string]any{
+				"items": map[string]any{"$ref": "#/$defs/A"},
+				"$defs": map[string]any{"A": map[string]any{"items": map[string]any{}}},
+			},
+			Opts:        Options{MaxDepth: 3},
+			ExpectedErr: "inline refs: schema nests deeper than 3 levels; it may be cyclic",
+		},
+	}
+
+	for desc, v := range tests {
+		j.Run(desc, func() {
+			_, err := ResolveDocument(v.Given, v.Opts)
+			j.EqualError(err, v.ExpectedErr)
+		})
+	}
+}
+
+func FuzzInlineSchema(f *testing.F) {
+	seeds := []string{
+		`{"properties": {"a": {"$ref": "#/$defs/A"}}, "$defs": {"A": {"type": "string"}}}`,
+		`{"$ref": "#/$defs/A", "$defs": {"A": {"$ref": "#/$defs/B"}, "B": {"items": {"$ref": "#/$defs/A"}}}}`,
+		`{"$ref": "#/items/0", "items": [{"type": "string"}]}`,
+		`{"$ref": "#/$defs/A/type/0", "$defs": {"A": {"type": ["string"]}}}`,
+		`{"$ref": "#"}`,
+		`{"$ref": "#/"}`,
+		`{"$ref": "#~"}`,
+		`{"$ref": 1}`,
+		`{"$ref": "other.json"}`,
+		`{"$ref": "https://example.com/x"}`,
+		`{"definitions": {"A": {"id": 1}}, "dependencies": {"a": []}, "items": [], "additionalItems": {"$ref": "#/definitions/A"}}`,
+		`{"$defs": {"A": {"$anchor": "a"}}, "properties": {"a": {"$ref": "#/$defs/A", "type": "null"}}}`,
+		`[{"$ref": "#/0"}]`,
+		`true`,
+		`"$ref"`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed), uint8(0))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte, flags uint8) {
+		opts := Options{
+			KeepAnchoredDefs:   flags&1 != 0,
+			AnnotateProvenance: flags&2 != 0,
+			UnionTypes:         flags&4 != 0,
+			MergeArrays:        flags&4 != 0,
+			InlineMaxRefHops:   int(flags>>6) & 3,
+			FS:                 fstest.MapFS{"other.json": {Data: []byte(`{"$ref": "#/$defs/A", "$defs": {"A": {}}}`)}},
+		}
+		if flags&8 != 0 {
+			opts.TargetDraft = Draft202012
+		}
+		switch (flags >> 4) & 3 {
+		case 1:
+			opts.OnMissingRef = MissingRefWarn
+		case 2:
+			opts.OnMissingRef = MissingRefRemove
+		}
+
+		out, err := InlineSchemaBytes(b, opts)
+		if err != nil {
+			return
+		}
+		if !json.Valid(out) {
+			t.Fatalf("invalid output %q for input %q", out, b)
+		}
+	})
+}
+
+func BenchmarkGetByPointer(b *testing.B) {
+	// A bundle of defs nested 32 deep, each level keyed by a token that
+	// needs unescaping, resolved the way a hot def is: over and over.
+	root := map[string]any{"type": "string"}
+	ptr := ""
+	for i := range 32 {
+		key := fmt.Sprintf("a/b~%d", i)
+		root = map[string]any{"$defs": map[string]any{key: root}}
+		ptr = "/$defs/" + escapeToken(key) + ptr
+	}
+	ptr = "#" + ptr
+
+	cache := &docCache{}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := getByPointer(root, ptr, cache); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestJSONSchemaTestSuite(t *testing.T) {
+	suite.Run(t, new(JSONSchemaTestSuite))
+}
@@ -0,0 +1,112 @@
+package schema
+
+// schemaMapKeywords hold objects whose values are schemas but whose keys are
+// names, not keywords.
+var schemaMapKeywords = map[string]bool{
+	"$defs":             true,
+	"definitions":       true,
+	"properties":        true,
+	"patternProperties": true,
+	"dependentSchemas":  true,
+	"dependencies":      true,
+}
+
+// schemaArrayKeywords hold arrays of schemas.
+var schemaArrayKeywords = map[string]bool{
+	"allOf":       true,
+	"anyOf":       true,
+	"oneOf":       true,
+	"prefixItems": true,
+	"items":       true, // draft-07 tuple form
+}
+
+// schemaKeywords hold a single schema.
+var schemaKeywords = map[string]bool{
+	"items":                 true,
+	"additionalItems":       true,
+	"additionalProperties":  true,
+	"contains":              true,
+	"propertyNames":         true,
+	"not":                   true,
+	"if":                    true,
+	"then":                  true,
+	"else":                  true,
+	"unevaluatedItems":      true,
+	"unevaluatedProperties": true,
+	"contentSchema":         true,
+}
+
+// dataKeywords hold instance data rather than schemas.
+var dataKeywords = map[string]bool{
+	"enum":     true,
+	"const":    true,
+	"default":  true,
+	"examples": true,
+}
+
+// DefaultAnnotationKeywords are the keywords of the standard annotation
+// vocabulary, along with $comment. Options.AnnotationKeywords defaults to
+// them.
+var DefaultAnnotationKeywords = []string{
+	"$comment", "title", "description", "default", "examples", "deprecated", "readOnly", "writeOnly",
+}
+
+// annotationKeywords describe a schema without constraining instances, so a
+// $ref sibling overriding them isn't a conflict.
+var annotationKeywords = func() map[string]bool {
+	set := map[string]bool{}
+	for _, k := range DefaultAnnotationKeywords {
+		set[k] = true
+	}
+	return set
+}()
+
+// mergeableArrayKeywords hold arrays that Options.MergeArrays unions rather than
+// replaces.
+var mergeableArrayKeywords = map[string]bool{
+	"required": true,
+	"allOf":    true,
+	"enum":     true,
+}
+
+// mapSubschemas calls fn on each direct subschema of schema, replacing it with
+// the result. Keys of schemaMapKeywords objects are left alone. schema itself
+// is not modified.
+func mapSubschemas(schema map[string]any, fn func(sub any) any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch {
+		case schemaMapKeywords[k]:
+			if m, ok := v.(map[string]any); ok {
+				subs := make(map[string]any, len(m))
+				for name, sub := range m {
+					subs[name] = fn(sub)
+				}
+				v = subs
+			} else if o, ok := v.(orderedObject); ok {
+				// Already ordered, like the $defs of a bundle.
+				subs := make(map[string]any, len(o.m))
+				for name, sub := range o.m {
+					subs[name] = fn(sub)
+				}
+				v = orderedObject{keys: o.keys, m: subs}
+			}
+		case schemaArrayKeywords[k]:
+			if a, ok := v.([]any); ok {
+				subs := make([]any, len(a))
+				for i, sub := range a {
+					subs[i] = fn(sub)
+				}
+				v = subs
+				break
+			}
+			if schemaKeywords[k] {
+				v = fn(v)
+			}
+		case schemaKeywords[k]:
+			v = fn(v)
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package schema
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Severity ranks a Finding.
+type Severity string
+
+const (
+	// SeverityWarning is a convention violation that inlining tolerates.
+	SeverityWarning Severity = "warning"
+	// SeverityError is a problem that makes inlining fail.
+	SeverityError Severity = "error"
+)
+
+// Finding is a problem reported by Lint.
+type Finding struct {
+	// Path is the file the finding applies to.
+	Path string
+	// Pointer is the JSON Pointer of the offending value within the file.
+	Pointer  string
+	Severity Severity
+	// Rule names the check that produced the finding, e.g. "unused-def".
+	Rule    string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s#%s: %s: %s (%s)", f.Path, f.Pointer, f.Severity, f.Message, f.Rule)
+}
+
+// Lint checks every *.json file in fsys against the conventions the inliner
+// relies on, without modifying anything. It reports, by rule:
+//
+//   - "unresolved-ref", an error: a $ref whose target can't be resolved.
+//   - "ref-siblings": a $ref next to keywords other than annotations, which
+//     are merged into its target, replacing any the target sets.
+//   - "def-title": a $defs entry without a "title".
+//   - "unused-def": a top-level $defs entry no $ref in fsys points into.
+//     Entries declaring an $anchor are exempt, since they may be referenced
+//     from elsewhere.
+//   - "id-path": an absolute top-level $id whose path doesn't end with the
+//     file's path, with or without the ".json" extension.
+//
+// Findings are sorted by path and pointer. The error is only non-nil if fsys
+// can't be read, or a file fails to parse or nests deeper than MaxDepth.
+func Lint(fsys fs.FS, options ...Option) ([]Finding, error) {
+	opts := buildOptions(options)
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	in := newInliner(opts)
+	if err := in.indexIDs(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	used := map[string]bool{}
+	for _, p := range in.cache.paths() {
+		doc, _ := in.cache.get(p)
+		add := func(ptr string, sev Severity, rule, format string, args ...any) {
+			findings = append(findings, Finding{Path: p, Pointer: ptr, Severity: sev, Rule: rule, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if doc.id != "" && !idMatchesPath(doc.id, p) {
+			add("/$id", SeverityWarning, "id-path", "$id %q doesn't match the file path", doc.id)
+		}
+		scopes := embeddedScopes{}
+		err := walkSchemas(doc.root, "", opts.maxDepth(), func(m map[string]any, ptr string) {
+			scope := scopes.at(doc, m, ptr)
+			if ref, ok := m[opts.refKeyword()].(string); ok {
+				if target, err := in.resolveRef(ref, scope); err != nil {
+					add(ptr+"/"+escapeToken(opts.refKeyword()), SeverityError, "unresolved-ref", "%v", err)
+				} else if name, ok := defName(target.frag); ok {
+					used[target.doc.path+"#"+name] = true
+				}
+				var merged []string
+				for _, k := range slices.Sorted(maps.Keys(m)) {
+					if k != opts.refKeyword() && k != "$defs" && !annotationKeywords[k] {
+						merged = append(merged, k)
+					}
+				}
+				if len(merged) > 0 {
+					add(ptr, SeverityWarning, "ref-siblings", "%q next to $ref %q are merged into its target", merged, ref)
+				}
+			}
+			defs, _ := m["$defs"].(map[string]any)
+			for name, def := range defs {
+				if d, ok := def.(map[string]any); ok && d["title"] == nil {
+					add(ptr+"/$defs/"+escapeToken(name), SeverityWarning, "def-title", "$defs entry %q has no title", name)
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	for _, p := range in.cache.paths() {
+		doc, _ := in.cache.get(p)
+		m, _ := doc.root.(map[string]any)
+		defs, _ := m["$defs"].(map[string]any)
+		for name, def := range defs {
+			if d, ok := def.(map[string]any); ok && d["$anchor"] != nil {
+				continue
+			}
+			if !used[p+"#"+name] {
+				findings = append(findings, Finding{
+					Path:     p,
+					Pointer:  "/$defs/" + escapeToken(name),
+					Severity: SeverityWarning,
+					Rule:     "unused-def",
+					Message:  fmt.Sprintf("$defs entry %q is never referenced", name),
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Pointer, b.Pointer), strings.Compare(a.Rule, b.Rule))
+	})
+	return findings, nil
+}
+
+// HasErrors reports whether any of findings is an error.
+func HasErrors(findings []Finding) bool {
+	return slices.ContainsFunc(findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+// walkSchemas calls fn on every object in node that is a schema, along with
+// its JSON Pointer, starting with node itself at ptr. Values of data keywords
+// like "enum" are skipped, as are the keys of objects like "properties". It
+// returns an error if node nests max levels deep, as a cyclic tree does.
+func walkSchemas(node any, ptr string, max int, fn func(m map[string]any, ptr string)) error {
+	return walkSchemasAt(node, ptr, 0, max, fn)
+}
+
+func walkSchemasAt(node any, ptr string, depth, max int, fn func(m map[string]any, ptr string)) error {
+	if depth >= max {
+		return errMaxDepth(max)
+	}
+	switch v := node.(type) {
+	case map[string]any:
+		fn(v, ptr)
+		for k, child := range v {
+			childPtr := ptr + "/" + escapeToken(k)
+			switch {
+			case dataKeywords[k]:
+			case schemaMapKeywords[k]:
+				subs, _ := child.(map[string]any)
+				for name, sub := range subs {
+					if err := walkSchemasAt(sub, childPtr+"/"+escapeToken(name), depth+2, max, fn); err != nil {
+						return err
+					}
+				}
+			default:
+				if err := walkSchemasAt(child, childPtr, depth+1, max, fn); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if err := walkSchemasAt(child, fmt.Sprintf("%s/%d", ptr, i), depth+1, max, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// idMatchesPath reports whether the path of the URI id ends with the file path
+// p, ignoring a ".json" extension on either.
+func idMatchesPath(id, p string) bool {
+	u, err := url.Parse(id)
+	if err != nil {
+		return false
+	}
+	idPath := strings.TrimSuffix(u.Path, ".json")
+	p = strings.TrimSuffix(p, ".json")
+	return idPath == p || strings.HasSuffix(idPath, "/"+p)
+}
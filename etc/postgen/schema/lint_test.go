@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LintTestSuite struct {
+	suite.Suite
+}
+
+func (l *LintTestSuite) TestLint() {
+	fsys := fstest.MapFS{
+		"schema.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/schema.json",
+			"properties": {
+				"a": {"$ref": "#/$defs/A", "description": "a"},
+				"b": {"$ref": "common/types.json#/$defs/B/properties/x", "minLength": 1, "type": "string"},
+				"c": {"$ref": "#/$defs/Gone"},
+				"$ref": {"enum": [{"$ref": "#/$defs/Gone"}]}
+			},
+			"$defs": {
+				"A": {"title": "A"},
+				"Unused": {"title": "Unused"},
+				"Anchored": {"title": "Anchored", "$anchor": "anchored"}
+			}
+		}`)},
+		"common/types.json": {Data: []byte(`{
+			"$id": "https://example.com/types",
+			"$defs": {"B": {"properties": {"x": {}}}}
+		}`)},
+		"empty.json": {Data: []byte(``)},
+	}
+
+	findings, err := Lint(fsys, Options{})
+	l.Require().NoError(err)
+	l.Equal([]Finding{
+		{Path: "common/types.json", Pointer: "/$defs/B", Severity: SeverityWarning, Rule: "def-title", Message: `$defs entry "B" has no title`},
+		{Path: "common/types.json", Pointer: "/$id", Severity: SeverityWarning, Rule: "id-path", Message: `$id "https://example.com/types" doesn't match the file path`},
+		{Path: "schema.json", Pointer: "/$defs/Unused", Severity: SeverityWarning, Rule: "unused-def", Message: `$defs entry "Unused" is never referenced`},
+		{Path: "schema.json", Pointer: "/properties/b", Severity: SeverityWarning, Rule: "ref-siblings", Message: `["minLength" "type"] next to $ref "common/types.json#/$defs/B/properties/x" are merged into its target`},
+		{Path: "schema.json", Pointer: "/properties/c/$ref", Severity: SeverityError, Rule: "unresolved-ref", Message: `unresolved $ref "#/$defs/Gone": missing key "Gone"`},
+	}, findings)
+	l.True(HasErrors(findings))
+	l.False(HasErrors(findings[:4]))
+}
+
+func (l *LintTestSuite) TestLintNestedIDScope() {
+	fsys := fstest.MapFS{"schema.json": {Data: []byte(`{
+		"$ref": "#/$defs/A",
+		"$defs": {
+			"A": {
+				"title": "A",
+				"$id": "https://example.com/a",
+				"properties": {"x": {"$ref": "#/$defs/B"}, "y": {"$ref": "#/$defs/C"}},
+				"$defs": {"B": {"title": "B"}}
+			},
+			"C": {"title": "C"}
+		}
+	}`)}}
+
+	findings, err := Lint(fsys, Options{})
+	l.Require().NoError(err)
+	l.Equal([]Finding{
+		{Path: "schema.json", Pointer: "/$defs/A/properties/y/$ref", Severity: SeverityError, Rule: "unresolved-ref", Message: `unresolved $ref "#/$defs/C": missing key "C"`},
+		{Path: "schema.json", Pointer: "/$defs/C", Severity: SeverityWarning, Rule: "unused-def", Message: `$defs entry "C" is never referenced`},
+	}, findings)
+}
+
+func (l *LintTestSuite) TestIDMatchesPath() {
+	type test struct {
+		ID       string
+		Path     string
+		Expected bool
+	}
+
+	tests := map[string]test{
+		"same path":         {ID: "https://example.com/a/b.json", Path: "a/b.json", Expected: true},
+		"without extension": {ID: "https://example.com/schemas/a/b", Path: "a/b.json", Expected: true},
+		"other file":        {ID: "https://example.com/a/c.json", Path: "a/b.json"},
+		"partial name":      {ID: "https://example.com/ab.json", Path: "b.json"},
+		"urn":               {ID: "urn:example:b", Path: "b.json"},
+	}
+
+	for desc, v := range tests {
+		l.Run(desc, func() {
+			l.Equal(v.Expected, idMatchesPath(v.ID, v.Path))
+		})
+	}
+}
+
+func TestLintTestSuite(t *testing.T) {
+	suite.Run(t, new(LintTestSuite))
+}
@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// walkSourceFiles calls fn with the path of each file in fsys that
+// InlineBundledSchemasInFS reads as a source schema, in lexical order,
+// skipping files left out by Include and Exclude, the SamplesDir, examples
+// files if ExtractExamples is set and the outputs of OutputFormats.
+func walkSourceFiles(fsys fs.FS, opts Options, fn func(path string) error) error {
+	if err := checkPathPatterns(opts); err != nil {
+		return err
+	}
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			if inSamplesDir(path, opts) || !opts.selectsPath(path, true) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !isSourceFile(d.Name(), opts.Dialect) {
+			return nil
+		}
+		if !opts.selectsPath(path, false) {
+			opts.logger().Debug("Skipped excluded file", "path", filepath.ToSlash(path))
+			return nil
+		}
+		if opts.ExtractExamples && isExamplesFile(d.Name()) {
+			opts.logger().Debug("Skipped examples file", "path", filepath.ToSlash(path))
+			return nil
+		}
+		if isFormatFile(d.Name(), opts) {
+			opts.logger().Debug("Skipped output format file", "path", filepath.ToSlash(path))
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// selectsPath reports whether Include and Exclude let through p, a path in
+// fsys of a file, or of a directory if dir is set. Include only applies to
+// files, since a directory may hold some that match.
+func (o Options) selectsPath(p string, dir bool) bool {
+	p = filepath.ToSlash(p)
+	if p == "." {
+		return true
+	}
+	for _, pattern := range o.Exclude {
+		if matchPath(pattern, p) {
+			return false
+		}
+	}
+	if dir || len(o.Include) == 0 {
+		return true
+	}
+	for _, pattern := range o.Include {
+		if matchPath(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether the slash-separated path p matches pattern, as
+// Include and Exclude do: over the whole path if pattern has a "/", or over
+// the last element of p otherwise.
+func matchPath(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		p = path.Base(p)
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// checkPathPatterns returns an error for the first malformed glob in Include
+// or Exclude.
+func checkPathPatterns(opts Options) error {
+	for _, pattern := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ListSchemaFiles returns the paths of the files in fsys that
+// InlineBundledSchemasInFS would process with the same options, sorted,
+// after Include and Exclude, without reading or inlining any of them. Since files aren't read, an empty
+// file that inlining would skip is still listed.
+func ListSchemaFiles(fsys fs.FS, options ...Option) ([]string, error) {
+	opts := buildOptions(options)
+	if err := checkFormats(opts.OutputFormats); err != nil {
+		return nil, err
+	}
+	var paths []string
+	err := walkSourceFiles(fsys, opts, func(path string) error {
+		paths = append(paths, filepath.ToSlash(path))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
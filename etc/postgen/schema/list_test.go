@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ListTestSuite struct {
+	suite.Suite
+}
+
+func (s *ListTestSuite) TestListSchemaFiles() {
+	type test struct {
+		Opts        Options
+		Expected    []string
+		ExpectedErr string
+	}
+
+	fsys := fstest.MapFS{
+		"user.json":                   {Data: []byte(`{"type": "object"}`)},
+		"user.min.json":               {Data: []byte(`{"type":"object"}`)},
+		"user.examples.json":          {Data: []byte(`[{}]`)},
+		"common/id.json":              {Data: []byte(`{"type": "string"}`)},
+		"common/name.json5":           {Data: []byte(`{type: 'string'}`)},
+		"common/empty.json":           {Data: []byte(``)},
+		"notes.txt":                   {Data: []byte(`not a schema`)},
+		"samples/user/ok.json":        {Data: []byte(`{}`)},
+		"samples/common/id/word.json": {Data: []byte(`"abc"`)},
+	}
+
+	tests := map[string]test{
+		"defaults": {
+			Expected: []string{
+				"common/empty.json", "common/id.json",
+				"samples/common/id/word.json", "samples/user/ok.json",
+				"user.examples.json", "user.json", "user.min.json",
+			},
+		},
+		"filters": {
+			Opts: Options{
+				Dialect:         DialectJSON5,
+				SamplesDir:      "samples",
+				ExtractExamples: true,
+				OutputFormats:   []Format{{Suffix: ".min", Minify: true}},
+			},
+			Expected: []string{"common/empty.json", "common/id.json", "common/name.json5", "user.json"},
+		},
+		"exclude": {
+			Opts:     Options{Exclude: []string{"samples", "*.min.json", "user.examples.json"}},
+			Expected: []string{"common/empty.json", "common/id.json", "user.json"},
+		},
+		"include": {
+			Opts:     Options{Include: []string{"common/*", "user.json"}, Exclude: []string{"empty.json"}},
+			Expected: []string{"common/id.json", "user.json"},
+		},
+		"bad pattern": {
+			Opts:        Options{Exclude: []string{"["}},
+			ExpectedErr: `invalid path pattern "[": syntax error in pattern`,
+		},
+		"format without suffix": {
+			Opts:        Options{OutputFormats: []Format{{Minify: true}}},
+			ExpectedErr: "output format 1 has no Suffix",
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			paths, err := ListSchemaFiles(fsys, v.Opts)
+			if v.ExpectedErr != "" {
+				s.EqualError(err, v.ExpectedErr)
+				return
+			}
+			s.Require().NoError(err)
+			s.Equal(v.Expected, paths)
+		})
+	}
+}
+
+func (s *ListTestSuite) TestInlineBundledSchemasInFSExclude() {
+	fsys := fstest.MapFS{
+		"user.json":               {Data: []byte(`{"$id": "https://example.com/user.json", "properties": {"a": {"$ref": "fixtures/shared.json"}}}`)},
+		"fixtures/shared.json":    {Data: []byte(`{"type": "string"}`)},
+		"fixtures/user-copy.json": {Data: []byte(`{"$id": "https://example.com/user.json"}`)},
+	}
+
+	// The copy would declare the $id twice, but refs by path still read
+	// excluded files.
+	updates, err := InlineBundledSchemasInFS(fsys, WithExclude("fixtures"))
+	s.Require().NoError(err)
+	s.Len(updates, 1)
+	s.JSONEq(`{"properties": {"a": {"type": "string"}}}`, string(updates["user.json"]))
+
+	_, err = InlineBundledSchemasInFS(fsys, Options{})
+	s.ErrorContains(err, "is declared by both")
+}
+
+func TestListTestSuite(t *testing.T) {
+	suite.Run(t, new(ListTestSuite))
+}
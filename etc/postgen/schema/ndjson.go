@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ndjsonExts are the extensions of newline-delimited files, which hold one
+// schema per line.
+var ndjsonExts = []string{".ndjson", ".jsonl"}
+
+// isNDJSON reports whether the file at p holds one schema per line, possibly
+// gzipped.
+func isNDJSON(p string) bool {
+	p = strings.TrimSuffix(strings.ToLower(p), gzipExt)
+	for _, ext := range ndjsonExts {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNDJSON decodes each line of b that isn't blank, written in dialect,
+// as a schema of its own. It returns them as an array, along with the line
+// number of each.
+func parseNDJSON(b []byte, dialect Dialect) ([]any, []int, error) {
+	var elems []any
+	var lines []int
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if isBlank(line) {
+			continue
+		}
+		v, err := parseSource(line, dialect)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		elems = append(elems, v)
+		lines = append(lines, i+1)
+	}
+	return elems, lines, nil
+}
+
+// marshalNDJSON writes each of the resolved schemas elems as compact JSON on
+// a line of its own.
+func marshalNDJSON(elems []any, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, v := range outputValue(elems, opts).([]any) {
+		b, err := opts.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Compact(&buf, b); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+	}
+	return withLineEnding(buf.Bytes(), opts.LineEnding)
+}
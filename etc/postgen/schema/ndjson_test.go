@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NDJSONTestSuite struct {
+	suite.Suite
+}
+
+func (n *NDJSONTestSuite) TestInlineBundledSchemasInFSNDJSON() {
+	type test struct {
+		Given       fstest.MapFS
+		Expected    map[string]string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"one schema per line": {
+			Given: fstest.MapFS{
+				"events.ndjson": {Data: []byte(
+					`{"title": "Created", "properties": {"id": {"$ref": "#/$defs/ID"}}, "$defs": {"ID": {"type": "string"}}}` + "\n" +
+						"\n" +
+						`{"title": "Deleted", "properties": {"id": {"$ref": "#/$defs/ID"}}, "$defs": {"ID": {"type": "integer"}}}` + "\r\n" +
+						"   \n" +
+						`{"title": "Moved", "properties": {"to": {"$ref": "common.json#/$defs/Place"}}}` + "\n"),
+				},
+				"common.json": {Data: []byte(`{"$defs": {"Place": {"type": "string"}}}`)},
+				"moved.json":  {Data: []byte(`{"$ref": "events.ndjson#/2/properties/to"}`)},
+			},
+			Expected: map[string]string{
+				"events.ndjson": `{"properties":{"id":{"type":"string"}},"title":"Created"}` + "\n" +
+					`{"properties":{"id":{"type":"integer"}},"title":"Deleted"}` + "\n" +
+					`{"properties":{"to":{"type":"string"}},"title":"Moved"}` + "\n",
+				"common.json": "{}\n",
+				"moved.json":  "{\n  \"type\": \"string\"\n}\n",
+			},
+		},
+		"jsonl": {
+			Given: fstest.MapFS{
+				"a.JSONL": {Data: []byte(`{"not": {"$ref": "#/$defs/A"}, "$defs": {"A": true}}`)},
+			},
+			Expected: map[string]string{
+				"a.JSONL": `{"not":true}` + "\n",
+			},
+		},
+		"invalid line": {
+			Given: fstest.MapFS{
+				"a.ndjson": {Data: []byte("{}\n\n{\"type\":\n")},
+			},
+			ExpectedErr: "parse a.ndjson: line 3: unexpected end of JSON input",
+		},
+		"array line": {
+			Given: fstest.MapFS{
+				"a.ndjson": {Data: []byte("{}\n\n[{}]\n")},
+			},
+			ExpectedErr: "inline refs in a.ndjson: line 3 is an array, not a schema",
+		},
+		"failing line": {
+			Given: fstest.MapFS{
+				"a.ndjson": {Data: []byte("\n{\"$ref\": \"#/$defs/Gone\"}\n")},
+			},
+			ExpectedErr: `inline refs in a.ndjson: line 2: unresolved $ref "#/$defs/Gone": missing key "$defs"`,
+		},
+	}
+
+	for desc, v := range tests {
+		n.Run(desc, func() {
+			updates, err := InlineBundledSchemasInFS(v.Given, Options{})
+			if v.ExpectedErr != "" {
+				n.EqualError(err, v.ExpectedErr)
+				return
+			}
+			n.Require().NoError(err)
+			n.Len(updates, len(v.Expected))
+			for p, expected := range v.Expected {
+				n.Equal(expected, string(updates[p]), p)
+			}
+		})
+	}
+}
+
+func (n *NDJSONTestSuite) TestIsNDJSON() {
+	n.True(isNDJSON("a/b.ndjson"))
+	n.True(isNDJSON("b.jsonl.gz"))
+	n.True(isNDJSON("B.NDJSON"))
+	n.False(isNDJSON("b.json"))
+	n.False(isNDJSON("ndjson"))
+}
+
+func TestNDJSONTestSuite(t *testing.T) {
+	suite.Run(t, new(NDJSONTestSuite))
+}
@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// decodeJSON decodes b, keeping numbers as json.Number so they're written
+// back the way the source wrote them, e.g. 0.0000001 rather than 1e-07.
+func decodeJSON(b []byte) (any, error) {
+	if !json.Valid(b) {
+		// Unmarshal's errors are the familiar ones.
+		var out any
+		return nil, json.Unmarshal(b, &out)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out any
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// formatNumbers returns node with every number written as fn formats it, if
+// fn is set. Numbers without source text, i.e. float64 values, are first
+// written without an exponent.
+func formatNumbers(node any, fn func(json.Number) json.Number) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = formatNumbers(child, fn)
+		}
+		return out
+	case orderedObject:
+		return orderedObject{keys: v.keys, m: formatNumbers(v.m, fn).(map[string]any)}
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = formatNumbers(child, fn)
+		}
+		return out
+	case float64:
+		return formatNumbers(json.Number(strconv.FormatFloat(v, 'f', -1, 64)), fn)
+	case json.Number:
+		if fn != nil {
+			return fn(v)
+		}
+		return v
+	default:
+		return node
+	}
+}
+
+// numbersAsFloats returns node with every json.Number replaced by its
+// float64 value, so numbers compare by value rather than by how they're
+// written.
+func numbersAsFloats(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = numbersAsFloats(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = numbersAsFloats(child)
+		}
+		return out
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v
+	default:
+		return node
+	}
+}
@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NumbersTestSuite struct {
+	suite.Suite
+}
+
+func (n *NumbersTestSuite) TestInlineSchemaBytesKeepsNumbers() {
+	type test struct {
+		Given    string
+		Opts     Options
+		Expected string
+	}
+
+	tests := map[string]test{
+		"small and large constraints": {
+			Given: `{
+				"properties": {"a": {"$ref": "#/$defs/Tiny"}, "b": {"maximum": 100000000000000000000000, "const": 1.50}},
+				"$defs": {"Tiny": {"multipleOf": 0.0000001, "minimum": -0.000000000001, "default": 1E-7}}
+			}`,
+			Expected: `{
+  "properties": {
+    "a": {
+      "default": 1E-7,
+      "minimum": -0.000000000001,
+      "multipleOf": 0.0000001
+    },
+    "b": {
+      "const": 1.50,
+      "maximum": 100000000000000000000000
+    }
+  }
+}
+`,
+		},
+		"json5": {
+			Given: `{multipleOf: 0.0000001, maximum: 0x10, minimum: +1e-7, exclusiveMinimum: .5}`,
+			Opts:  Options{Dialect: DialectJSON5},
+			Expected: `{
+  "exclusiveMinimum": 0.5,
+  "maximum": 16,
+  "minimum": 1e-7,
+  "multipleOf": 0.0000001
+}
+`,
+		},
+		"format number": {
+			Given: `{"multipleOf": 1e-7, "maximum": 10}`,
+			Opts: Options{FormatNumber: func(v json.Number) json.Number {
+				return json.Number(strings.ToUpper(v.String()))
+			}},
+			Expected: `{
+  "maximum": 10,
+  "multipleOf": 1E-7
+}
+`,
+		},
+	}
+
+	for desc, v := range tests {
+		n.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), v.Opts)
+			n.Require().NoError(err)
+			n.Equal(v.Expected, string(out))
+		})
+	}
+}
+
+func (n *NumbersTestSuite) TestResolveDocumentFloats() {
+	resolved, err := ResolveDocument(map[string]any{"multipleOf": 0.0000001, "maximum": 1e21})
+	n.Require().NoError(err)
+	out, err := marshalSchema(resolved, Options{})
+	n.Require().NoError(err)
+	n.Equal("{\n  \"maximum\": 1000000000000000000000,\n  \"multipleOf\": 0.0000001\n}\n", string(out))
+}
+
+func (n *NumbersTestSuite) TestFormatNumberInvalid() {
+	_, err := InlineSchemaBytes([]byte(`{"maximum": 10}`), Options{FormatNumber: func(json.Number) json.Number { return "ten" }})
+	n.ErrorContains(err, `"ten"`)
+}
+
+func (n *NumbersTestSuite) TestNumbersCompareByValue() {
+	out, err := InlineSchemaBytes([]byte(`{"$ref": "#/$defs/A", "enum": [1.0, 2], "$defs": {"A": {"enum": [1, 3]}}}`), Options{MergeArrays: true})
+	n.Require().NoError(err)
+	n.JSONEq(`{"enum": [1, 3, 2]}`, string(out))
+}
+
+func TestNumbersTestSuite(t *testing.T) {
+	suite.Run(t, new(NumbersTestSuite))
+}
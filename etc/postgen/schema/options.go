@@ -0,0 +1,298 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+)
+
+// defaultStripKeys are the keys Options.StripKeys defaults to.
+var defaultStripKeys = []string{"$id", "$schema"}
+
+// defaultInlineMarker is the key Options.InlineMarker defaults to.
+const defaultInlineMarker = "x-inline"
+
+// defaultIndent is the indent Options.Indent defaults to.
+const defaultIndent = "  "
+
+// Option configures InlineBundledSchemasInFS and friends. An Options value is
+// itself an Option that replaces every setting applied before it, so
+//
+//	InlineBundledSchemasInFS(fsys, Options{KeepAnchoredDefs: true}, WithIndent("\t"))
+//
+// starts from the struct and then changes the indent. No options at all is the
+// same as the zero Options.
+type Option interface {
+	apply(o *Options)
+}
+
+func (o Options) apply(dst *Options) {
+	*dst = o
+}
+
+type optionFunc func(o *Options)
+
+func (f optionFunc) apply(o *Options) {
+	f(o)
+}
+
+// buildOptions applies opts in order to the zero Options.
+func buildOptions(opts []Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return o
+}
+
+// RegisterScheme registers fetch to fetch the documents named by refs with
+// the URI scheme, such as "s3" or "registry", so schemas can refer to shared
+// schemas kept in any backend. fetch is given the absolute URI without its
+// fragment, and the fragment is resolved in the document it returns. Each URI
+// is fetched once per run, unless refs to it are followed concurrently. A ref
+// by a URI that a document in FS declares as its $id resolves to that document
+// instead, and file:// URIs always map onto FS. Relative refs in a fetched
+// document resolve against its URI.
+func (o *Options) RegisterScheme(scheme string, fetch func(uri string) ([]byte, error)) {
+	if o.Schemes == nil {
+		o.Schemes = map[string]func(uri string) ([]byte, error){}
+	}
+	o.Schemes[strings.ToLower(scheme)] = fetch
+}
+
+// WithFS sets Options.FS, which cross-file refs are resolved against.
+func WithFS(fsys fs.FS) Option {
+	return optionFunc(func(o *Options) { o.FS = fsys })
+}
+
+// WithFallbackFS sets Options.FallbackFS.
+func WithFallbackFS(fsys ...fs.FS) Option {
+	return optionFunc(func(o *Options) { o.FallbackFS = fsys })
+}
+
+// WithScheme registers fetch for refs with the URI scheme, like
+// Options.RegisterScheme.
+func WithScheme(scheme string, fetch func(uri string) ([]byte, error)) Option {
+	return optionFunc(func(o *Options) { o.RegisterScheme(scheme, fetch) })
+}
+
+// WithResolver registers fetch for refs with each of schemes, like
+// Options.RegisterScheme, so one resolver can serve several of them:
+//
+//	WithResolver(httpGet, "http", "https")
+func WithResolver(fetch func(uri string) ([]byte, error), schemes ...string) Option {
+	return optionFunc(func(o *Options) {
+		for _, scheme := range schemes {
+			o.RegisterScheme(scheme, fetch)
+		}
+	})
+}
+
+// WithBasePath sets Options.BasePath.
+func WithBasePath(dir string) Option {
+	return optionFunc(func(o *Options) { o.BasePath = dir })
+}
+
+// WithReport sets Options.Report.
+func WithReport(r *Report) Option {
+	return optionFunc(func(o *Options) { o.Report = r })
+}
+
+// WithConcurrency sets Options.Concurrency.
+func WithConcurrency(n int) Option {
+	return optionFunc(func(o *Options) { o.Concurrency = n })
+}
+
+// WithProgress sets Options.Progress.
+func WithProgress(fn func(done, total int)) Option {
+	return optionFunc(func(o *Options) { o.Progress = fn })
+}
+
+// WithStripKeys sets Options.StripKeys. With no keys, nothing but $defs is
+// stripped.
+func WithStripKeys(keys ...string) Option {
+	return optionFunc(func(o *Options) { o.StripKeys = append([]string{}, keys...) })
+}
+
+// WithIndent sets Options.Indent.
+func WithIndent(indent string) Option {
+	return optionFunc(func(o *Options) { o.Indent = indent })
+}
+
+// WithLineEnding sets Options.LineEnding.
+func WithLineEnding(le LineEnding) Option {
+	return optionFunc(func(o *Options) { o.LineEnding = le })
+}
+
+// WithKeywordOrder sets Options.KeywordOrder.
+func WithKeywordOrder(order []string) Option {
+	return optionFunc(func(o *Options) { o.KeywordOrder = order })
+}
+
+// WithTargetDraft sets Options.TargetDraft.
+func WithTargetDraft(d Draft) Option {
+	return optionFunc(func(o *Options) { o.TargetDraft = d })
+}
+
+// WithLogger sets Options.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return optionFunc(func(o *Options) { o.Logger = l })
+}
+
+// WithDialect sets Options.Dialect.
+func WithDialect(d Dialect) Option {
+	return optionFunc(func(o *Options) { o.Dialect = d })
+}
+
+// WithOnMissingRef sets Options.OnMissingRef.
+func WithOnMissingRef(p MissingRefPolicy) Option {
+	return optionFunc(func(o *Options) { o.OnMissingRef = p })
+}
+
+// WithInlineOnly sets Options.InlineOnly.
+func WithInlineOnly(patterns ...string) Option {
+	return optionFunc(func(o *Options) { o.InlineOnly = patterns })
+}
+
+// WithInclude sets Options.Include.
+func WithInclude(patterns ...string) Option {
+	return optionFunc(func(o *Options) { o.Include = patterns })
+}
+
+// WithExclude sets Options.Exclude.
+func WithExclude(patterns ...string) Option {
+	return optionFunc(func(o *Options) { o.Exclude = patterns })
+}
+
+// WithDefNameFunc sets Options.DefNameFunc.
+func WithDefNameFunc(fn func(sourcePath, origName string) string) Option {
+	return optionFunc(func(o *Options) { o.DefNameFunc = fn })
+}
+
+// WithRewriteRef sets Options.RewriteRef.
+func WithRewriteRef(fn func(ref string) (string, error)) Option {
+	return optionFunc(func(o *Options) { o.RewriteRef = fn })
+}
+
+// WithMaxInputBytes sets Options.MaxInputBytes.
+func WithMaxInputBytes(n int) Option {
+	return optionFunc(func(o *Options) { o.MaxInputBytes = n })
+}
+
+// WithMaxDepth sets Options.MaxDepth.
+func WithMaxDepth(n int) Option {
+	return optionFunc(func(o *Options) { o.MaxDepth = n })
+}
+
+// stripSet returns the keys stripped from the output, $defs included.
+func (o Options) stripSet() map[string]bool {
+	keys := o.StripKeys
+	if keys == nil {
+		keys = defaultStripKeys
+	}
+	set := map[string]bool{"$defs": true}
+	for _, k := range keys {
+		set[k] = true
+	}
+	if o.RespectInlineMarker {
+		set[o.inlineMarker()] = true
+	}
+	return set
+}
+
+func (o Options) inlineMarker() string {
+	if o.InlineMarker == "" {
+		return defaultInlineMarker
+	}
+	return o.InlineMarker
+}
+
+// LevelTrace is the level of the records Options.Logger gets for each step of
+// inlining a $ref: the ref, the target it resolved to, the siblings merged
+// into it and the resulting schema. It's below slog.LevelDebug, so a handler
+// has to ask for it.
+const LevelTrace = slog.LevelDebug - 4
+
+// discardLogger is the logger used when Options.Logger is nil.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger == nil {
+		return discardLogger
+	}
+	return o.Logger
+}
+
+// warn records a diagnostic about the file at path on the Report and logs it
+// as a warning.
+func (o Options) warn(path, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	o.Report.addDiagnostic(path, "%s", msg)
+	o.logger().Warn(msg, "path", path)
+}
+
+// rewriteRef returns ref as RewriteRef rewrites it, if it's set, after
+// making a leading-"/" ref a fragment with LenientRefs.
+func (o Options) rewriteRef(ref string) (string, error) {
+	if o.LenientRefs && strings.HasPrefix(ref, "/") {
+		ref = "#" + ref
+	}
+	if o.RewriteRef == nil {
+		return ref, nil
+	}
+	rewritten, err := o.RewriteRef(ref)
+	if err != nil {
+		return "", fmt.Errorf("rewrite $ref %q: %w", ref, err)
+	}
+	return rewritten, nil
+}
+
+func (o Options) defName(sourcePath, origName string) string {
+	if o.DefNameFunc == nil {
+		return defaultDefName(sourcePath, origName)
+	}
+	return o.DefNameFunc(sourcePath, origName)
+}
+
+// annotationKeywords returns the keywords StripAnnotations removes.
+func (o Options) annotationKeywords() []string {
+	if o.AnnotationKeywords == nil {
+		return DefaultAnnotationKeywords
+	}
+	return o.AnnotationKeywords
+}
+
+// marshal encodes v with Marshaler, or by default indented by Indent without
+// escaping HTML.
+func (o Options) marshal(v any) ([]byte, error) {
+	if o.Marshaler != nil {
+		return o.Marshaler(v)
+	}
+	return marshalIndentJSON(v, o.indent())
+}
+
+func (o Options) refKeyword() string {
+	if o.RefKeyword == "" {
+		return "$ref"
+	}
+	return o.RefKeyword
+}
+
+func (o Options) indent() string {
+	if o.Indent == "" {
+		return defaultIndent
+	}
+	return o.Indent
+}
+
+func (o Options) concurrency() int {
+	return max(o.Concurrency, 1)
+}
+
+func (o Options) maxDepth() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return DefaultMaxDepth
+}
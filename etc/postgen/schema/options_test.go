@@ -0,0 +1,254 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OptionsTestSuite struct {
+	suite.Suite
+}
+
+func (o *OptionsTestSuite) TestInlineSchemaBytesOptions() {
+	type test struct {
+		Given       string
+		Opts        []Option
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"no options": {
+			Given: `{"$id": "a", "items": {"$schema": "b", "$comment": "c"}}`,
+			Expected: `{
+  "items": {
+    "$comment": "c"
+  }
+}
+`,
+		},
+		"strip keys": {
+			Given: `{"$id": "a", "items": {"$schema": "b", "$comment": "c"}}`,
+			Opts:  []Option{WithStripKeys("$comment")},
+			Expected: `{
+  "$id": "a",
+  "items": {
+    "$schema": "b"
+  }
+}
+`,
+		},
+		"strip no keys": {
+			Given: `{"$id": "a", "items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"$schema": "b"}}}`,
+			Opts:  []Option{WithStripKeys()},
+			Expected: `{
+  "$id": "a",
+  "items": {
+    "$schema": "b"
+  }
+}
+`,
+		},
+		"ref to a strip key": {
+			Given:       `{"items": {"$ref": "#/$comment"}, "$comment": "c"}`,
+			Opts:        []Option{WithStripKeys("$comment")},
+			ExpectedErr: `inline refs: $ref "#/$comment" targets "$comment", which is stripped from the output`,
+		},
+		"resolver": {
+			Given: `{"properties": {"a": {"$ref": "http://example.com/a.json"}, "b": {"$ref": "https://example.com/b.json"}}}`,
+			Opts: []Option{WithResolver(func(uri string) ([]byte, error) {
+				return []byte(fmt.Sprintf(`{"const": %q}`, uri)), nil
+			}, "http", "https")},
+			Expected: `{
+  "properties": {
+    "a": {
+      "const": "http://example.com/a.json"
+    },
+    "b": {
+      "const": "https://example.com/b.json"
+    }
+  }
+}
+`,
+		},
+		"indent": {
+			Given:    `{"items": {"type": "string"}}`,
+			Opts:     []Option{WithIndent("\t")},
+			Expected: "{\n\t\"items\": {\n\t\t\"type\": \"string\"\n\t}\n}\n",
+		},
+		"options then with": {
+			Given:    `{"items": {"type": "string"}}`,
+			Opts:     []Option{Options{LineEnding: LineEndingCRLF}, WithIndent(" ")},
+			Expected: "{\r\n \"items\": {\r\n  \"type\": \"string\"\r\n }\r\n}\r\n",
+		},
+		"options replace earlier with": {
+			Given:    `{"items": {"type": "string"}}`,
+			Opts:     []Option{WithIndent(" "), Options{LineEnding: LineEndingCRLF}},
+			Expected: "{\r\n  \"items\": {\r\n    \"type\": \"string\"\r\n  }\r\n}\r\n",
+		},
+	}
+
+	for desc, v := range tests {
+		o.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), v.Opts...)
+			if v.ExpectedErr != "" {
+				o.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if !o.NoError(err) {
+				return
+			}
+			o.Equal(v.Expected, string(out))
+		})
+	}
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSConcurrency() {
+	fsys := fstest.MapFS{
+		"common.json": {Data: []byte(`{"$id": "https://example.com/common", "$defs": {"Id": {"type": "string"}}}`)},
+	}
+	for i := range 20 {
+		fsys[fmt.Sprintf("s%02d.json", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"properties": {
+				"id": {"$ref": "common.json#/$defs/Id"},
+				"byId": {"$ref": "https://example.com/common#/$defs/Id"},
+				"n": {"const": %d}
+			}
+		}`, i))}
+	}
+
+	sequential, err := InlineBundledSchemasInFS(fsys)
+	o.Require().NoError(err)
+
+	report := new(Report)
+	concurrent, err := InlineBundledSchemasInFS(fsys, WithConcurrency(4), WithReport(report))
+	o.Require().NoError(err)
+	o.Equal(sequential, concurrent)
+	o.Len(report.Inlined(), 1)
+	o.Equal(40, report.Inlined()[0].Count)
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSConcurrencyFirstError() {
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(`{}`)},
+		"b.json": {Data: []byte(`{"$ref": "#/$defs/B"}`)},
+		"c.json": {Data: []byte(`{"$ref": "#/$defs/C"}`)},
+	}
+
+	for range 10 {
+		_, err := InlineBundledSchemasInFS(fsys, WithConcurrency(3))
+		o.EqualError(err, `inline refs in b.json: unresolved $ref "#/$defs/B": missing key "$defs"`)
+	}
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSProgress() {
+	fsys := fstest.MapFS{}
+	for i := range 5 {
+		fsys[fmt.Sprintf("s%d.json", i)] = &fstest.MapFile{Data: []byte(`{"type": "string"}`)}
+	}
+
+	var calls [][2]int
+	_, err := InlineBundledSchemasInFS(fsys, WithConcurrency(3), WithProgress(func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	}))
+	o.Require().NoError(err)
+	o.Equal([][2]int{{1, 5}, {2, 5}, {3, 5}, {4, 5}, {5, 5}}, calls)
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSMaxInputBytes() {
+	big := gzipped(o.T(), `{"type": "string", "description": "big"}`)
+	fsys := fstest.MapFS{
+		"a.json":        {Data: []byte(`{"type": "string"}`)},
+		"big/b.json.gz": {Data: big},
+	}
+
+	_, err := InlineBundledSchemasInFS(fsys, WithMaxInputBytes(18))
+	o.EqualError(err, fmt.Sprintf("big/b.json.gz is %d bytes gzipped, and more than the maximum of 18 for a source schema decompressed", len(big)))
+
+	_, err = InlineBundledSchemasInFS(fstest.MapFS{"a.json": fsys["a.json"]}, WithMaxInputBytes(17))
+	o.EqualError(err, "a.json is 18 bytes, more than the maximum of 17 for a source schema")
+
+	updates, err := InlineBundledSchemasInFS(fsys, WithMaxInputBytes(40))
+	o.Require().NoError(err)
+	o.Len(updates, 2)
+}
+
+func (o *OptionsTestSuite) TestReadSchemaFileLimit() {
+	huge := `{"description": "` + strings.Repeat("a", 1<<20) + `"}`
+	fsys := fstest.MapFS{
+		"a.json":    {Data: []byte(huge)},
+		"a.json.gz": {Data: gzipped(o.T(), huge)},
+	}
+
+	for _, p := range []string{"a.json", "a.json.gz"} {
+		b, err := readSchemaFileLimit(fsys, p, 100)
+		o.Require().NoError(err, p)
+		o.Len(b, 101, p)
+
+		b, err = readSchemaFileLimit(fsys, p, 0)
+		o.Require().NoError(err, p)
+		o.Equal(huge, string(b), p)
+	}
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSLogger() {
+	fsys := fstest.MapFS{
+		"a.json":     {Data: []byte(`{"items": {"$ref": "#/$defs/A"}, "$defs": {"A": {"not": {"$ref": "#/$defs/Gone"}}}}`)},
+		"empty.json": {Data: []byte(``)},
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	_, err := InlineBundledSchemasInFS(fsys, WithLogger(logger), WithOnMissingRef(MissingRefWarn))
+	o.Require().NoError(err)
+	o.Equal(`level=WARN msg="skipped empty file" path=empty.json
+level=DEBUG msg="Inlining $ref" path=a.json ref=#/$defs/A target=a.json#/$defs/A
+level=WARN msg="left unresolved $ref \"#/$defs/Gone\": unresolved $ref \"#/$defs/Gone\": missing key \"Gone\"" path=a.json
+level=DEBUG msg="Inlined file" path=a.json bytes=69
+`, buf.String())
+}
+
+func (o *OptionsTestSuite) TestInlineBundledSchemasInFSTrace() {
+	fsys := fstest.MapFS{
+		"a.json":      {Data: []byte(`{"items": {"$ref": "common.json#/$defs/A", "description": "a"}}`)},
+		"common.json": {Data: []byte(`{"$defs": {"A": {"$ref": "#/$defs/B", "minimum": 1}, "B": {"type": "integer"}}}`)},
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: LevelTrace,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	_, err := InlineBundledSchemasInFS(fstest.MapFS{"a.json": fsys["a.json"]}, WithFS(fsys), WithLogger(logger))
+	o.Require().NoError(err)
+	o.Equal(`level=DEBUG msg="Inlining $ref" path=a.json ref=common.json#/$defs/A target=common.json#/$defs/A
+level=DEBUG msg="Inlining $ref" path=a.json ref=#/$defs/B target=common.json#/$defs/B
+level=DEBUG-4 msg="Resolved $ref" path=a.json doc=common.json ref=#/$defs/B target=common.json#/$defs/B siblings=[minimum] result="{\"minimum\":1,\"type\":\"integer\"}"
+level=DEBUG-4 msg="Resolved $ref" path=a.json doc=a.json ref=common.json#/$defs/A target=common.json#/$defs/A siblings=[description] result="{\"description\":\"a\",\"minimum\":1,\"type\":\"integer\"}"
+level=DEBUG msg="Inlined file" path=a.json bytes=85
+`, buf.String())
+}
+
+func TestOptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(OptionsTestSuite))
+}
@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"bytes"
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// DefaultKeywordOrder is a conventional order for Options.KeywordOrder:
+// identifiers first, then annotations, then constraints grouped by the type
+// they apply to, then combinators and finally $defs.
+var DefaultKeywordOrder = []string{
+	"$schema", "$id", "$anchor", "$dynamicAnchor", "$ref", "$dynamicRef", "$comment",
+	"title", "description", "deprecated", "readOnly", "writeOnly",
+	"type", "enum", "const", "default", "examples",
+	"format", "pattern", "minLength", "maxLength", "contentEncoding", "contentMediaType", "contentSchema",
+	"minimum", "exclusiveMinimum", "maximum", "exclusiveMaximum", "multipleOf",
+	"properties", "patternProperties", "additionalProperties", "propertyNames", "unevaluatedProperties",
+	"required", "dependentRequired", "dependentSchemas", "minProperties", "maxProperties",
+	"prefixItems", "items", "contains", "minContains", "maxContains", "unevaluatedItems",
+	"minItems", "maxItems", "uniqueItems",
+	"allOf", "anyOf", "oneOf", "not", "if", "then", "else",
+	"$defs",
+}
+
+// orderKeywords wraps every schema object in node so it marshals with its
+// keywords in the order given by rank, followed by unranked keys
+// alphabetically, followed by unranked "x-" extension keys alphabetically.
+// Objects that aren't schemas, such as the name -> schema map of "properties"
+// or the value of "default", keep encoding/json's alphabetical order.
+func orderKeywords(node any, rank map[string]int) any {
+	switch v := node.(type) {
+	case map[string]any:
+		m := mapSubschemas(v, func(sub any) any {
+			return orderKeywords(sub, rank)
+		})
+		return orderedObject{keys: rankedKeys(m, rank), m: m}
+	case []any:
+		// Only reached for the root.
+		out := make([]any, len(v))
+		for i := range v {
+			out[i] = orderKeywords(v[i], rank)
+		}
+		return out
+	default:
+		return node
+	}
+}
+
+// keywordRank maps each keyword of order to its position.
+func keywordRank(order []string) map[string]int {
+	rank := make(map[string]int, len(order))
+	for i, k := range order {
+		if _, ok := rank[k]; !ok {
+			rank[k] = i
+		}
+	}
+	return rank
+}
+
+func rankedKeys(m map[string]any, rank map[string]int) []string {
+	group := func(k string) int {
+		switch _, ok := rank[k]; {
+		case ok:
+			return 0
+		case strings.HasPrefix(k, "x-"):
+			return 2
+		default:
+			return 1
+		}
+	}
+	keys := slices.Collect(maps.Keys(m))
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(group(a), group(b)), cmp.Compare(rank[a], rank[b]), strings.Compare(a, b))
+	})
+	return keys
+}
+
+// orderedObject is a JSON object that marshals its keys in a fixed order.
+type orderedObject struct {
+	keys []string
+	m    map[string]any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := marshalJSON(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := marshalJSON(o.m[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
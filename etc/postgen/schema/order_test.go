@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OrderTestSuite struct {
+	suite.Suite
+}
+
+func (o *OrderTestSuite) TestInlineSchemaBytesKeywordOrder() {
+	type test struct {
+		Given    string
+		Order    []string
+		Expected string
+	}
+
+	tests := map[string]test{
+		"default order": {
+			Given: `{
+				"x-go-type": "User",
+				"required": ["type"],
+				"properties": {
+					"type": {"$ref": "#/$defs/Kind"},
+					"name": {"maxLength": 9, "type": "string", "default": {"b": 1, "a": 2}}
+				},
+				"zeta": true,
+				"type": "object",
+				"description": "d",
+				"title": "User",
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"$defs": {"Kind": {"enum": ["a"], "type": "string"}},
+				"alpha": true,
+				"x-a": 1
+			}`,
+			Order: DefaultKeywordOrder,
+			Expected: `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "User",
+  "description": "d",
+  "type": "object",
+  "properties": {
+    "name": {
+      "type": "string",
+      "default": {
+        "a": 2,
+        "b": 1
+      },
+      "maxLength": 9
+    },
+    "type": {
+      "type": "string",
+      "enum": [
+        "a"
+      ]
+    }
+  },
+  "required": [
+    "type"
+  ],
+  "alpha": true,
+  "zeta": true,
+  "x-a": 1,
+  "x-go-type": "User"
+}
+`,
+		},
+		"custom order": {
+			Given: `{"items": [{"type": "string", "title": "t"}], "x-b": 1, "title": "a", "allOf": [{"b": 1, "a": 2}]}`,
+			Order: []string{"x-b", "allOf", "type"},
+			Expected: `{
+  "x-b": 1,
+  "allOf": [
+    {
+      "a": 2,
+      "b": 1
+    }
+  ],
+  "items": [
+    {
+      "type": "string",
+      "title": "t"
+    }
+  ],
+  "title": "a"
+}
+`,
+		},
+		"no order": {
+			Given: `{"type": "string", "title": "a"}`,
+			Expected: `{
+  "title": "a",
+  "type": "string"
+}
+`,
+		},
+	}
+
+	for desc, v := range tests {
+		o.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), Options{KeywordOrder: v.Order})
+			if !o.NoError(err) {
+				return
+			}
+			o.Equal(v.Expected, string(out))
+		})
+	}
+}
+
+func TestOrderTestSuite(t *testing.T) {
+	suite.Run(t, new(OrderTestSuite))
+}
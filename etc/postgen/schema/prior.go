@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PriorBundle is the output of an earlier BundleSchema run, along with the
+// index it wrote to Options.IndexPath. A ref to a file that was bundled, such
+// as "lib/common.json#/$defs/Address" or one into a part of the entry,
+// resolves to the bundled entry, so a large build can bundle a shared
+// library once and have the schemas using it refer to the result. Only refs
+// by path, relative or as a file:// URI, are matched, not refs by $id or by
+// anchor.
+type PriorBundle struct {
+	// Path is where the bundle would be in Options.FS. It identifies the
+	// bundle in errors, and refs left pointing into it are relative to it.
+	// Refs to Path itself also resolve to the bundle.
+	Path string
+	// Dir is the directory in Options.FS that the bundled files were read
+	// from, which the Source of each entry of Index is relative to.
+	Dir string
+	// Root is the parsed bundle.
+	Root any
+	// Index lists the bundled $defs entries.
+	Index []IndexEntry
+}
+
+// priorDef is an entry of a PriorBundle.
+type priorDef struct {
+	// doc is the bundle.
+	doc *document
+	// name is the name of the entry in the $defs of the bundle.
+	name string
+	// pointer is the JSON Pointer of the entry in the file it came from.
+	pointer string
+}
+
+// resolvePrior resolves the ref made of addr and frag, which appears in doc,
+// against Options.PriorBundles. It reports false if no bundle has the target.
+func (in *inliner) resolvePrior(addr, frag string, doc *document) (refTarget, bool, error) {
+	if addr == "" || len(in.opts.PriorBundles) == 0 {
+		return refTarget{}, false, nil
+	}
+	// Cache the bundles before any ref to one is looked up as a file.
+	priors, err := in.priorDefs()
+	if err != nil {
+		return refTarget{}, false, err
+	}
+	if frag != "" && !strings.HasPrefix(frag, "/") {
+		return refTarget{}, false, nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.IsAbs() && u.Scheme != "file" || !u.IsAbs() && doc.id != "" {
+		return refTarget{}, false, nil
+	}
+	var p string
+	switch {
+	case u.IsAbs():
+		if p, err = filePath(u); err != nil {
+			return refTarget{}, false, nil
+		}
+	case strings.HasPrefix(addr, "/"):
+		p = path.Clean(strings.TrimPrefix(addr, "/"))
+	default:
+		p = path.Join(doc.dir, addr)
+	}
+
+	// The entry nearest the target wins, such as "/$defs/A" over the whole
+	// file for "/$defs/A/properties/b".
+	var best *priorDef
+	for i, d := range priors[p] {
+		if (frag == d.pointer || strings.HasPrefix(frag, d.pointer+"/")) && (best == nil || len(d.pointer) > len(best.pointer)) {
+			best = &priors[p][i]
+		}
+	}
+	if best == nil {
+		return refTarget{}, false, nil
+	}
+	frag = "/$defs/" + escapeToken(best.name) + strings.TrimPrefix(frag, best.pointer)
+	target, err := getByPointer(best.doc.root, "#"+frag, in.cache)
+	if err != nil {
+		return refTarget{}, false, fmt.Errorf("%s: %w", best.doc.path, err)
+	}
+	return refTarget{value: target, doc: best.doc, frag: frag}, true, nil
+}
+
+// priorDefs returns the entries of Options.PriorBundles by the path of the
+// file each came from, adding the bundles to the cache the first time.
+func (in *inliner) priorDefs() (map[string][]priorDef, error) {
+	c := in.cache
+	c.mu.Lock()
+	priors := c.priors
+	c.mu.Unlock()
+	if priors != nil {
+		return priors, nil
+	}
+
+	priors = map[string][]priorDef{}
+	for i, b := range in.opts.PriorBundles {
+		if b.Path == "" {
+			return nil, fmt.Errorf("prior bundle %d has no Path", i+1)
+		}
+		root, err := in.prepareRoot(b.Root)
+		if err != nil {
+			return nil, fmt.Errorf("prior bundle %s: %w", b.Path, err)
+		}
+		m, _ := root.(map[string]any)
+		defs, _ := m["$defs"].(map[string]any)
+		doc := in.cache.add(newDocument(b.Path, root))
+		for _, e := range b.Index {
+			if _, ok := defs[e.Name]; !ok {
+				return nil, fmt.Errorf("prior bundle %s: index entry %q isn't in its $defs", b.Path, e.Name)
+			}
+			p := path.Join(b.Dir, e.Source)
+			priors[p] = append(priors[p], priorDef{doc: doc, name: e.Name, pointer: e.Pointer})
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.priors == nil {
+		c.priors = priors
+	}
+	return c.priors, nil
+}
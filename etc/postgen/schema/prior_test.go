@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PriorTestSuite struct {
+	suite.Suite
+}
+
+func (p *PriorTestSuite) TestInlineBundledSchemasInFSPriorBundles() {
+	type test struct {
+		Given       string
+		Prior       PriorBundle
+		Expected    string
+		ExpectedErr string
+	}
+
+	// Bundle the library the way a build would, keeping the index.
+	lib := writableFS{fstest.MapFS{
+		"lib.json": {Data: []byte(`{"properties": {"address": {"$ref": "common.json#/$defs/Address"}, "money": {"$ref": "money.json"}}}`)},
+		"common.json": {Data: []byte(`{
+			"$defs": {
+				"Address": {"properties": {"country": {"$ref": "#/$defs/Country"}}},
+				"Country": {"type": "string", "minLength": 2}
+			}
+		}`)},
+		"money.json": {Data: []byte(`{"properties": {"amount": {"type": "number"}}}`)},
+	}}
+	out, err := BundleSchema(lib, "lib.json", Options{IndexPath: "index.json"})
+	p.Require().NoError(err)
+	var prior PriorBundle
+	p.Require().NoError(json.Unmarshal(out, &prior.Root))
+	p.Require().NoError(json.Unmarshal(lib.MapFS["index.json"].Data, &prior.Index))
+	prior.Path, prior.Dir = "vendor/lib/bundle.json", "vendor/lib"
+
+	tests := map[string]test{
+		"entry": {
+			Given:    `{"properties": {"shipTo": {"$ref": "vendor/lib/common.json#/$defs/Address"}}}`,
+			Prior:    prior,
+			Expected: `{"properties": {"shipTo": {"properties": {"country": {"type": "string", "minLength": 2}}}}}`,
+		},
+		"into an entry": {
+			Given:    `{"properties": {"country": {"$ref": "/vendor/lib/common.json#/$defs/Address/properties/country"}}}`,
+			Prior:    prior,
+			Expected: `{"properties": {"country": {"type": "string", "minLength": 2}}}`,
+		},
+		"whole file": {
+			Given:    `{"properties": {"total": {"$ref": "file:///vendor/lib/money.json#/properties/amount"}, "money": {"$ref": "vendor/lib/money.json"}}}`,
+			Prior:    prior,
+			Expected: `{"properties": {"total": {"type": "number"}, "money": {"properties": {"amount": {"type": "number"}}}}}`,
+		},
+		"bundle itself": {
+			Given:    `{"properties": {"country": {"$ref": "vendor/lib/bundle.json#/$defs/common_Country"}}}`,
+			Prior:    prior,
+			Expected: `{"properties": {"country": {"type": "string", "minLength": 2}}}`,
+		},
+		"not bundled": {
+			Given:       `{"properties": {"other": {"$ref": "vendor/lib/other.json"}}}`,
+			Prior:       prior,
+			ExpectedErr: "inline refs in schema.json: read vendor/lib/other.json: open vendor/lib/other.json: file does not exist",
+		},
+		"no path": {
+			Given:       `{"properties": {"shipTo": {"$ref": "vendor/lib/common.json#/$defs/Address"}}}`,
+			Prior:       PriorBundle{Dir: "vendor/lib", Root: prior.Root, Index: prior.Index},
+			ExpectedErr: "inline refs in schema.json: prior bundle 1 has no Path",
+		},
+		"index out of date": {
+			Given:       `{"properties": {"shipTo": {"$ref": "vendor/lib/common.json#/$defs/Address"}}}`,
+			Prior:       PriorBundle{Path: "vendor/lib/bundle.json", Root: map[string]any{}, Index: prior.Index},
+			ExpectedErr: `inline refs in schema.json: prior bundle vendor/lib/bundle.json: index entry "common_Address" isn't in its $defs`,
+		},
+	}
+
+	for desc, v := range tests {
+		p.Run(desc, func() {
+			fsys := fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}
+			updates, err := InlineBundledSchemasInFS(fsys, Options{PriorBundles: []PriorBundle{v.Prior}})
+			if v.ExpectedErr != "" {
+				p.EqualError(err, v.ExpectedErr)
+				return
+			}
+			p.Require().NoError(err)
+			p.JSONEq(v.Expected, string(updates["schema.json"]))
+		})
+	}
+}
+
+func TestPriorTestSuite(t *testing.T) {
+	suite.Run(t, new(PriorTestSuite))
+}
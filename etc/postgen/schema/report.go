@@ -0,0 +1,212 @@
+package schema
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Report collects information about a run that callers may want to surface,
+// such as files that were skipped. It's safe to share between files inlined
+// concurrently, but must not be read until the run is over.
+type Report struct {
+	// Diagnostics are non-fatal issues, in the order they were encountered.
+	Diagnostics []Diagnostic
+
+	mu sync.Mutex
+
+	// inlined tracks DefUsage keyed by the target of each inlined ref.
+	inlined map[string]*DefUsage
+	// cycles holds the cycles found with PreserveRecursiveRefs, keyed by
+	// their refs joined.
+	cycles map[string][]string
+	// resolved holds the refs resolved, as one of each.
+	resolved map[ResolvedRef]bool
+	// files, inputBytes and outputBytes sum up the files written.
+	files, inputBytes, outputBytes int
+}
+
+// Stats summarizes a run.
+type Stats struct {
+	// Files is how many files were inlined.
+	Files int `json:"files"`
+	// RefsInlined is how many refs were replaced by their targets, including
+	// refs within targets.
+	RefsInlined int `json:"refsInlined"`
+	// InputBytes and OutputBytes are the total sizes of the files before and
+	// after inlining.
+	InputBytes  int `json:"inputBytes"`
+	OutputBytes int `json:"outputBytes"`
+	// TopDefs are the ref targets with the largest total expansion, as
+	// returned by Inlined.
+	TopDefs []DefUsage `json:"topDefs"`
+}
+
+// Stats summarizes the run, listing up to top ref targets in TopDefs.
+func (r *Report) Stats(top int) Stats {
+	inlined := r.Inlined()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := Stats{Files: r.files, InputBytes: r.inputBytes, OutputBytes: r.outputBytes}
+	for _, u := range inlined {
+		st.RefsInlined += u.Count
+	}
+	st.TopDefs = inlined[:min(top, len(inlined))]
+	return st
+}
+
+// DefUsage describes how much a single ref target was inlined.
+type DefUsage struct {
+	// Ref identifies the target as "<file>#<pointer>".
+	Ref string `json:"ref"`
+	// Count is how many times the target was inlined.
+	Count int `json:"count"`
+	// Bytes is the total size of the compact JSON inlined for the target,
+	// across all Count copies, if Options.MeasureInlined is set. Targets
+	// nested in other targets count towards both.
+	Bytes int `json:"bytes"`
+}
+
+// Inlined returns how often each ref target was inlined, largest total
+// expansion first, then most often inlined. Useful for spotting defs worth
+// keeping as $defs instead.
+func (r *Report) Inlined() []DefUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]DefUsage, 0, len(r.inlined))
+	for _, u := range r.inlined {
+		out = append(out, *u)
+	}
+	slices.SortFunc(out, func(a, b DefUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Count, a.Count), cmp.Compare(a.Ref, b.Ref))
+	})
+	return out
+}
+
+// Cycles returns the cycles of refs that PreserveRecursiveRefs left in place,
+// each listing the targets of its refs as "<file>#<pointer>", where the last
+// points back to the first. Each cycle is listed once, starting from its
+// smallest target, and cycles are sorted.
+func (r *Report) Cycles() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := slices.Collect(maps.Values(r.cycles))
+	slices.SortFunc(out, slices.Compare)
+	return out
+}
+
+// ResolvedRef records what a single $ref resolved to, so it can be traced
+// where each part of an output came from.
+type ResolvedRef struct {
+	// Path is the file being inlined when the ref was resolved.
+	Path string `json:"path"`
+	// Source is where the ref is, as "<file>#<pointer>". It's in another
+	// file than Path for refs within the targets of other refs.
+	Source string `json:"source"`
+	// Ref is the ref as written, after RewriteRef and LenientRefs.
+	Ref string `json:"ref"`
+	// Target is what the ref resolved to, as "<file>#<pointer>".
+	Target string `json:"target"`
+}
+
+// Resolved returns every ref resolved during the run, whether it was then
+// inlined or left in place, sorted by Path then Source. A ref within a target
+// that's inlined more than once is listed once.
+func (r *Report) Resolved() []ResolvedRef {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := slices.Collect(maps.Keys(r.resolved))
+	slices.SortFunc(out, func(a, b ResolvedRef) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Source, b.Source), cmp.Compare(a.Ref, b.Ref), cmp.Compare(a.Target, b.Target))
+	})
+	return out
+}
+
+// Diagnostic is a non-fatal issue found while processing a schema file.
+type Diagnostic struct {
+	// Path is the file the diagnostic applies to.
+	Path string
+	// Message describes the issue.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// addDiagnostic records a diagnostic on r. It's a no-op on a nil Report.
+func (r *Report) addDiagnostic(path, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// addFile records that a file of in bytes was inlined to out bytes. It's a
+// no-op on a nil Report.
+func (r *Report) addFile(in, out int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files++
+	r.inputBytes += in
+	r.outputBytes += out
+}
+
+// addInlined records that the target identified by ref was inlined as size
+// bytes of JSON. It's a no-op on a nil Report.
+func (r *Report) addInlined(ref string, size int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inlined == nil {
+		r.inlined = map[string]*DefUsage{}
+	}
+	u, ok := r.inlined[ref]
+	if !ok {
+		u = &DefUsage{Ref: ref}
+		r.inlined[ref] = u
+	}
+	u.Count++
+	u.Bytes += size
+}
+
+// addCycle records the cycle of ref targets cycle, however it's rotated. It's
+// a no-op on a nil Report.
+func (r *Report) addCycle(cycle []string) {
+	if r == nil {
+		return
+	}
+	start := slices.Index(cycle, slices.Min(cycle))
+	cycle = slices.Concat(cycle[start:], cycle[:start])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cycles == nil {
+		r.cycles = map[string][]string{}
+	}
+	r.cycles[strings.Join(cycle, "\n")] = cycle
+}
+
+// addResolved records that ref, at source while inlining path, resolved to
+// target. It's a no-op on a nil Report.
+func (r *Report) addResolved(path, source, ref, target string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resolved == nil {
+		r.resolved = map[ResolvedRef]bool{}
+	}
+	r.resolved[ResolvedRef{Path: path, Source: source, Ref: ref, Target: target}] = true
+}
@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReportTestSuite struct {
+	suite.Suite
+}
+
+func (r *ReportTestSuite) TestInlined() {
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(`{
+			"properties": {
+				"x": {"$ref": "#/$defs/Big"},
+				"y": {"$ref": "#/$defs/Big"},
+				"z": {"$ref": "#/$defs/Small"}
+			},
+			"$defs": {
+				"Big": {"properties": {"s": {"$ref": "#/$defs/Small"}}},
+				"Small": {"type": "string"}
+			}
+		}`)},
+	}
+
+	report := new(Report)
+	_, err := InlineBundledSchemasInFS(fsys, Options{Report: report, MeasureInlined: true})
+	r.Require().NoError(err)
+
+	r.Equal([]DefUsage{
+		{Ref: "a.json#/$defs/Big", Count: 2, Bytes: 2 * len(`{"properties":{"s":{"type":"string"}}}`)},
+		{Ref: "a.json#/$defs/Small", Count: 3, Bytes: 3 * len(`{"type":"string"}`)},
+	}, report.Inlined())
+
+	report = new(Report)
+	_, err = InlineBundledSchemasInFS(fsys, Options{Report: report})
+	r.Require().NoError(err)
+
+	r.Equal([]DefUsage{
+		{Ref: "a.json#/$defs/Small", Count: 3},
+		{Ref: "a.json#/$defs/Big", Count: 2},
+	}, report.Inlined())
+}
+
+func (r *ReportTestSuite) TestInlinedEmpty() {
+	r.Empty(new(Report).Inlined())
+}
+
+func (r *ReportTestSuite) TestStats() {
+	a := `{"properties": {"x": {"$ref": "#/$defs/A"}, "y": {"$ref": "#/$defs/B"}}, "$defs": {"A": {"type": "string"}, "B": {}}}`
+	fsys := fstest.MapFS{
+		"a.json":     {Data: []byte(a)},
+		"b.json":     {Data: []byte(`{"type": "null"}`)},
+		"empty.json": {Data: []byte(` `)},
+	}
+
+	report := new(Report)
+	updates, err := InlineBundledSchemasInFS(fsys, Options{MeasureInlined: true}, WithReport(report))
+	r.Require().NoError(err)
+
+	r.Equal(Stats{
+		Files:       2,
+		RefsInlined: 2,
+		InputBytes:  len(a) + len(`{"type": "null"}`),
+		OutputBytes: len(updates["a.json"]) + len(updates["b.json"]),
+		TopDefs:     []DefUsage{{Ref: "a.json#/$defs/A", Count: 1, Bytes: len(`{"type":"string"}`)}},
+	}, report.Stats(1))
+}
+
+func (r *ReportTestSuite) TestCycles() {
+	fsys := fstest.MapFS{
+		"tree.json": {Data: []byte(`{
+			"properties": {"root": {"$ref": "#/$defs/Node"}, "list": {"$ref": "#/$defs/List"}},
+			"$defs": {
+				"Node": {"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}}},
+				"List": {"properties": {"next": {"$ref": "#/$defs/Link"}}},
+				"Link": {"properties": {"list": {"$ref": "#/$defs/List"}}}
+			}
+		}`)},
+	}
+
+	report := new(Report)
+	updates, err := InlineBundledSchemasInFS(fsys, Options{PreserveRecursiveRefs: true, Report: report})
+	r.Require().NoError(err)
+
+	r.Equal([][]string{
+		{"tree.json#/$defs/Link", "tree.json#/$defs/List"},
+		{"tree.json#/$defs/Node"},
+	}, report.Cycles())
+	r.JSONEq(`{
+		"properties": {
+			"root": {"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}}},
+			"list": {"properties": {"next": {"properties": {"list": {"$ref": "#/$defs/List"}}}}}
+		},
+		"$defs": {
+			"Node": {"properties": {"children": {"items": {"$ref": "#/$defs/Node"}}}},
+			"List": {"properties": {"next": {"properties": {"list": {"$ref": "#/$defs/List"}}}}}
+		}
+	}`, string(updates["tree.json"]))
+}
+
+func (r *ReportTestSuite) TestCyclesEmpty() {
+	r.Empty(new(Report).Cycles())
+}
+
+func (r *ReportTestSuite) TestResolved() {
+	fsys := fstest.MapFS{
+		"a.json": {Data: []byte(`{
+			"properties": {
+				"x": {"$ref": "#/$defs/Id"},
+				"y": {"allOf": [{"$ref": "common.json#/$defs/Name"}, {"$ref": "common.json#/$defs/Name"}]}
+			},
+			"$defs": {"Id": {"$ref": "common.json#/$defs/Name"}}
+		}`)},
+		"common.json": {Data: []byte(`{"$defs": {"Name": {"properties": {"first": {"$ref": "#/$defs/Word"}}}, "Word": {"type": "string"}}}`)},
+	}
+
+	report := new(Report)
+	_, err := InlineBundledSchemasInFS(fsys, Options{Report: report})
+	r.Require().NoError(err)
+
+	r.Equal([]ResolvedRef{
+		{Path: "a.json", Source: "a.json#/$defs/Id", Ref: "common.json#/$defs/Name", Target: "common.json#/$defs/Name"},
+		{Path: "a.json", Source: "a.json#/properties/x", Ref: "#/$defs/Id", Target: "a.json#/$defs/Id"},
+		{Path: "a.json", Source: "a.json#/properties/y/allOf/0", Ref: "common.json#/$defs/Name", Target: "common.json#/$defs/Name"},
+		{Path: "a.json", Source: "a.json#/properties/y/allOf/1", Ref: "common.json#/$defs/Name", Target: "common.json#/$defs/Name"},
+		{Path: "a.json", Source: "common.json#/$defs/Name/properties/first", Ref: "#/$defs/Word", Target: "common.json#/$defs/Word"},
+	}, report.Resolved())
+}
+
+func (r *ReportTestSuite) TestResolvedEmpty() {
+	r.Empty(new(Report).Resolved())
+}
+
+func TestReportTestSuite(t *testing.T) {
+	suite.Run(t, new(ReportTestSuite))
+}
@@ -0,0 +1,621 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// document is a parsed schema document that refs can point into.
+type document struct {
+	// path is the location of the document in Options.FS. It's empty for
+	// in-memory documents.
+	path string
+	// dir is the directory relative refs in the document resolve against.
+	dir string
+	// id is the absolute top-level $id of the document, if it has one.
+	id   string
+	root any
+	// lines holds the line of each element of root for an NDJSON document,
+	// which has one schema per line.
+	lines []int
+	// fetched is set for documents fetched with a handler registered with
+	// Options.RegisterScheme, whose path is their URI.
+	fetched bool
+	// src holds the bytes the document was parsed from, kept only with
+	// Options.PreserveFormatting.
+	src []byte
+	// outer is set for a schema nested in a file that declares its own $id,
+	// making it an embedded resource that refs within it resolve against.
+	// outer is the document of the file, and scope the JSON Pointer of the
+	// schema in it.
+	outer *document
+	scope string
+}
+
+func newDocument(p string, root any) *document {
+	return &document{path: p, dir: path.Dir(p), id: documentID(root), root: root}
+}
+
+// documentID returns the top-level $id of root if it's an absolute URI,
+// without any empty fragment.
+func documentID(root any) string {
+	m, _ := root.(map[string]any)
+	id, _ := m["$id"].(string)
+	u, err := url.Parse(id)
+	if err != nil || !u.IsAbs() {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// embeddedDocument returns the embedded resource for node, the schema at ptr in the
+// file of doc that declares its own $id. Its $id is resolved against that of
+// doc.
+func embeddedDocument(doc *document, node map[string]any, ptr string) *document {
+	file := doc
+	if doc.outer != nil {
+		file = doc.outer
+	}
+	id, _ := node["$id"].(string)
+	if base, err := url.Parse(doc.id); err == nil && doc.id != "" {
+		if u, err := url.Parse(id); err == nil {
+			id = base.ResolveReference(u).String()
+		}
+	}
+	return &document{
+		path:    file.path,
+		dir:     file.dir,
+		id:      documentID(map[string]any{"$id": id}),
+		root:    node,
+		fetched: file.fetched,
+		outer:   file,
+		scope:   ptr,
+	}
+}
+
+// embeddedScopes tracks the embedded resources of a file as walkSchemas visits
+// its schemas, keyed by their JSON Pointers, so refs in each schema can be
+// resolved against the nearest one enclosing it, as inlineRefs does.
+type embeddedScopes map[string]*document
+
+// at returns the document refs in m, the schema at ptr in the file of doc,
+// resolve against. Schemas enclosing m must have been visited first.
+func (s embeddedScopes) at(doc *document, m map[string]any, ptr string) *document {
+	scope := doc
+	for p := ptr; p != ""; {
+		p = p[:strings.LastIndex(p, "/")]
+		if d, ok := s[p]; ok {
+			scope = d
+			break
+		}
+	}
+	if _, ok := m["$id"].(string); ok && ptr != "" {
+		scope = embeddedDocument(scope, m, ptr)
+		s[ptr] = scope
+	}
+	return scope
+}
+
+// docCache holds the parsed documents shared by forked inliners.
+type docCache struct {
+	mu sync.Mutex
+	// docs holds documents by their path in Options.FS.
+	docs map[string]*document
+	// ids maps absolute $id URIs to the documents declaring them. It's built
+	// on first use.
+	ids map[string]*document
+	// priors maps the path of each file bundled into one of
+	// Options.PriorBundles to its entries. It's built on first use.
+	priors map[string][]priorDef
+	// pointers caches the unescaped reference tokens of each JSON Pointer
+	// refs are resolved by, as []string. The same few refs to hot defs are
+	// resolved over and over in a large bundle.
+	pointers sync.Map
+}
+
+// get returns the document at p, if it has been parsed.
+func (c *docCache) get(p string) (*document, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	doc, ok := c.docs[p]
+	return doc, ok
+}
+
+// add caches doc, unless a document at the same path was cached first, and
+// returns the cached document.
+func (c *docCache) add(doc *document) *document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.docs[doc.path]; ok {
+		return cached
+	}
+	c.docs[doc.path] = doc
+	return doc
+}
+
+// paths returns the paths of the cached documents, sorted.
+func (c *docCache) paths() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Sorted(maps.Keys(c.docs))
+}
+
+// byID returns the document declaring the absolute $id uri. The index must
+// have been built.
+func (c *docCache) byID(uri string) (*document, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	doc, ok := c.ids[uri]
+	return doc, ok
+}
+
+// addDocument parses b as the document at p and caches it so refs from other
+// documents reuse it.
+func (in *inliner) addDocument(p string, b []byte) (*document, error) {
+	if isNDJSON(p) {
+		elems, lines, err := parseNDJSON(b, in.opts.Dialect)
+		if err != nil {
+			return nil, err
+		}
+		root, err := in.prepareRoot(elems)
+		if err != nil {
+			return nil, err
+		}
+		doc := newDocument(p, root)
+		doc.lines = lines
+		return in.cache.add(doc), nil
+	}
+	root, err := in.parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	doc := newDocument(p, root)
+	if in.opts.PreserveFormatting {
+		doc.src = b
+	}
+	return in.cache.add(doc), nil
+}
+
+// indexIDs maps the absolute $id of every schema file in opts.FS to its
+// document. Two files declaring the same $id is an error.
+func (in *inliner) indexIDs() error {
+	c := in.cache
+	c.mu.Lock()
+	built := c.ids != nil
+	c.mu.Unlock()
+	if built || in.opts.FS == nil {
+		return nil
+	}
+
+	ids := map[string]*document{}
+	err := fs.WalkDir(in.opts.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (inSamplesDir(p, in.opts) || !in.opts.selectsPath(p, true)) {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !isSourceFile(d.Name(), in.opts.Dialect) || !in.opts.selectsPath(p, false) {
+			return nil
+		}
+
+		doc, ok := c.get(p)
+		if !ok {
+			b, err := readSchemaFile(in.opts.FS, p)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", p, err)
+			}
+			if isBlank(bytes.TrimPrefix(b, utf8BOM)) {
+				return nil
+			}
+			doc, err = in.addDocument(p, b)
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", p, err)
+			}
+		}
+		if doc.id == "" {
+			return nil
+		}
+		if other, ok := ids[doc.id]; ok {
+			return fmt.Errorf("$id %q is declared by both %s and %s", doc.id, other.path, doc.path)
+		}
+		ids[doc.id] = doc
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.ids = ids
+	c.mu.Unlock()
+	return nil
+}
+
+// loadDocument returns the document addr refers to, resolved relative to the
+// document from. Absolute URIs, and relative ones in a document with an
+// absolute $id, are looked up by $id first, and file:// URIs not declared as an
+// $id then map onto opts.FS with "/" as its root. Absolute URIs with a scheme
+// registered with Options.RegisterScheme, and relative ones in a document
+// fetched that way, are fetched next. Otherwise, which includes a
+// relative addr that resolves against the $id to a URI no document declares,
+// addr is a path relative to the directory from was read from.
+func (in *inliner) loadDocument(addr string, from *document) (*document, error) {
+	if u, err := url.Parse(addr); err == nil && (u.IsAbs() || from.id != "") {
+		abs := u.IsAbs()
+		if !abs {
+			base, _ := url.Parse(from.id)
+			u = base.ResolveReference(u)
+		}
+		uri := u.String()
+		if uri == from.id {
+			return from, nil
+		}
+		if err := in.indexIDs(); err != nil {
+			return nil, err
+		}
+		if doc, ok := in.cache.byID(uri); ok {
+			return doc, nil
+		}
+		if u.Scheme == "file" {
+			p, err := filePath(u)
+			if err != nil {
+				return nil, err
+			}
+			return in.loadPath(p, addr)
+		}
+		if fetch, ok := in.opts.Schemes[u.Scheme]; ok && (abs || from.fetched) {
+			return in.fetchDocument(uri, fetch)
+		}
+		if abs {
+			return nil, &missingRefError{fmt.Sprintf("unresolved ref %q: no document has this $id", addr)}
+		}
+	}
+	p := path.Join(from.dir, addr)
+	if strings.HasPrefix(addr, "/") {
+		p = path.Clean(strings.TrimPrefix(addr, "/"))
+	}
+	return in.loadPath(p, addr)
+}
+
+// fetchDocument returns the document at uri, fetched with fetch the first time
+// it's needed. Relative refs in it resolve against uri.
+func (in *inliner) fetchDocument(uri string, fetch func(uri string) ([]byte, error)) (*document, error) {
+	if doc, ok := in.cache.get(uri); ok {
+		return doc, nil
+	}
+	b, err := fetch(uri)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", uri, err)
+	}
+	root, err := in.parseDocument(bytes.TrimPrefix(b, utf8BOM))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", uri, err)
+	}
+	doc := newDocument(uri, root)
+	if doc.id == "" {
+		doc.id = uri
+	}
+	doc.fetched = true
+	in.opts.logger().Debug("Fetched document", "uri", uri)
+	return in.cache.add(doc), nil
+}
+
+// filePath maps a file:// URI onto a path in opts.FS, treating the FS as the
+// root of the file system.
+func filePath(u *url.URL) (string, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("ref to %q names host %q, only local file:// URIs are supported", u, u.Host)
+	}
+	p := path.Clean(strings.TrimPrefix(u.Path, "/"))
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("ref to %q resolves outside of the FS root", u)
+	}
+	return p, nil
+}
+
+// loadPath returns the document at p in opts.FS. addr is the ref p was
+// resolved from, for errors.
+func (in *inliner) loadPath(p, addr string) (*document, error) {
+	if in.opts.FS == nil {
+		return nil, fmt.Errorf("cannot resolve ref to %q: no FS configured", addr)
+	}
+	if !fs.ValidPath(p) {
+		return nil, fmt.Errorf("ref to %q resolves outside of the FS root", addr)
+	}
+	if doc, ok := in.cache.get(p); ok {
+		return doc, nil
+	}
+
+	b, err := in.readFallback(p)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := in.addDocument(p, b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p, err)
+	}
+	return doc, nil
+}
+
+// readFallback reads the file at p from opts.FS or else the first of
+// opts.FallbackFS that has it.
+func (in *inliner) readFallback(p string) ([]byte, error) {
+	b, err := readSchemaFile(in.opts.FS, p)
+	if len(in.opts.FallbackFS) == 0 || !errors.Is(err, fs.ErrNotExist) {
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		return b, nil
+	}
+
+	searched := []string{"the FS"}
+	for i, fsys := range in.opts.FallbackFS {
+		b, err := readSchemaFile(fsys, p)
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read %s from fallback FS %d: %w", p, i+1, err)
+		}
+		searched = append(searched, fmt.Sprintf("fallback FS %d", i+1))
+	}
+	return nil, fmt.Errorf("read %s: not found in %s: %w", p, strings.Join(searched, ", "), fs.ErrNotExist)
+}
+
+// missingRefError reports a ref whose target doesn't exist, as opposed to one
+// that's malformed.
+type missingRefError struct {
+	msg string
+}
+
+func (e *missingRefError) Error() string {
+	return e.msg
+}
+
+// isMissingRef reports whether err means a ref's target doesn't exist, either
+// within a document or because the document itself is missing.
+func isMissingRef(err error) bool {
+	var missing *missingRefError
+	return errors.As(err, &missing) || errors.Is(err, fs.ErrNotExist)
+}
+
+// refTarget is the resolved target of a $ref.
+type refTarget struct {
+	value any
+	// doc is the document the target lives in.
+	doc *document
+	// frag is the JSON Pointer fragment within doc, without the leading "#".
+	frag string
+}
+
+// key uniquely identifies the target across documents.
+func (t refTarget) key() string {
+	return t.doc.path + "#" + t.frag
+}
+
+// resolveRef finds the target of ref, which appears in doc.
+func (in *inliner) resolveRef(ref string, doc *document) (refTarget, error) {
+	addr, frag, _ := strings.Cut(ref, "#")
+	if t, ok, err := in.resolvePrior(addr, frag, doc); ok || err != nil {
+		return t, err
+	}
+	targetDoc := doc
+	if addr != "" {
+		var err error
+		targetDoc, err = in.loadDocument(addr, doc)
+		if err != nil {
+			return refTarget{}, err
+		}
+	}
+
+	// A fragment other than a JSON Pointer names an anchor. It's replaced
+	// by the pointer to the schema declaring it, so refs to a schema by
+	// anchor and by pointer are the same ref.
+	if frag != "" && !strings.HasPrefix(frag, "/") {
+		ptr, err := findAnchor(targetDoc.root, frag, in.opts.maxDepth())
+		if err != nil {
+			if addr != "" {
+				return refTarget{}, fmt.Errorf("%s: %w", targetDoc.path, err)
+			}
+			return refTarget{}, err
+		}
+		frag = ptr
+	}
+
+	if k := keywordToken(frag); in.strip[k] {
+		return refTarget{}, fmt.Errorf("$ref %q targets %q, which is stripped from the output", ref, k)
+	}
+	if frag == "" {
+		return fileTarget(refTarget{value: targetDoc.root, doc: targetDoc}), nil
+	}
+
+	target, err := getByPointer(targetDoc.root, "#"+frag, in.cache)
+	if err != nil {
+		if addr != "" {
+			return refTarget{}, fmt.Errorf("%s: %w", targetDoc.path, err)
+		}
+		return refTarget{}, err
+	}
+	return fileTarget(refTarget{value: target, doc: targetDoc, frag: frag}), nil
+}
+
+// fileTarget returns t with a target in an embedded resource moved to the file
+// holding it, so a target has one key however it's reached, and is bundled
+// and reported by where it is in its file.
+func fileTarget(t refTarget) refTarget {
+	if t.doc.outer != nil {
+		t.doc, t.frag = t.doc.outer, t.doc.scope+t.frag
+	}
+	return t
+}
+
+// findAnchor returns the JSON Pointer of the schema in root that declares the
+// plain name anchor as its $anchor or $dynamicAnchor.
+func findAnchor(root any, anchor string, max int) (string, error) {
+	var found []string
+	err := walkSchemas(root, "", max, func(m map[string]any, ptr string) {
+		if m["$anchor"] == anchor || m["$dynamicAnchor"] == anchor {
+			found = append(found, ptr)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", &missingRefError{fmt.Sprintf("unresolved $ref %q: no schema declares the anchor", "#"+anchor)}
+	case 1:
+		return found[0], nil
+	}
+	slices.Sort(found)
+	return "", fmt.Errorf("anchor %q is declared by both %q and %q", anchor, "#"+found[0], "#"+found[1])
+}
+
+// checkDraft records a diagnostic if doc declares a different $schema than the
+// host it's being inlined into, since embedding e.g. draft-07 content in a
+// 2020-12 document can subtly change validation.
+func (in *inliner) checkDraft(doc *document) {
+	pair := [2]*document{in.host, doc}
+	if doc == in.host || in.draftChecked[pair] {
+		return
+	}
+	in.draftChecked[pair] = true
+
+	hostDraft, docDraft := declaredSchema(in.host.root), declaredSchema(doc.root)
+	if hostDraft != "" && docDraft != "" && hostDraft != docDraft {
+		in.opts.warn(in.host.path, "inlined content from %s declares $schema %q, but the document declares %q", doc.path, docDraft, hostDraft)
+	}
+}
+
+// declaredSchema returns the top-level $schema of root, if any.
+func declaredSchema(root any) string {
+	m, _ := root.(map[string]any)
+	s, _ := m["$schema"].(string)
+	return s
+}
+
+// relativeRef rewrites a ref to t so that it resolves from the output of the
+// host document being inlined.
+func (in *inliner) relativeRef(t refTarget) string {
+	if t.doc == in.host {
+		return "#" + t.frag
+	}
+	ref := relPath(in.host.dir, t.doc.path)
+	if t.doc.fetched {
+		ref = t.doc.path
+	}
+	if t.frag != "" {
+		ref += "#" + t.frag
+	}
+	return ref
+}
+
+// relPath returns the slash-separated path of to relative to the directory
+// fromDir, both being paths in the same FS. It falls back to a path from the FS
+// root if there's no relative path.
+func relPath(fromDir, to string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(fromDir), filepath.FromSlash(to))
+	if err != nil {
+		return "/" + to
+	}
+	return filepath.ToSlash(rel)
+}
+
+// defName returns the name of the top-level $defs entry that a fragment like
+// "/$defs/A/properties/b" points into.
+func defName(frag string) (string, bool) {
+	rest, ok := strings.CutPrefix(frag, "/$defs/")
+	if !ok {
+		return "", false
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	name = strings.ReplaceAll(name, "~1", "/")
+	return strings.ReplaceAll(name, "~0", "~"), true
+}
+
+// parseDocument parses b and prepares it for inlining.
+func (in *inliner) parseDocument(b []byte) (any, error) {
+	root, err := parseSource(b, in.opts.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	return in.prepareRoot(root)
+}
+
+// prepareRoot applies any variable substitution and dialect upgrade from the
+// options to a parsed document.
+func (in *inliner) prepareRoot(root any) (any, error) {
+	if !in.opts.SubstituteVars && in.opts.TargetDraft == "" {
+		return root, nil
+	}
+	// Neither substitution nor the upgrade tracks depth itself.
+	if err := checkDepth(root, 0, in.opts.maxDepth()); err != nil {
+		return nil, err
+	}
+	if in.opts.SubstituteVars {
+		var err error
+		if root, err = substituteVars(root, in.opts); err != nil {
+			return nil, err
+		}
+	}
+	if in.opts.TargetDraft != "" {
+		return upgradeDocument(root, in.opts.TargetDraft)
+	}
+	return root, nil
+}
+
+// checkDepth returns an error if node, at depth, nests deeper than max.
+func checkDepth(node any, depth, max int) error {
+	if depth >= max {
+		return errMaxDepth(max)
+	}
+	switch v := node.(type) {
+	case map[string]any:
+		for _, child := range v {
+			if err := checkDepth(child, depth+1, max); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := checkDepth(child, depth+1, max); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keywordToken returns the final, unescaped reference token of a JSON
+// Pointer if it names a keyword, or "" if it names an entry of an object like
+// "properties", as in "/properties/$schema", or the pointer is empty.
+func keywordToken(frag string) string {
+	if frag == "" {
+		return ""
+	}
+	toks := strings.Split(frag[1:], "/")
+	keyword := true
+	for _, tok := range toks[:len(toks)-1] {
+		keyword = !keyword || !schemaMapKeywords[unescapeToken(tok)]
+	}
+	if !keyword {
+		return ""
+	}
+	return unescapeToken(toks[len(toks)-1])
+}
+
+// parseJSON decodes b, ignoring a leading UTF-8 byte order mark.
+func parseJSON(b []byte) (any, error) {
+	return decodeJSON(bytes.TrimPrefix(b, utf8BOM))
+}
@@ -0,0 +1,290 @@
+package schema
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ResolveTestSuite struct {
+	suite.Suite
+}
+
+func (r *ResolveTestSuite) TestInlineBundledSchemasInFSByID() {
+	fsys := fstest.MapFS{
+		"services/order/order.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/order",
+			"properties": {
+				"customer": {"$ref": "https://example.com/schemas/customer#/$defs/Customer"},
+				"total": {"$ref": "money#/$defs/Money"},
+				"note": {"$ref": "../../shared/note.json"}
+			}
+		}`)},
+		"shared/customer.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/customer#",
+			"$defs": {"Customer": {"properties": {"name": {"type": "string"}}}}
+		}`)},
+		"shared/deep/money.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/money",
+			"$defs": {"Money": {"properties": {"self": {"$ref": "https://example.com/schemas/money#/$defs/Amount"}}}, "Amount": {"type": "integer"}}
+		}`)},
+		"shared/note.json": {Data: []byte(`{"type": "string"}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{})
+	r.Require().NoError(err)
+
+	r.JSONEq(`{
+		"properties": {
+			"customer": {"properties": {"name": {"type": "string"}}},
+			"total": {"properties": {"self": {"type": "integer"}}},
+			"note": {"type": "string"}
+		}
+	}`, string(updates["services/order/order.json"]))
+}
+
+func (r *ResolveTestSuite) TestInlineBundledSchemasInFSByIDErrors() {
+	type test struct {
+		Given       fstest.MapFS
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"conflicting ids": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$id": "https://example.com/x"}`)},
+				"b.json": {Data: []byte(`{"$id": "https://example.com/x#"}`)},
+			},
+			ExpectedErr: `$id "https://example.com/x" is declared by both a.json and b.json`,
+		},
+		"unknown id": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(`{"$ref": "https://example.com/nope#/$defs/A"}`)},
+			},
+			ExpectedErr: `inline refs in a.json: unresolved ref "https://example.com/nope": no document has this $id`,
+		},
+	}
+
+	for desc, v := range tests {
+		r.Run(desc, func() {
+			_, err := InlineBundledSchemasInFS(v.Given, Options{})
+			r.EqualError(err, v.ExpectedErr)
+		})
+	}
+}
+
+func (r *ResolveTestSuite) TestInlineSchemaBytesByID() {
+	fsys := fstest.MapFS{
+		"a/customer.json": {Data: []byte(`{"$id": "https://example.com/customer", "type": "object"}`)},
+	}
+
+	out, err := InlineSchemaBytes([]byte(`{"items": {"$ref": "https://example.com/customer"}}`), Options{FS: fsys})
+	r.Require().NoError(err)
+	r.JSONEq(`{"items": {"type": "object"}}`, string(out))
+}
+
+func (r *ResolveTestSuite) TestInlineSchemaBytesFileURI() {
+	fsys := fstest.MapFS{
+		"abs/path/schema.json": {Data: []byte(`{
+			"$defs": {
+				"X": {"properties": {"y": {"$ref": "#/$defs/Y"}, "z": {"$ref": "z.json"}}},
+				"Y": {"type": "string"}
+			}
+		}`)},
+		"abs/path/z.json": {Data: []byte(`{"type": "integer"}`)},
+		"ided.json":       {Data: []byte(`{"$id": "file:///elsewhere/ided.json", "type": "boolean"}`)},
+	}
+
+	type test struct {
+		Given       string
+		Expected    string
+		ExpectedErr string
+	}
+
+	tests := map[string]test{
+		"fragment": {
+			Given:    `{"$ref": "file:///abs/path/schema.json#/$defs/X"}`,
+			Expected: `{"properties": {"y": {"type": "string"}, "z": {"type": "integer"}}}`,
+		},
+		"whole file": {
+			Given:    `{"$ref": "file://localhost/abs/path/z.json"}`,
+			Expected: `{"type": "integer"}`,
+		},
+		"declared as $id": {
+			Given:    `{"$ref": "file:///elsewhere/ided.json"}`,
+			Expected: `{"type": "boolean"}`,
+		},
+		"relative to a file $id": {
+			Given:    `{"$id": "file:///abs/path/main.json", "$ref": "z.json"}`,
+			Expected: `{"type": "integer"}`,
+		},
+		"missing file": {
+			Given:       `{"$ref": "file:///abs/nope.json"}`,
+			ExpectedErr: "inline refs: read abs/nope.json: open abs/nope.json: file does not exist",
+		},
+		"outside fs root": {
+			Given:       `{"$ref": "file:///../etc/schema.json"}`,
+			ExpectedErr: `inline refs: ref to "file:///../etc/schema.json" resolves outside of the FS root`,
+		},
+		"remote host": {
+			Given:       `{"$ref": "file://server/share/schema.json"}`,
+			ExpectedErr: `inline refs: ref to "file://server/share/schema.json" names host "server", only local file:// URIs are supported`,
+		},
+	}
+
+	for desc, v := range tests {
+		r.Run(desc, func() {
+			out, err := InlineSchemaBytes([]byte(v.Given), Options{FS: fsys})
+			if v.ExpectedErr != "" {
+				r.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if !r.NoError(err) {
+				return
+			}
+			r.JSONEq(v.Expected, string(out))
+		})
+	}
+}
+
+func (r *ResolveTestSuite) TestInlineBundledSchemasInFSBaseURI() {
+	// remote.json is retrieved from mirror/, but its $id places it under
+	// https://example.com/schemas/, so its relative refs resolve against
+	// that, and only fall back to where it was retrieved from when no
+	// document declares the resulting $id.
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{"properties": {"a": {"$ref": "file:///mirror/remote.json"}}}`)},
+		"mirror/remote.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/remote.json",
+			"properties": {"b": {"$ref": "types.json#/$defs/B"}, "c": {"$ref": "local.json"}}
+		}`)},
+		"mirror/types.json": {Data: []byte(`{"$defs": {"B": {"type": "null"}}}`)},
+		"mirror/local.json": {Data: []byte(`{"type": "integer"}`)},
+		"schemas/types.json": {Data: []byte(`{
+			"$id": "https://example.com/schemas/types.json",
+			"$defs": {"B": {"type": "string"}}
+		}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{})
+	r.Require().NoError(err)
+	r.JSONEq(`{"properties": {"a": {"properties": {"b": {"type": "string"}, "c": {"type": "integer"}}}}}`, string(updates["order.json"]))
+
+	// The same goes for a document only found in a fallback FS.
+	vendor := fstest.MapFS{}
+	for _, p := range []string{"mirror/remote.json", "mirror/types.json", "mirror/local.json"} {
+		vendor[p] = fsys[p]
+		delete(fsys, p)
+	}
+	updates, err = InlineBundledSchemasInFS(fsys, WithFallbackFS(vendor))
+	r.Require().NoError(err)
+	r.JSONEq(`{"properties": {"a": {"properties": {"b": {"type": "string"}, "c": {"type": "integer"}}}}}`, string(updates["order.json"]))
+}
+
+func (r *ResolveTestSuite) TestInlineBundledSchemasInFSFallback() {
+	fsys := fstest.MapFS{
+		"order.json": {Data: []byte(`{
+			"properties": {
+				"id": {"$ref": "common/id.json"},
+				"money": {"$ref": "vendor/money.json"}
+			}
+		}`)},
+		"common/id.json": {Data: []byte(`{"type": "string"}`)},
+	}
+	vendorA := fstest.MapFS{
+		"vendor/money.json": {Data: []byte(`{"properties": {"amount": {"$ref": "amount.json"}, "currency": {"$ref": "../common/id.json"}}}`)},
+		"common/id.json":    {Data: []byte(`{"type": "integer"}`)},
+	}
+	vendorB := fstest.MapFS{
+		"vendor/money.json":  {Data: []byte(`{"type": "null"}`)},
+		"vendor/amount.json": {Data: []byte(`{"type": "number"}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, WithFallbackFS(vendorA, vendorB))
+	r.Require().NoError(err)
+	r.Len(updates, 2)
+	r.JSONEq(`{
+		"properties": {
+			"id": {"type": "string"},
+			"money": {"properties": {"amount": {"type": "number"}, "currency": {"type": "string"}}}
+		}
+	}`, string(updates["order.json"]))
+
+	fsys["order.json"] = &fstest.MapFile{Data: []byte(`{"$ref": "vendor/gone.json"}`)}
+	_, err = InlineBundledSchemasInFS(fsys, WithFallbackFS(vendorA, vendorB))
+	r.EqualError(err, "inline refs in order.json: read vendor/gone.json: not found in the FS, fallback FS 1, fallback FS 2: file does not exist")
+}
+
+func (r *ResolveTestSuite) TestInlineBundledSchemasInFSSchemes() {
+	type test struct {
+		Given       string
+		Expected    string
+		ExpectedErr string
+	}
+
+	remote := map[string]string{
+		"s3://schemas/common/money.json":    `{"properties": {"amount": {"$ref": "#/$defs/Amount"}, "currency": {"$ref": "currency.json"}}, "$defs": {"Amount": {"type": "number"}}}`,
+		"s3://schemas/common/currency.json": `{"type": "string", "minLength": 3}`,
+		"registry://billing/invoice":        `{"properties": {"total": {"$ref": "s3://schemas/common/money.json"}, "id": {"$ref": "https://example.com/id.json"}}}`,
+	}
+	var fetched []string
+	fetch := func(uri string) ([]byte, error) {
+		fetched = append(fetched, uri)
+		if b, ok := remote[uri]; ok {
+			return []byte(b), nil
+		}
+		return nil, errors.New("no such key")
+	}
+
+	tests := map[string]test{
+		"fetched": {
+			Given: `{"properties": {"a": {"$ref": "S3://schemas/common/money.json"}, "b": {"$ref": "s3://schemas/common/money.json#/$defs/Amount"}}}`,
+			Expected: `{"properties": {
+				"a": {"properties": {"amount": {"type": "number"}, "currency": {"type": "string", "minLength": 3}}},
+				"b": {"type": "number"}
+			}}`,
+		},
+		"between schemes and into FS by $id": {
+			Given: `{"$ref": "registry://billing/invoice#/properties"}`,
+			Expected: `{
+				"total": {"properties": {"amount": {"type": "number"}, "currency": {"type": "string", "minLength": 3}}},
+				"id": {"type": "integer"}
+			}`,
+		},
+		"fetch error": {
+			Given:       `{"$ref": "s3://schemas/gone.json"}`,
+			ExpectedErr: "inline refs in schema.json: fetch s3://schemas/gone.json: no such key",
+		},
+		"unregistered": {
+			Given:       `{"$ref": "git://schemas/a.json"}`,
+			ExpectedErr: `inline refs in schema.json: unresolved ref "git://schemas/a.json": no document has this $id`,
+		},
+	}
+
+	for desc, v := range tests {
+		r.Run(desc, func() {
+			fetched = nil
+			fsys := fstest.MapFS{
+				"schema.json": {Data: []byte(v.Given)},
+				"id.json":     {Data: []byte(`{"$id": "https://example.com/id.json", "type": "integer"}`)},
+			}
+			var opts Options
+			opts.RegisterScheme("S3", fetch)
+			updates, err := InlineBundledSchemasInFS(fsys, opts, WithScheme("registry", fetch))
+			if v.ExpectedErr != "" {
+				r.EqualError(err, v.ExpectedErr)
+				return
+			}
+			r.Require().NoError(err)
+			r.JSONEq(v.Expected, string(updates["schema.json"]))
+			r.Equal(len(fetched), len(slices.Compact(slices.Sorted(slices.Values(fetched)))), "fetched %v", fetched)
+		})
+	}
+}
+
+func TestResolveTestSuite(t *testing.T) {
+	suite.Run(t, new(ResolveTestSuite))
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// samplesDir returns the directory in Options.SamplesDir holding the sample
+// instances of the schema file at p: its path without the extension, so
+// "common/user.json" has its samples in "<SamplesDir>/common/user".
+func samplesDir(samples, p string) string {
+	p = strings.TrimSuffix(p, gzipExt)
+	return path.Join(samples, strings.TrimSuffix(p, path.Ext(p)))
+}
+
+// inSamplesDir reports whether p is Options.SamplesDir, which is skipped when
+// looking for schema files.
+func inSamplesDir(p string, opts Options) bool {
+	return opts.SamplesDir != "" && path.Clean(p) == path.Clean(opts.SamplesDir)
+}
+
+// checkSamples validates the sample instances of each of docs against the
+// document as read and as inlined to outs, returning an error for the first
+// sample they disagree on.
+func checkSamples(fsys fs.FS, docs []*document, outs [][]byte, opts Options) error {
+	before, err := newSampleCompiler(docs, nil, nil)
+	if err != nil {
+		return err
+	}
+	for i, doc := range docs {
+		dir := samplesDir(opts.SamplesDir, doc.path)
+		entries, err := fs.ReadDir(fsys, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read samples of %s: %w", doc.path, err)
+		}
+
+		orig, err := before.Compile(sampleURL(doc.path))
+		if err != nil {
+			return fmt.Errorf("compile %s: %w", doc.path, err)
+		}
+		inlined, err := decodeJSON(outs[i])
+		if err != nil {
+			return fmt.Errorf("parse output of %s: %w", doc.path, err)
+		}
+		after, err := newSampleCompiler(docs, doc, inlined)
+		if err != nil {
+			return err
+		}
+		out, err := after.Compile(sampleURL(doc.path))
+		if err != nil {
+			return fmt.Errorf("compile output of %s: %w", doc.path, err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || path.Ext(e.Name()) != ".json" {
+				continue
+			}
+			p := path.Join(dir, e.Name())
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return fmt.Errorf("read sample %s: %w", p, err)
+			}
+			instance, err := decodeJSON(bytes.TrimPrefix(b, utf8BOM))
+			if err != nil {
+				return fmt.Errorf("parse sample %s: %w", p, err)
+			}
+			errBefore, errAfter := orig.Validate(instance), out.Validate(instance)
+			switch {
+			case errBefore == nil && errAfter != nil:
+				return fmt.Errorf("sample %s is valid against %s before inlining but not after: %w", p, doc.path, errAfter)
+			case errBefore != nil && errAfter == nil:
+				return fmt.Errorf("sample %s is valid against %s after inlining but not before: %w", p, doc.path, errBefore)
+			}
+			opts.logger().Debug("Checked sample", "path", p, "schema", doc.path, "valid", errBefore == nil)
+		}
+	}
+	return nil
+}
+
+// newSampleCompiler returns a validator compiler that knows every one of
+// docs, by path and by $id, with the root of replaced swapped for root if
+// it's set. Nothing else is loaded.
+func newSampleCompiler(docs []*document, replaced *document, root any) (*jsonschema.Compiler, error) {
+	c := jsonschema.NewCompiler()
+	c.UseLoader(noLoader{})
+	for _, doc := range docs {
+		v := doc.root
+		if doc == replaced {
+			v = root
+		}
+		if err := c.AddResource(sampleURL(doc.path), v); err != nil {
+			return nil, fmt.Errorf("load %s for validation: %w", doc.path, err)
+		}
+		if id := documentID(v); id != "" {
+			// Two documents claiming an $id is reported by inlining already.
+			_ = c.AddResource(id, v)
+		}
+	}
+	return c, nil
+}
+
+// sampleURL is the URL a validator knows the document at p by.
+func sampleURL(p string) string {
+	return "file:///" + p
+}
+
+// noLoader fails to load anything, so validation never reaches outside fsys.
+type noLoader struct{}
+
+func (noLoader) Load(url string) (any, error) {
+	return nil, fmt.Errorf("%s isn't a schema file", url)
+}
@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SamplesTestSuite struct {
+	suite.Suite
+}
+
+func (s *SamplesTestSuite) TestInlineBundledSchemasInFSSamples() {
+	type test struct {
+		Opts        Options
+		Samples     fstest.MapFS
+		ExpectedErr string
+	}
+
+	schemas := fstest.MapFS{
+		"user.json": {Data: []byte(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {"id": {"$ref": "common/id.json"}, "name": {"$ref": "#/$defs/Name"}},
+			"required": ["id"],
+			"$defs": {"Name": {"type": "string", "minLength": 1}}
+		}`)},
+		"common/id.json": {Data: []byte(`{"type": "string", "pattern": "^[a-z]+$"}`)},
+	}
+
+	tests := map[string]test{
+		"same results": {
+			Samples: fstest.MapFS{
+				"samples/user/ok.json":        {Data: []byte(`{"id": "abc", "name": "A"}`)},
+				"samples/user/bad-id.json":    {Data: []byte(`{"id": "ABC"}`)},
+				"samples/user/empty.json":     {Data: []byte(`{"id": "abc", "name": ""}`)},
+				"samples/user/notes.txt":      {Data: []byte(`not a sample`)},
+				"samples/common/id/word.json": {Data: []byte(`"abc"`)},
+			},
+		},
+		"no samples": {},
+		"stripped keyword": {
+			Opts: Options{StripKeys: []string{"pattern"}},
+			Samples: fstest.MapFS{
+				"samples/user/bad-id.json": {Data: []byte(`{"id": "ABC"}`)},
+			},
+			ExpectedErr: "sample samples/user/bad-id.json is valid against user.json after inlining but not before: ",
+		},
+		"invalid sample": {
+			Samples: fstest.MapFS{
+				"samples/user/bad.json": {Data: []byte(`{`)},
+			},
+			ExpectedErr: "parse sample samples/user/bad.json: unexpected end of JSON input",
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			fsys := fstest.MapFS{}
+			for p, f := range schemas {
+				fsys[p] = f
+			}
+			for p, f := range v.Samples {
+				fsys[p] = f
+			}
+			opts := v.Opts
+			opts.SamplesDir = "samples"
+
+			updates, err := InlineBundledSchemasInFS(fsys, opts)
+			if v.ExpectedErr != "" {
+				s.ErrorContains(err, v.ExpectedErr)
+				return
+			}
+			s.Require().NoError(err)
+			s.Equal([]string{"common/id.json", "user.json"}, slices.Sorted(maps.Keys(updates)))
+		})
+	}
+}
+
+func TestSamplesTestSuite(t *testing.T) {
+	suite.Run(t, new(SamplesTestSuite))
+}
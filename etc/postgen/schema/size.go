@@ -0,0 +1,91 @@
+package schema
+
+import "reflect"
+
+// SchemaStats measures the parsed schema node without inlining it: nodes is
+// how many values the tree holds, counting node itself and every object,
+// array, key's value, element and scalar beneath it, maxDepth is the depth of
+// the most deeply nested value, node itself being at depth 0, and refs is how
+// many $refs its schemas hold, leaving out data like the values of "enum".
+// A tree passes Options.MaxDepth if maxDepth is less than it. Values nested
+// DefaultMaxDepth deep or deeper aren't measured, and maxDepth is capped at
+// DefaultMaxDepth. An object or array found inside itself is measured once,
+// and makes maxDepth DefaultMaxDepth, since inlining it never ends.
+func SchemaStats(node any) (nodes int, maxDepth int, refs int) {
+	// onPath holds the objects and arrays between node and the value being
+	// walked, by identity, so a cycle is cut where it closes rather than
+	// walked once per path down to DefaultMaxDepth, which a cycle with two
+	// branches takes about 2^DefaultMaxDepth visits to do.
+	onPath := map[any]bool{}
+	var walk func(node any, depth int, role valueRole)
+	walk = func(node any, depth int, role valueRole) {
+		id, container := identity(node)
+		if depth >= DefaultMaxDepth || container && onPath[id] {
+			maxDepth = DefaultMaxDepth
+			return
+		}
+		nodes++
+		maxDepth = max(maxDepth, depth)
+		if container {
+			onPath[id] = true
+			defer delete(onPath, id)
+		}
+		switch v := node.(type) {
+		case map[string]any:
+			if _, ok := v["$ref"].(string); ok && role == roleSchema {
+				refs++
+			}
+			for k, child := range v {
+				walk(child, depth+1, role.child(k))
+			}
+		case []any:
+			if role == roleNamedSchemas {
+				role = roleData
+			}
+			for _, child := range v {
+				walk(child, depth+1, role)
+			}
+		}
+	}
+	walk(node, 0, roleSchema)
+	return nodes, maxDepth, refs
+}
+
+// valueRole is what a value in a schema tree holds, telling SchemaStats
+// which objects are schemas, as walkSchemas does.
+type valueRole int
+
+const (
+	roleSchema valueRole = iota
+	// roleNamedSchemas is the value of a keyword like "properties", whose
+	// values are schemas.
+	roleNamedSchemas
+	roleData
+)
+
+// child returns the role of the value of key k in an object in role r.
+func (r valueRole) child(k string) valueRole {
+	switch {
+	case r == roleNamedSchemas:
+		return roleSchema
+	case r == roleData || dataKeywords[k]:
+		return roleData
+	case schemaMapKeywords[k]:
+		return roleNamedSchemas
+	}
+	return roleSchema
+}
+
+// identity returns a comparable stand-in for the object or array node, and
+// whether node is one. Empty arrays can't hold themselves and have none.
+func identity(node any) (any, bool) {
+	switch v := node.(type) {
+	case map[string]any:
+		return reflect.ValueOf(v).UnsafePointer(), true
+	case []any:
+		if len(v) > 0 {
+			return &v[0], true
+		}
+	}
+	return nil, false
+}
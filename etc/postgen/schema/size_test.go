@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SizeTestSuite struct {
+	suite.Suite
+}
+
+func (s *SizeTestSuite) TestSchemaStats() {
+	type test struct {
+		Given    string
+		Nodes    int
+		MaxDepth int
+		Refs     int
+	}
+
+	tests := map[string]test{
+		"scalar": {
+			Given: `true`,
+			Nodes: 1,
+		},
+		"empty object": {
+			Given: `{}`,
+			Nodes: 1,
+		},
+		"nested": {
+			// The root, properties, a, its $ref, b, its type, allOf, its
+			// member, the member's $ref, required and its two strings.
+			Given: `{
+				"properties": {
+					"a": {"$ref": "#/$defs/A"},
+					"b": {"type": "string"}
+				},
+				"allOf": [{"$ref": "other.json"}],
+				"required": ["a", "b"]
+			}`,
+			Nodes:    12,
+			MaxDepth: 3,
+			Refs:     2,
+		},
+		"refs in data aren't counted": {
+			Given:    `{"enum": [{"$ref": "#/x"}], "default": {"$ref": "#/y"}, "properties": {"$ref": {"$ref": "#/z"}}}`,
+			Nodes:    9,
+			MaxDepth: 3,
+			Refs:     1,
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			root, err := parseJSON([]byte(v.Given))
+			s.Require().NoError(err)
+			nodes, maxDepth, refs := SchemaStats(root)
+			s.Equal(v.Nodes, nodes, "nodes")
+			s.Equal(v.MaxDepth, maxDepth, "max depth")
+			s.Equal(v.Refs, refs, "refs")
+		})
+	}
+}
+
+func (s *SizeTestSuite) TestSchemaStatsMatchesMaxDepth() {
+	root, err := parseJSON([]byte(`{"a": [[{"b": 1}]]}`))
+	s.Require().NoError(err)
+	_, maxDepth, _ := SchemaStats(root)
+
+	_, err = ResolveDocument(root, Options{MaxDepth: maxDepth + 1})
+	s.NoError(err)
+	_, err = ResolveDocument(root, Options{MaxDepth: maxDepth})
+	s.Error(err)
+}
+
+func (s *SizeTestSuite) TestSchemaStatsCyclic() {
+	cyclic := map[string]any{"$ref": "#"}
+	cyclic["items"] = cyclic
+
+	nodes, maxDepth, refs := SchemaStats(cyclic)
+	s.Equal(2, nodes)
+	s.Equal(DefaultMaxDepth, maxDepth)
+	s.Equal(1, refs)
+}
+
+func (s *SizeTestSuite) TestSchemaStatsBranchingCycle() {
+	// Walking every path down to DefaultMaxDepth would take 2^DefaultMaxDepth
+	// visits.
+	cyclic := map[string]any{"$ref": "#"}
+	cyclic["anyOf"] = []any{cyclic, cyclic}
+	cyclic["properties"] = map[string]any{"a": cyclic, "b": cyclic}
+
+	// The root, its $ref, anyOf and properties.
+	nodes, maxDepth, refs := SchemaStats(cyclic)
+	s.Equal(4, nodes)
+	s.Equal(DefaultMaxDepth, maxDepth)
+	s.Equal(1, refs)
+}
+
+func (s *SizeTestSuite) TestSchemaStatsSharedSubtree() {
+	// A value reached twice without a cycle is in the output twice.
+	shared := map[string]any{"$ref": "#/$defs/A"}
+	node := map[string]any{"properties": map[string]any{"a": shared, "b": shared}}
+
+	nodes, maxDepth, refs := SchemaStats(node)
+	s.Equal(6, nodes)
+	s.Equal(3, maxDepth)
+	s.Equal(2, refs)
+}
+
+func TestSizeTestSuite(t *testing.T) {
+	suite.Run(t, new(SizeTestSuite))
+}
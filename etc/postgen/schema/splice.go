@@ -0,0 +1,245 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// jsonSpan is where a value is in the source bytes of a document, along with
+// where its members or elements are if it's an object or array.
+type jsonSpan struct {
+	start, end int
+	members    []spanMember
+	elems      []*jsonSpan
+}
+
+// spanMember is a member of an object in the source bytes of a document.
+type spanMember struct {
+	key string
+	// keyStart is where the quoted key starts.
+	keyStart int
+	value    *jsonSpan
+}
+
+// spliceSource marshals out, the output for the JSON source src, keeping the
+// bytes of src for every value out leaves unchanged, as PreserveFormatting
+// describes. ok is false if src isn't plain JSON.
+func spliceSource(src []byte, out any, opts Options) (b []byte, ok bool, err error) {
+	if !json.Valid(src) {
+		return nil, false, nil
+	}
+	orig, err := decodeJSON(src)
+	if err != nil {
+		return nil, false, nil
+	}
+	p := spanParser{src: src}
+	root := p.value()
+
+	s := splicer{src: src, opts: opts, newline: "\n"}
+	if bytes.Contains(src, []byte("\r\n")) {
+		s.newline = "\r\n"
+	}
+	if err := s.render(root, orig, out); err != nil {
+		return nil, false, err
+	}
+	s.buf.Write(src[root.end:])
+	if !bytes.HasSuffix(s.buf.Bytes(), []byte("\n")) {
+		s.buf.WriteString(s.newline)
+	}
+	return s.buf.Bytes(), true, nil
+}
+
+// splicer writes the output of spliceSource.
+type splicer struct {
+	src     []byte
+	opts    Options
+	newline string
+	buf     bytes.Buffer
+}
+
+// render writes out, the output for the value orig at sp in the source.
+func (s *splicer) render(sp *jsonSpan, orig, out any) error {
+	if reflect.DeepEqual(orig, out) {
+		s.buf.Write(s.src[sp.start:sp.end])
+		return nil
+	}
+	switch o := orig.(type) {
+	case map[string]any:
+		if m, ok := out.(map[string]any); ok && len(sp.members) == len(o) && keysWithin(m, o) {
+			return s.renderObject(sp, o, m)
+		}
+	case []any:
+		if a, ok := out.([]any); ok && len(sp.elems) == len(o) && len(a) == len(o) {
+			return s.renderArray(sp, o, a)
+		}
+	}
+	return s.rewrite(sp, out)
+}
+
+// renderObject writes out, an object with some of the keys of orig at sp,
+// keeping the source text around the members it still has.
+func (s *splicer) renderObject(sp *jsonSpan, orig, out map[string]any) error {
+	var kept []int
+	for i, m := range sp.members {
+		if _, ok := out[m.key]; ok {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == 0 {
+		s.buf.WriteString("{}")
+		return nil
+	}
+	s.buf.Write(s.src[sp.start:sp.members[0].keyStart])
+	for j, i := range kept {
+		m := sp.members[i]
+		s.buf.Write(s.src[m.keyStart:m.value.start])
+		if err := s.render(m.value, orig[m.key], out[m.key]); err != nil {
+			return err
+		}
+		// The text up to the next member has the comma, while the text
+		// after the last member closes the object.
+		if j < len(kept)-1 {
+			s.buf.Write(s.src[m.value.end:sp.members[i+1].keyStart])
+		}
+	}
+	s.buf.Write(s.src[sp.members[len(sp.members)-1].value.end:sp.end])
+	return nil
+}
+
+// renderArray writes out, an array as long as orig at sp, keeping the source
+// text between its elements.
+func (s *splicer) renderArray(sp *jsonSpan, orig, out []any) error {
+	if len(sp.elems) == 0 {
+		s.buf.Write(s.src[sp.start:sp.end])
+		return nil
+	}
+	s.buf.Write(s.src[sp.start:sp.elems[0].start])
+	for i, e := range sp.elems {
+		if err := s.render(e, orig[i], out[i]); err != nil {
+			return err
+		}
+		next := sp.end - 1
+		if i < len(sp.elems)-1 {
+			next = sp.elems[i+1].start
+		}
+		s.buf.Write(s.src[e.end:next])
+	}
+	s.buf.WriteByte(']')
+	return nil
+}
+
+// rewrite writes out marshaled in place of the value at sp, indented to line
+// up with the line sp starts on.
+func (s *splicer) rewrite(sp *jsonSpan, out any) error {
+	b, err := s.opts.marshal(outputValue(out, s.opts))
+	if err != nil {
+		return err
+	}
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	indent := s.newline + string(lineIndent(s.src, sp.start))
+	s.buf.Write(bytes.ReplaceAll(b, []byte("\n"), []byte(indent)))
+	return nil
+}
+
+// lineIndent returns the whitespace the line holding offset i of src starts
+// with.
+func lineIndent(src []byte, i int) []byte {
+	start := bytes.LastIndexByte(src[:i], '\n') + 1
+	end := start
+	for end < i && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return src[start:end]
+}
+
+// keysWithin reports whether every key of m is a key of orig.
+func keysWithin(m, orig map[string]any) bool {
+	for k := range m {
+		if _, ok := orig[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// spanParser finds the jsonSpan of each value in src, which must be valid
+// JSON.
+type spanParser struct {
+	src []byte
+	i   int
+}
+
+func (p *spanParser) skipSpace() {
+	for p.i < len(p.src) {
+		switch p.src[p.i] {
+		case ' ', '\t', '\r', '\n':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// value returns the span of the value at or after the current offset.
+func (p *spanParser) value() *jsonSpan {
+	p.skipSpace()
+	sp := &jsonSpan{start: p.i}
+	switch p.src[p.i] {
+	case '{':
+		p.i++
+		for {
+			p.skipSpace()
+			if p.src[p.i] == '}' {
+				break
+			}
+			keyStart := p.i
+			p.string()
+			var key string
+			_ = json.Unmarshal(p.src[keyStart:p.i], &key)
+			p.skipSpace()
+			p.i++ // ':'
+			sp.members = append(sp.members, spanMember{key: key, keyStart: keyStart, value: p.value()})
+			p.skipSpace()
+			if p.src[p.i] == ',' {
+				p.i++
+			}
+		}
+		p.i++
+	case '[':
+		p.i++
+		for {
+			p.skipSpace()
+			if p.src[p.i] == ']' {
+				break
+			}
+			sp.elems = append(sp.elems, p.value())
+			p.skipSpace()
+			if p.src[p.i] == ',' {
+				p.i++
+			}
+		}
+		p.i++
+	case '"':
+		p.string()
+	default:
+		for p.i < len(p.src) && strings.IndexByte(",]} \t\r\n", p.src[p.i]) < 0 {
+			p.i++
+		}
+	}
+	sp.end = p.i
+	return sp
+}
+
+// string moves past the string starting at the current offset.
+func (p *spanParser) string() {
+	p.i++
+	for p.src[p.i] != '"' {
+		if p.src[p.i] == '\\' {
+			p.i++
+		}
+		p.i++
+	}
+	p.i++
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SpliceTestSuite struct {
+	suite.Suite
+}
+
+func (s *SpliceTestSuite) TestInlineBundledSchemasInFSPreserveFormatting() {
+	type test struct {
+		Given    string
+		Opts     Options
+		Expected string
+	}
+
+	tests := map[string]test{
+		"ref sites": {
+			Given: "{\n" +
+				"    \"type\" :  \"object\",\n" +
+				"    \"properties\": {\n" +
+				"        \"id\":   {\"type\": \"integer\", \"maximum\": 1.0E3},\n" +
+				"        \"name\": {\"$ref\": \"#/$defs/Name\"},\n" +
+				"        \"tags\": [ {\"$ref\": \"#/$defs/Name\"}, {\"type\": \"null\"} ]\n" +
+				"    },\n" +
+				"    \"$defs\": {\"Name\": {\"type\": \"string\", \"minLength\": 1}}\n" +
+				"}\n",
+			Expected: "{\n" +
+				"    \"type\" :  \"object\",\n" +
+				"    \"properties\": {\n" +
+				"        \"id\":   {\"type\": \"integer\", \"maximum\": 1.0E3},\n" +
+				"        \"name\": {\n" +
+				"          \"minLength\": 1,\n" +
+				"          \"type\": \"string\"\n" +
+				"        },\n" +
+				"        \"tags\": [ {\n" +
+				"          \"minLength\": 1,\n" +
+				"          \"type\": \"string\"\n" +
+				"        }, {\"type\": \"null\"} ]\n" +
+				"    }\n" +
+				"}\n",
+		},
+		"stripped keys": {
+			Given: "{\"$id\": \"https://example.com/a\",\r\n" +
+				"  \"items\": {\"$id\": \"b\", \"type\": \"string\"},\r\n" +
+				"  \"enum\": [1, 2.50]}",
+			Expected: "{\"items\": {\"type\": \"string\"},\r\n" +
+				"  \"enum\": [1, 2.50]}\r\n",
+		},
+		"everything stripped": {
+			Given:    `{"$defs": {"A": {}}}`,
+			Expected: "{}\n",
+		},
+		"unchanged": {
+			Given:    "[1,\n 2 ]\n\n",
+			Expected: "[1,\n 2 ]\n\n",
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			opts := v.Opts
+			opts.PreserveFormatting = true
+			updates, err := InlineBundledSchemasInFS(fstest.MapFS{"schema.json": {Data: []byte(v.Given)}}, opts)
+			s.Require().NoError(err)
+			s.Equal(v.Expected, string(updates["schema.json"]))
+
+			out, err := InlineSchemaBytes([]byte(v.Given), opts)
+			s.Require().NoError(err)
+			s.Equal(v.Expected, string(out))
+		})
+	}
+}
+
+func (s *SpliceTestSuite) TestInlineBundledSchemasInFSPreserveFormattingFallback() {
+	fsys := fstest.MapFS{
+		"schema.json5": {Data: []byte(`{properties: {a: {$ref: "#/$defs/A"}}, $defs: {A: {type: "string"}}}`)},
+	}
+
+	updates, err := InlineBundledSchemasInFS(fsys, Options{Dialect: DialectJSON5, PreserveFormatting: true})
+	s.Require().NoError(err)
+	s.Equal("{\n  \"properties\": {\n    \"a\": {\n      \"type\": \"string\"\n    }\n  }\n}\n", string(updates["schema.json5"]))
+}
+
+func TestSpliceTestSuite(t *testing.T) {
+	suite.Run(t, new(SpliceTestSuite))
+}
@@ -0,0 +1,211 @@
+package schema
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SplitOptions configures SplitSchema.
+type SplitOptions struct {
+	// MainPath is the output path of the rewritten input document. Defaults to
+	// "schema.json".
+	MainPath string
+
+	// DefsDir is the directory extracted subschemas are written to. Defaults
+	// to "defs".
+	DefsDir string
+
+	// MinOccurrences is how many identical copies of a subschema there must be
+	// for it to be extracted. Defaults to 2.
+	MinOccurrences int
+
+	// MinBytes is the size of the smallest subschema, as compact JSON, worth
+	// extracting. Defaults to 32.
+	MinBytes int
+
+	// LineEnding is the line terminator of the output files.
+	LineEnding LineEnding
+}
+
+// SplitSchema is the inverse of inlining. It finds subschemas of doc that are
+// duplicated at least opts.MinOccurrences times, moves each into its own file
+// under opts.DefsDir and replaces every copy with a $ref to that file. Files
+// are named after the subschema's title or $anchor where present.
+//
+// Larger subschemas are extracted first, so duplicates nested inside them end
+// up as refs between the extracted files. Subschemas containing a $ref are
+// never extracted, since moving them would break the ref.
+//
+// Returns the contents of the rewritten document and every extracted file,
+// keyed by path.
+func SplitSchema(doc []byte, opts SplitOptions) (map[string][]byte, error) {
+	if opts.MainPath == "" {
+		opts.MainPath = "schema.json"
+	}
+	if opts.DefsDir == "" {
+		opts.DefsDir = "defs"
+	}
+	if opts.MinOccurrences == 0 {
+		opts.MinOccurrences = 2
+	}
+	if opts.MinBytes == 0 {
+		opts.MinBytes = 32
+	}
+
+	root, err := parseJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	files := map[string]any{opts.MainPath: root}
+	taken := map[string]bool{}
+	for {
+		cands := map[string]*splitCandidate{}
+		for _, tree := range files {
+			collectSplitCandidates(tree, true, cands)
+		}
+		best := bestSplitCandidate(cands, opts)
+		if best == nil {
+			break
+		}
+
+		name := splitFileName(best.value, len(taken)+1, taken)
+		p := path.Join(opts.DefsDir, name+".json")
+		for fp, tree := range files {
+			files[fp] = replaceSubschema(tree, best.hash, relPath(path.Dir(fp), p), true)
+		}
+		files[p] = best.value
+	}
+
+	out := make(map[string][]byte, len(files))
+	for p, tree := range files {
+		b, err := marshalSchema(tree, Options{LineEnding: opts.LineEnding})
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %w", p, err)
+		}
+		out[p] = b
+	}
+	return out, nil
+}
+
+// splitCandidate is a subschema that may be worth extracting.
+type splitCandidate struct {
+	hash  string
+	value any
+	count int
+	size  int
+}
+
+// collectSplitCandidates records every object subschema of node other than
+// node itself, if isRoot, in cands.
+func collectSplitCandidates(node any, isRoot bool, cands map[string]*splitCandidate) {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return
+	}
+	if !isRoot && !containsRef(m) {
+		b := canonicalJSON(m)
+		h := canonicalHash(m)
+		if c, ok := cands[h]; ok {
+			c.count++
+		} else {
+			cands[h] = &splitCandidate{hash: h, value: m, count: 1, size: len(b)}
+		}
+	}
+	mapSubschemas(m, func(sub any) any {
+		collectSplitCandidates(sub, false, cands)
+		return sub
+	})
+}
+
+// bestSplitCandidate picks the largest candidate meeting the thresholds in
+// opts, or nil if there are none.
+func bestSplitCandidate(cands map[string]*splitCandidate, opts SplitOptions) *splitCandidate {
+	var best *splitCandidate
+	for _, c := range cands {
+		if c.count < opts.MinOccurrences || c.size < opts.MinBytes {
+			continue
+		}
+		if best == nil || c.size > best.size || (c.size == best.size && c.hash < best.hash) {
+			best = c
+		}
+	}
+	return best
+}
+
+// replaceSubschema replaces every subschema of node whose canonical hash is
+// hash with a $ref to ref. node itself is never replaced if isRoot.
+func replaceSubschema(node any, hash, ref string, isRoot bool) any {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return node
+	}
+	if !isRoot && canonicalHash(m) == hash {
+		return map[string]any{"$ref": ref}
+	}
+	return mapSubschemas(m, func(sub any) any {
+		return replaceSubschema(sub, hash, ref, false)
+	})
+}
+
+// containsRef reports whether node has a $ref anywhere within it.
+func containsRef(node any) bool {
+	switch v := node.(type) {
+	case map[string]any:
+		if _, ok := v["$ref"]; ok {
+			return true
+		}
+		for _, child := range v {
+			if containsRef(child) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if containsRef(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitFileName derives a file name, without extension, for an extracted
+// subschema from its title or $anchor, falling back to "def<n>". Names already
+// in taken get a numeric suffix. The chosen name is added to taken.
+func splitFileName(schema any, n int, taken map[string]bool) string {
+	m, _ := schema.(map[string]any)
+	var name string
+	for _, k := range []string{"title", "$anchor"} {
+		if s, ok := m[k].(string); ok {
+			if name = sanitizeFileName(s); name != "" {
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = "def" + strconv.Itoa(n)
+	}
+
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// sanitizeFileName replaces characters that don't belong in a file name with
+// underscores.
+func sanitizeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(s))
+	return strings.Trim(s, "_")
+}
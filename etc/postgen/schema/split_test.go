@@ -0,0 +1,177 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SplitTestSuite struct {
+	suite.Suite
+}
+
+func (s *SplitTestSuite) TestSplitSchema() {
+	type test struct {
+		Given    string
+		Opts     SplitOptions
+		Expected map[string]string
+	}
+
+	address := `{"title": "Postal Address", "properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}}}`
+
+	tests := map[string]test{
+		"extracts duplicates": {
+			Given: `{
+				"properties": {
+					"home": ` + address + `,
+					"work": ` + address + `,
+					"tags": {"items": {"type": "string"}}
+				}
+			}`,
+			Expected: map[string]string{
+				"schema.json": `{
+					"properties": {
+						"home": {"$ref": "defs/Postal_Address.json"},
+						"work": {"$ref": "defs/Postal_Address.json"},
+						"tags": {"items": {"type": "string"}}
+					}
+				}`,
+				"defs/Postal_Address.json": address,
+			},
+		},
+		"nested duplicates reference each other": {
+			Given: `{
+				"properties": {
+					"a": {"$anchor": "Wrapper", "properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}, "x": {"type": "integer"}}},
+					"b": {"$anchor": "Wrapper", "properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}, "x": {"type": "integer"}}},
+					"c": {"type": "string", "pattern": "^[0-9]{5}$"}
+				}
+			}`,
+			Opts: SplitOptions{MainPath: "main.json", DefsDir: "types"},
+			Expected: map[string]string{
+				"main.json": `{
+					"properties": {
+						"a": {"$ref": "types/Wrapper.json"},
+						"b": {"$ref": "types/Wrapper.json"},
+						"c": {"$ref": "types/def2.json"}
+					}
+				}`,
+				"types/Wrapper.json": `{"$anchor": "Wrapper", "properties": {"zip": {"$ref": "def2.json"}, "x": {"type": "integer"}}}`,
+				"types/def2.json":    `{"type": "string", "pattern": "^[0-9]{5}$"}`,
+			},
+		},
+		"below thresholds": {
+			Given: `{"properties": {"a": {"type": "string"}, "b": {"type": "string"}}}`,
+			Expected: map[string]string{
+				"schema.json": `{"properties": {"a": {"type": "string"}, "b": {"type": "string"}}}`,
+			},
+		},
+		"keys of properties are not schemas": {
+			Given: `{
+				"properties": {"a": {"properties": {"x": {"type": "string"}, "y": {"type": "string"}}}},
+				"items": {"properties": {"x": {"type": "string"}, "y": {"type": "string"}}}
+			}`,
+			Opts: SplitOptions{MinBytes: 1},
+			Expected: map[string]string{
+				"schema.json": `{
+					"properties": {"a": {"$ref": "defs/def1.json"}},
+					"items": {"$ref": "defs/def1.json"}
+				}`,
+				"defs/def1.json": `{"properties": {"x": {"$ref": "def2.json"}, "y": {"$ref": "def2.json"}}}`,
+				"defs/def2.json": `{"type": "string"}`,
+			},
+		},
+		"pattern property keys are not paths": {
+			Given: `{
+				"patternProperties": {
+					"^/a/~1$": {"type": "string", "pattern": "^[0-9]{5}$"},
+					"#/$defs/b": {"type": "string", "pattern": "^[0-9]{5}$"}
+				}
+			}`,
+			Expected: map[string]string{
+				"schema.json": `{
+					"patternProperties": {
+						"^/a/~1$": {"$ref": "defs/def1.json"},
+						"#/$defs/b": {"$ref": "defs/def1.json"}
+					}
+				}`,
+				"defs/def1.json": `{"type": "string", "pattern": "^[0-9]{5}$"}`,
+			},
+		},
+		"subschemas with refs stay": {
+			Given: `{
+				"properties": {
+					"a": {"items": {"$ref": "#/$defs/X"}, "description": "long enough to extract"},
+					"b": {"items": {"$ref": "#/$defs/X"}, "description": "long enough to extract"}
+				},
+				"$defs": {"X": {}}
+			}`,
+			Expected: map[string]string{
+				"schema.json": `{
+					"properties": {
+						"a": {"items": {"$ref": "#/$defs/X"}, "description": "long enough to extract"},
+						"b": {"items": {"$ref": "#/$defs/X"}, "description": "long enough to extract"}
+					},
+					"$defs": {"X": {}}
+				}`,
+			},
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			out, err := SplitSchema([]byte(v.Given), v.Opts)
+			if !s.NoError(err) {
+				return
+			}
+
+			actual := map[string]string{}
+			for p, b := range out {
+				actual[p] = string(b)
+			}
+			if !s.Len(actual, len(v.Expected)) {
+				s.T().Log(actual)
+				return
+			}
+			for p, expected := range v.Expected {
+				s.JSONEq(expected, actual[p], p)
+			}
+		})
+	}
+}
+
+func (s *SplitTestSuite) TestSplitSchemaRoundTrip() {
+	given := `{
+		"properties": {
+			"home": {"title": "Address", "properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}}},
+			"work": {"title": "Address", "properties": {"zip": {"type": "string", "pattern": "^[0-9]{5}$"}}}
+		}
+	}`
+
+	files, err := SplitSchema([]byte(given), SplitOptions{MinBytes: 1})
+	s.Require().NoError(err)
+
+	fsys := fstest.MapFS{}
+	for p, b := range files {
+		fsys[p] = &fstest.MapFile{Data: b}
+	}
+	out, err := InlineSchemaBytes(files["schema.json"], Options{FS: fsys})
+	s.Require().NoError(err)
+	s.JSONEq(given, string(out))
+}
+
+func (s *SplitTestSuite) TestSplitSchemaEscapeHTML() {
+	files, err := SplitSchema([]byte(`{
+		"properties": {
+			"a": {"title": "A&B", "description": "must be > 0", "type": "integer"},
+			"b": {"title": "A&B", "description": "must be > 0", "type": "integer"}
+		}
+	}`), SplitOptions{MinBytes: 1})
+	s.Require().NoError(err)
+	s.Equal("{\n  \"description\": \"must be > 0\",\n  \"title\": \"A&B\",\n  \"type\": \"integer\"\n}\n", string(files["defs/A_B.json"]))
+}
+
+func TestSplitTestSuite(t *testing.T) {
+	suite.Run(t, new(SplitTestSuite))
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// UnresolvedVarPolicy is what to do with a ${NAME} placeholder whose variable
+// isn't set.
+type UnresolvedVarPolicy string
+
+const (
+	// UnresolvedVarError aborts with an error. It's the default.
+	UnresolvedVarError UnresolvedVarPolicy = "Error"
+	// UnresolvedVarKeep leaves the placeholder as is.
+	UnresolvedVarKeep UnresolvedVarPolicy = "Keep"
+)
+
+// varPattern matches a ${NAME} placeholder, capturing NAME.
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteVars replaces the ${NAME} placeholders in every string value within
+// node, but not in object keys, with the values opts.Substitute looks up. node
+// is not modified.
+func substituteVars(node any, opts Options) (any, error) {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		// Sorted, so the same placeholder is reported first every time.
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			s, err := substituteVars(v[k], opts)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = s
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			s, err := substituteVars(child, opts)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = s
+		}
+		return out, nil
+	case string:
+		return substituteString(v, opts)
+	}
+	return node, nil
+}
+
+// substituteString replaces the ${NAME} placeholders in s.
+func substituteString(s string, opts Options) (string, error) {
+	lookup := opts.Substitute
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	var err error
+	out := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := varPattern.FindStringSubmatch(match)[1]
+		if val, ok := lookup(name); ok {
+			return val
+		}
+		switch opts.OnUnresolvedVar {
+		case "", UnresolvedVarError:
+			if err == nil {
+				err = fmt.Errorf("variable %q in %q is not set", name, s)
+			}
+		case UnresolvedVarKeep:
+		default:
+			err = fmt.Errorf("unknown unresolved variable policy %q", opts.OnUnresolvedVar)
+		}
+		return match
+	})
+	return out, err
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SubstituteTestSuite struct {
+	suite.Suite
+}
+
+func (s *SubstituteTestSuite) TestInlineSchemaBytesSubstituteVars() {
+	type test struct {
+		Given       string
+		Opts        Options
+		Expected    string
+		ExpectedErr string
+	}
+
+	vars := map[string]string{"REGION": "eu-west-1", "STAGE": "prod", "TYPE": "string"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := map[string]test{
+		"values": {
+			Given: `{
+				"properties": {
+					"region": {"default": "${REGION}", "enum": ["${REGION}", "us-east-1"]},
+					"url": {"const": "https://${STAGE}.example.com/${REGION}"},
+					"${REGION}": {"type": "integer"},
+					"n": {"maximum": 3}
+				}
+			}`,
+			Opts: Options{SubstituteVars: true, Substitute: lookup},
+			Expected: `{
+				"properties": {
+					"region": {"default": "eu-west-1", "enum": ["eu-west-1", "us-east-1"]},
+					"url": {"const": "https://prod.example.com/eu-west-1"},
+					"${REGION}": {"type": "integer"},
+					"n": {"maximum": 3}
+				}
+			}`,
+		},
+		"refs and cross-file documents": {
+			Given:    `{"properties": {"a": {"$ref": "${STAGE}.json"}}}`,
+			Opts:     Options{SubstituteVars: true, Substitute: lookup},
+			Expected: `{"properties": {"a": {"type": "string"}}}`,
+		},
+		"not placeholders": {
+			Given:    `{"pattern": "^\\$\\{[a-z]+\\}$", "default": "$REGION ${} ${1X} ${REGION"}`,
+			Opts:     Options{SubstituteVars: true, Substitute: lookup},
+			Expected: `{"pattern": "^\\$\\{[a-z]+\\}$", "default": "$REGION ${} ${1X} ${REGION"}`,
+		},
+		"off by default": {
+			Given:    `{"default": "${REGION}"}`,
+			Opts:     Options{Substitute: lookup},
+			Expected: `{"default": "${REGION}"}`,
+		},
+		"unresolved": {
+			Given:       `{"properties": {"b": {"default": "${MISSING_B}"}, "a": {"default": "${MISSING_A}"}}}`,
+			Opts:        Options{SubstituteVars: true, Substitute: lookup},
+			ExpectedErr: `variable "MISSING_A" in "${MISSING_A}" is not set`,
+		},
+		"unresolved kept": {
+			Given:    `{"default": "${REGION}/${MISSING}"}`,
+			Opts:     Options{SubstituteVars: true, Substitute: lookup, OnUnresolvedVar: UnresolvedVarKeep},
+			Expected: `{"default": "eu-west-1/${MISSING}"}`,
+		},
+	}
+
+	for desc, v := range tests {
+		s.Run(desc, func() {
+			v.Opts.FS = fstest.MapFS{"prod.json": {Data: []byte(`{"type": "${TYPE}"}`)}}
+			out, err := InlineSchemaBytes([]byte(v.Given), v.Opts)
+			if v.ExpectedErr != "" {
+				s.EqualError(err, v.ExpectedErr)
+				return
+			}
+			if s.NoError(err) {
+				s.JSONEq(v.Expected, string(out))
+			}
+		})
+	}
+}
+
+func (s *SubstituteTestSuite) TestSubstituteEnv() {
+	s.T().Setenv("POSTGEN_TEST_REGION", "eu-west-1")
+
+	out, err := InlineSchemaBytes([]byte(`{"default": "${POSTGEN_TEST_REGION}"}`), Options{SubstituteVars: true})
+	s.Require().NoError(err)
+	s.JSONEq(`{"default": "eu-west-1"}`, string(out))
+}
+
+func TestSubstituteTestSuite(t *testing.T) {
+	suite.Run(t, new(SubstituteTestSuite))
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ErrStale is wrapped by the error Verify returns when inlining would change
+// files.
+var ErrStale = errors.New("inlined schemas are out of date")
+
+// StaleError lists the files Verify found out of date. It wraps ErrStale.
+type StaleError struct {
+	// Paths are the files inlining would change or create, sorted.
+	Paths []string
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrStale, strings.Join(e.Paths, ", "))
+}
+
+func (e *StaleError) Unwrap() error {
+	return ErrStale
+}
+
+// Verify inlines the schemas in fsys as InlineBundledSchemasInFS does and
+// compares the outputs with the files in fsys, without writing anything even
+// if fsys is writable. It returns a *StaleError listing the files whose
+// contents differ or that don't exist yet, or nil if every one is up to date.
+// Gzipped files are compared by their decompressed contents.
+func Verify(fsys fs.FS, options ...Option) error {
+	opts := buildOptions(options)
+	if opts.FS == nil {
+		opts.FS = fsys
+	}
+	// Hide any WriteFile method, so nothing is written back.
+	updates, err := InlineBundledSchemasInFS(readOnlyFS{fsys}, opts)
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, p := range slices.Sorted(maps.Keys(updates)) {
+		have, err := readSchemaFile(fsys, p)
+		if errors.Is(err, fs.ErrNotExist) {
+			stale = append(stale, p)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", p, err)
+		}
+		want, err := decodeSchemaFile(p, updates[p])
+		if err != nil {
+			return fmt.Errorf("decompress output %s: %w", p, err)
+		}
+		if !bytes.Equal(have, want) {
+			stale = append(stale, p)
+		}
+	}
+	if len(stale) > 0 {
+		return &StaleError{Paths: stale}
+	}
+	return nil
+}
+
+// readOnlyFS is an fs.FS with only the methods of fs.FS.
+type readOnlyFS struct {
+	fs.FS
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type VerifyTestSuite struct {
+	suite.Suite
+}
+
+func (v *VerifyTestSuite) TestVerify() {
+	type test struct {
+		Given         fstest.MapFS
+		Opts          Options
+		ExpectedStale []string
+	}
+
+	inlined := "{\n  \"type\": \"string\"\n}\n"
+	tests := map[string]test{
+		"up to date": {
+			Given: fstest.MapFS{
+				"a.json":    {Data: []byte(inlined)},
+				"b.json.gz": {Data: gzipped(v.T(), inlined)},
+			},
+		},
+		"stale": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(inlined)},
+				"b.json": {Data: []byte(`{"$ref": "#/$defs/B", "$defs": {"B": {"type": "string"}}}`)},
+				"c.json": {Data: []byte(`{"type": "string"}`)},
+			},
+			ExpectedStale: []string{"b.json", "c.json"},
+		},
+		"missing output": {
+			Given: fstest.MapFS{
+				"a.json": {Data: []byte(inlined)},
+			},
+			Opts:          Options{OutputFormats: []Format{{Suffix: ".min", Minify: true}}},
+			ExpectedStale: []string{"a.min.json"},
+		},
+	}
+
+	for desc, tt := range tests {
+		v.Run(desc, func() {
+			err := Verify(tt.Given, tt.Opts)
+			if tt.ExpectedStale == nil {
+				v.NoError(err)
+				return
+			}
+			v.ErrorIs(err, ErrStale)
+			var stale *StaleError
+			v.Require().ErrorAs(err, &stale)
+			v.Equal(tt.ExpectedStale, stale.Paths)
+		})
+	}
+}
+
+func (v *VerifyTestSuite) TestVerifyDoesNotWrite() {
+	given := `{"$ref": "#/$defs/A", "$defs": {"A": {}}}`
+	fsys := writableFS{fstest.MapFS{"a.json": {Data: []byte(given)}}}
+
+	err := Verify(fsys)
+	v.EqualError(err, "inlined schemas are out of date: a.json")
+	v.Equal(given, string(fsys.MapFS["a.json"].Data))
+}
+
+func (v *VerifyTestSuite) TestVerifyError() {
+	err := Verify(fstest.MapFS{"a.json": {Data: []byte(`{"$ref": "#/$defs/A"}`)}})
+	v.Error(err)
+	v.False(errors.Is(err, ErrStale))
+}
+
+func TestVerifyTestSuite(t *testing.T) {
+	suite.Run(t, new(VerifyTestSuite))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WriteTestSuite struct {
+	suite.Suite
+}
+
+func (w *WriteTestSuite) TestWriteFile() {
+	type test struct {
+		Existing os.FileMode
+		Perm     os.FileMode
+		Expected os.FileMode
+	}
+
+	tests := map[string]test{
+		"new file": {
+			Perm:     0o644,
+			Expected: 0o644,
+		},
+		"keeps existing mode": {
+			Existing: 0o600,
+			Perm:     0o644,
+			Expected: 0o600,
+		},
+		"keeps existing executable mode": {
+			Existing: 0o755,
+			Perm:     0o644,
+			Expected: 0o755,
+		},
+	}
+
+	for desc, v := range tests {
+		w.Run(desc, func() {
+			dir := w.T().TempDir()
+			name := filepath.Join(dir, "out.json")
+			if v.Existing != 0 {
+				w.Require().NoError(os.WriteFile(name, []byte("old"), v.Existing))
+				w.Require().NoError(os.Chmod(name, v.Existing))
+			}
+
+			w.Require().NoError(writeFile(name, []byte("new"), v.Perm))
+
+			b, err := os.ReadFile(name)
+			w.Require().NoError(err)
+			w.Equal("new", string(b))
+			fi, err := os.Stat(name)
+			w.Require().NoError(err)
+			w.Equal(v.Expected, fi.Mode().Perm())
+			entries, err := os.ReadDir(dir)
+			w.Require().NoError(err)
+			w.Len(entries, 1, "temporary file left behind")
+		})
+	}
+}
+
+func TestWriteTestSuite(t *testing.T) {
+	suite.Run(t, new(WriteTestSuite))
+}